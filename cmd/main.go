@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"RestCLI/pkg"
 	"RestCLI/web"
@@ -29,12 +31,69 @@ var webCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().String("proxy", "", "Proxy for all requests (http://, https:// or socks5://[user:pass@]host:port)")
+	rootCmd.PersistentFlags().String("no-proxy", "", "Comma separated hosts, domains or CIDRs that bypass the proxy")
+	rootCmd.PersistentFlags().Float64("rate-limit", 0, "Maximum requests per second to each host, 0 for no limit")
+	rootCmd.PersistentFlags().Int("burst", 1, "Requests to a host that may be sent at once before --rate-limit applies")
+	rootCmd.PersistentFlags().Int("max-in-flight", 0, "Maximum concurrent requests to each host, 0 for no limit")
+	rootCmd.PersistentFlags().String("cache", "", "Cache responses for the session: default, no-cache or reload")
+	rootCmd.PersistentFlags().String("unix-socket", "", "Send requests over this Unix domain socket")
+	rootCmd.PersistentFlags().String("protocol", "", "Force the HTTP version: http1, http2 (ALPN) or h2c (cleartext HTTP/2)")
+	rootCmd.PersistentFlags().StringArray("resolve", nil, "Connect to address instead of resolving host:port, as host:port:address (repeatable)")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// Only the CLI user's own files and sockets are theirs to use
+		pkg.DefaultEngine().SetLocalAccess(cmd != webCmd)
+
+		proxy, _ := cmd.Flags().GetString("proxy")
+		noProxy, _ := cmd.Flags().GetString("no-proxy")
+		if proxy != "" {
+			pkg.DefaultEngine().SetProxy(&pkg.ProxyOptions{URL: proxy, NoProxy: noProxy})
+		}
+
+		// The global limit, workspaces can set their own in the web interface
+		rateLimit, _ := cmd.Flags().GetFloat64("rate-limit")
+		burst, _ := cmd.Flags().GetInt("burst")
+		maxInFlight, _ := cmd.Flags().GetInt("max-in-flight")
+		if rateLimit > 0 || maxInFlight > 0 {
+			pkg.DefaultEngine().SetRateLimit("", &pkg.RateLimit{
+				RequestsPerSecond: rateLimit,
+				Burst:             burst,
+				MaxInFlight:       maxInFlight,
+			})
+		}
+
+		protocol, _ := cmd.Flags().GetString("protocol")
+		pkg.DefaultEngine().SetProtocol(protocol)
+
+		cacheMode, _ := cmd.Flags().GetString("cache")
+		pkg.DefaultEngine().SetCacheMode(cacheMode)
+
+		unixSocket, _ := cmd.Flags().GetString("unix-socket")
+		pkg.DefaultEngine().SetUnixSocket(unixSocket)
+
+		entries, _ := cmd.Flags().GetStringArray("resolve")
+		if len(entries) > 0 {
+			resolve := make(map[string]string)
+			for _, entry := range entries {
+				key, address, err := pkg.ParseResolveEntry(entry)
+				if err != nil {
+					return err
+				}
+				resolve[key] = address
+			}
+			pkg.DefaultEngine().SetResolve(resolve)
+		}
+		return nil
+	}
+
 	webCmd.Flags().StringP("port", "p", "8080", "Port to run the web server on")
 	rootCmd.AddCommand(webCmd)
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	pkg.RemoveSpilledBodies()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -43,13 +102,14 @@ func startInteractiveMenu() {
 	for {
 		prompt := promptui.Select{
 			Label: "Select an HTTP method",
-			Items: []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "Exit"},
+			Items: []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "DOWNLOAD", "EVENTS", "WEBSOCKET", "GRPC", "Exit"},
 		}
 
 		_, choice, err := prompt.Run()
 
 		if err != nil {
 			fmt.Printf("Prompt failed: %v\n", err)
+			pkg.RemoveSpilledBodies()
 			os.Exit(1)
 		}
 
@@ -103,8 +163,50 @@ func startInteractiveMenu() {
 			}
 			pkg.HandleDeleteRequest(getURL)
 			// Call function to handle DELETE requests
+		case "DOWNLOAD":
+			fmt.Println("Selected DOWNLOAD")
+			getURL := promptURL()
+			if getURL == "" {
+				fmt.Println("URL cannot be empty")
+				break
+			}
+			outputPath := promptOutputPath()
+			if outputPath == "" {
+				fmt.Println("Output file cannot be empty")
+				break
+			}
+			pkg.HandleDownloadRequest(getURL, outputPath)
+		case "EVENTS":
+			fmt.Println("Selected EVENTS (Server-Sent Events)")
+			getURL := promptURL()
+			if getURL == "" {
+				fmt.Println("URL cannot be empty")
+				break
+			}
+			pkg.HandleEventStreamRequest(getURL)
+		case "WEBSOCKET":
+			fmt.Println("Selected WEBSOCKET")
+			getURL := promptURL()
+			if getURL == "" {
+				fmt.Println("URL cannot be empty")
+				break
+			}
+			pkg.HandleWebSocketSession(getURL, promptSubprotocols())
+		case "GRPC":
+			fmt.Println("Selected GRPC")
+			getURL := promptURL()
+			if getURL == "" {
+				fmt.Println("URL cannot be empty")
+				break
+			}
+			method := promptGRPCMethod(getURL)
+			if method == nil {
+				break
+			}
+			pkg.HandleGRPCRequest(getURL, method.FullName, promptGRPCMessage(method))
 		case "Exit":
 			fmt.Println("Exiting...")
+			pkg.RemoveSpilledBodies()
 			os.Exit(0)
 		}
 	}
@@ -123,3 +225,87 @@ func promptURL() string {
 
 	return url
 }
+
+func promptSubprotocols() []string {
+	prompt := promptui.Prompt{
+		Label: "Subprotocols (comma separated, optional):",
+	}
+
+	value, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	var subprotocols []string
+	for _, protocol := range strings.Split(value, ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			subprotocols = append(subprotocols, protocol)
+		}
+	}
+	return subprotocols
+}
+
+// promptGRPCMethod lists the methods the server offers by reflection and
+// returns the one chosen, or nil if there are none
+func promptGRPCMethod(url string) *pkg.GRPCMethod {
+	services, err := pkg.DefaultEngine().GRPCServices(context.Background(), pkg.APIRequest{URL: url})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return nil
+	}
+
+	var methods []pkg.GRPCMethod
+	var items []string
+	for _, service := range services {
+		for _, method := range service.Methods {
+			methods = append(methods, method)
+			items = append(items, method.FullName)
+		}
+	}
+	if len(methods) == 0 {
+		fmt.Println("The server offers no services")
+		return nil
+	}
+
+	prompt := promptui.Select{
+		Label: "Select a method",
+		Items: items,
+	}
+	i, _, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed: %v\n", err)
+		os.Exit(1)
+	}
+	return &methods[i]
+}
+
+func promptGRPCMessage(method *pkg.GRPCMethod) string {
+	prompt := promptui.Prompt{
+		Label:     fmt.Sprintf("%s message (JSON):", method.InputType),
+		Default:   string(method.InputTemplate),
+		AllowEdit: true,
+	}
+
+	message, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	return message
+}
+
+func promptOutputPath() string {
+	prompt := promptui.Prompt{
+		Label: "Save to file:",
+	}
+
+	path, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	return path
+}
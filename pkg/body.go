@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Request body types
+const (
+	BodyTypeRaw        = "raw"
+	BodyTypeFormData   = "form-data"
+	BodyTypeURLEncoded = "urlencoded"
+)
+
+// FormField is one field of a multipart or urlencoded body. For multipart
+// bodies a field with Content or File set is sent as a file part, with
+// Content or else the file read from disk. Files are only read where the
+// engine allows local access; the web API sends uploaded contents instead.
+type FormField struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	File        string `json:"file,omitempty"`        // path of the file to upload
+	Content     []byte `json:"content,omitempty"`     // contents of the file, base64 in JSON
+	FileName    string `json:"fileName,omitempty"`    // defaults to the base name of File
+	ContentType string `json:"contentType,omitempty"` // defaults to application/octet-stream for files
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// IsFile reports whether the field is a file part
+func (f FormField) IsFile() bool {
+	return f.File != "" || f.Content != nil
+}
+
+// UploadName returns the filename sent for a file part
+func (f FormField) UploadName() string {
+	if f.FileName != "" {
+		return f.FileName
+	}
+	if f.File == "" {
+		return f.Name
+	}
+	return filepath.Base(f.File)
+}
+
+// localPath returns the path generated code reads a file part from, the
+// upload name when the contents were sent inline
+func (f FormField) localPath() string {
+	if f.File != "" {
+		return f.File
+	}
+	return f.UploadName()
+}
+
+// requestBody can be opened any number of times, which lets the transport
+// resend it on redirects and retries
+type requestBody struct {
+	open            func() (io.ReadCloser, error)
+	contentType     string
+	contentLength   int64  // -1 when unknown
+	contentEncoding string // set when the body is compressed
+}
+
+// buildRequestBody prepares the body described by the request, or nil if it
+// has none. Form files are only read with localFiles set.
+func buildRequestBody(request APIRequest, localFiles bool) (*requestBody, error) {
+	switch request.BodyType {
+	case BodyTypeFormData:
+		return multipartBody(enabledFields(request.Form), localFiles)
+	case BodyTypeURLEncoded:
+		encoded := encodeForm(enabledFields(request.Form))
+		return stringBody(encoded, "application/x-www-form-urlencoded"), nil
+	case "", BodyTypeRaw:
+		if request.Body == "" {
+			return nil, nil
+		}
+		return stringBody(request.Body, ""), nil
+	default:
+		return nil, fmt.Errorf("unsupported body type %q", request.BodyType)
+	}
+}
+
+func enabledFields(fields []FormField) []FormField {
+	var enabled []FormField
+	for _, field := range fields {
+		if !field.Disabled {
+			enabled = append(enabled, field)
+		}
+	}
+	return enabled
+}
+
+// encodeForm encodes fields as application/x-www-form-urlencoded, keeping their order
+func encodeForm(fields []FormField) string {
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, url.QueryEscape(field.Name)+"="+url.QueryEscape(field.Value))
+	}
+	return strings.Join(pairs, "&")
+}
+
+func stringBody(content, contentType string) *requestBody {
+	return &requestBody{
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(content)), nil
+		},
+		contentType:   contentType,
+		contentLength: int64(len(content)),
+	}
+}
+
+// multipartBody streams a multipart/form-data body, copying file parts
+// straight from disk instead of buffering them
+func multipartBody(fields []FormField, localFiles bool) (*requestBody, error) {
+	// Check the files up front so a missing file fails before connecting
+	var fileSizes int64
+	for _, field := range fields {
+		if !field.IsFile() {
+			continue
+		}
+		if field.Content != nil {
+			fileSizes += int64(len(field.Content))
+			continue
+		}
+		if !localFiles {
+			return nil, fmt.Errorf("form field %q: files cannot be read here, send the file contents instead", field.Name)
+		}
+		info, err := os.Stat(field.File)
+		if err != nil {
+			return nil, fmt.Errorf("form field %q: %w", field.Name, err)
+		}
+		fileSizes += info.Size()
+	}
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	// Work out the length by writing everything except the file contents
+	counter := &countingWriter{}
+	if err := writeMultipart(counter, boundary, fields, false); err != nil {
+		return nil, err
+	}
+
+	return &requestBody{
+		open: func() (io.ReadCloser, error) {
+			reader, writer := io.Pipe()
+			go func() {
+				writer.CloseWithError(writeMultipart(writer, boundary, fields, true))
+			}()
+			return reader, nil
+		},
+		contentType:   "multipart/form-data; boundary=" + boundary,
+		contentLength: counter.n + fileSizes,
+	}, nil
+}
+
+// writeMultipart writes the multipart body to w. File contents are only
+// copied when withFiles is set.
+func writeMultipart(w io.Writer, boundary string, fields []FormField, withFiles bool) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if !field.IsFile() {
+			if err := mw.WriteField(field.Name, field.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		contentType := field.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(field.Name), escapeQuotes(field.UploadName())))
+		header.Set("Content-Type", contentType)
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if withFiles && field.Content != nil {
+			if _, err := part.Write(field.Content); err != nil {
+				return err
+			}
+		} else if withFiles {
+			if err := copyFile(part, field.File); err != nil {
+				return fmt.Errorf("form field %q: %w", field.Name, err)
+			}
+		}
+	}
+
+	return mw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
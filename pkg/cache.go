@@ -0,0 +1,586 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache modes for RequestOptions.CacheMode, named after those of the fetch API
+const (
+	CacheDefault = "default"  // use fresh stored responses, revalidate stale ones
+	CacheNoCache = "no-cache" // revalidate stored responses before every use
+	CacheReload  = "reload"   // ignore stored responses but store the new one
+	CacheNoStore = "no-store" // leave the cache alone
+)
+
+// Cache statuses reported in APIResponse.CacheStatus
+const (
+	CacheHit         = "hit"         // served from the cache without contacting the server
+	CacheRevalidated = "revalidated" // the server confirmed the stored response with a 304
+	CacheMiss        = "miss"        // the response came from the server
+)
+
+// DefaultCacheEntries is the number of responses a ResponseCache keeps
+const DefaultCacheEntries = 500
+
+// maxHeuristicFreshness caps the freshness guessed from Last-Modified
+const maxHeuristicFreshness = 24 * time.Hour
+
+// heuristicStatusCodes may be cached without explicit freshness, RFC 9110 15.1
+var heuristicStatusCodes = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// notMergedHeaders describe the body, so a 304 does not replace them in the
+// stored response
+var notMergedHeaders = map[string]bool{
+	"Content-Length": true, "Content-Encoding": true, "Transfer-Encoding": true, "Content-Range": true,
+}
+
+// ResponseCache is a private HTTP cache following RFC 9111. Responses to GET
+// requests are stored by URL and the request headers named in Vary, served
+// while fresh and revalidated with If-None-Match or If-Modified-Since once
+// stale. Successful unsafe requests evict the stored responses of their URL.
+// A stored response is only served to requests sent with the same
+// credentials and connection settings, see cacheScope.
+type ResponseCache struct {
+	mutex      sync.Mutex
+	entries    map[string][]*cacheEntry
+	count      int
+	maxEntries int
+}
+
+// cacheEntry is one stored response
+type cacheEntry struct {
+	response     APIResponse
+	scope        string            // cacheScope of the request
+	vary         map[string]string // request header values the response varies on
+	responseTime time.Time         // when the response was received
+	initialAge   time.Duration     // age when received, RFC 9111 4.2.3
+}
+
+// NewResponseCache creates an empty response cache
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{
+		entries:    make(map[string][]*cacheEntry),
+		maxEntries: DefaultCacheEntries,
+	}
+}
+
+// Clear removes every stored response
+func (c *ResponseCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string][]*cacheEntry)
+	c.count = 0
+}
+
+// execute sends request through the cache, calling send when the server has
+// to be contacted
+func (c *ResponseCache) execute(ctx context.Context, request APIRequest, opts RequestOptions, send func(context.Context, APIRequest, RequestOptions) APIResponse) APIResponse {
+	start := time.Now()
+	key := request.FullURL()
+	headers := request.HeaderFields()
+	scope := cacheScope(request, opts)
+
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "GET"
+	}
+	if method != "GET" {
+		response := send(ctx, request, opts)
+		if !isSafeMethod(method) && response.StatusCode >= 200 && response.StatusCode < 400 {
+			c.invalidate(key)
+		}
+		return response
+	}
+
+	// Conditional requests of the caller's own are sent as they are, so
+	// tests see the server's 304 rather than the cache's
+	requestDirectives := parseCacheControl(headers.Values("Cache-Control"))
+	if _, noStore := requestDirectives["no-store"]; noStore || headers.Has("If-None-Match") || headers.Has("If-Modified-Since") {
+		return send(ctx, request, opts)
+	}
+
+	var entry *cacheEntry
+	if opts.CacheMode != CacheReload {
+		entry = c.lookup(key, scope, headers)
+	}
+
+	if entry != nil {
+		_, noCache := requestDirectives["no-cache"]
+		if opts.CacheMode == CacheDefault && !noCache && entry.fresh(start, requestDirectives) {
+			return entry.hit(start)
+		}
+
+		// Ask the server whether the stored response is still good
+		validators := entry.validators()
+		if len(validators) > 0 {
+			request.RawHeaders = append(append(HeaderList{}, request.RawHeaders...), validators...)
+		}
+	}
+
+	requestTime := time.Now()
+	response := send(ctx, request, opts)
+
+	if entry != nil && response.StatusCode == http.StatusNotModified {
+		return c.freshen(key, entry, response, requestTime)
+	}
+
+	response.CacheStatus = CacheMiss
+	c.store(key, scope, headers, response, requestTime)
+	return response
+}
+
+// cacheScopeHeaders are request headers that identify the user
+var cacheScopeHeaders = map[string]bool{
+	"Authorization": true, "Proxy-Authorization": true, "Cookie": true,
+}
+
+// cacheScopeWords mark headers carrying API keys, tokens and the like
+var cacheScopeWords = []string{"auth", "key", "token", "secret", "session", "signature"}
+
+// cacheScope fingerprints what decides who a response was meant for and
+// which server sent it: the credentials of the request, the cookies the jar
+// adds, the environment, and the connection settings. It is empty when
+// there are none.
+func cacheScope(request APIRequest, opts RequestOptions) string {
+	var parts []string
+	for _, field := range request.HeaderFields() {
+		name := http.CanonicalHeaderKey(field.Name)
+		lower := strings.ToLower(name)
+		credential := cacheScopeHeaders[name]
+		for _, word := range cacheScopeWords {
+			credential = credential || strings.Contains(lower, word)
+		}
+		if credential {
+			parts = append(parts, "header "+lower+": "+field.Value)
+		}
+	}
+	sort.Strings(parts)
+
+	if request.Auth != nil && request.Auth.Type != AuthNone {
+		auth, _ := json.Marshal(request.Auth)
+		parts = append(parts, "auth "+string(auth))
+	}
+	if opts.Cookies != nil && !opts.DisableCookies {
+		if u, err := url.Parse(request.FullURL()); err == nil {
+			for _, cookie := range opts.Cookies.Cookies(u) {
+				parts = append(parts, "cookie "+cookie.Name+"="+cookie.Value)
+			}
+		}
+	}
+	if opts.Environment != "" {
+		parts = append(parts, "environment "+opts.Environment)
+	}
+	connection, _ := json.Marshal(transportKey{
+		TLS:        opts.TLS,
+		Proxy:      opts.Proxy,
+		UnixSocket: opts.UnixSocket,
+		Resolve:    opts.Resolve,
+	})
+	parts = append(parts, "connection "+string(connection))
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the stored response for key in scope whose Vary headers match
+func (c *ResponseCache) lookup(key, scope string, headers HeaderList) *cacheEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, entry := range c.entries[key] {
+		if entry.scope == scope && entry.matches(headers) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// store keeps the response when RFC 9111 allows it and it is worth keeping
+func (c *ResponseCache) store(key, scope string, headers HeaderList, response APIResponse, requestTime time.Time) {
+	if !storable(response) {
+		return
+	}
+
+	vary := make(map[string]string)
+	for _, name := range splitHeaderTokens(response.RawHeaders.Values("Vary")) {
+		if name == "*" {
+			return
+		}
+		vary[http.CanonicalHeaderKey(name)] = strings.Join(headers.Values(name), ", ")
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{
+		response:     cloneResponse(response),
+		scope:        scope,
+		vary:         vary,
+		responseTime: now,
+		initialAge:   initialAge(response.RawHeaders, requestTime, now),
+	}
+	if entry.lifetime() <= 0 && len(entry.validators()) == 0 {
+		// Stale at once and impossible to revalidate
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	kept := c.entries[key][:0]
+	for _, existing := range c.entries[key] {
+		if existing.scope == scope && mapsEqual(existing.vary, vary) {
+			c.count--
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	c.entries[key] = append(kept, entry)
+	c.count++
+
+	if c.count > c.maxEntries {
+		c.evictOldest()
+	}
+}
+
+// freshen updates a stored response with the headers of a 304 and returns it,
+// RFC 9111 4.3.4
+func (c *ResponseCache) freshen(key string, entry *cacheEntry, notModified APIResponse, requestTime time.Time) APIResponse {
+	now := time.Now()
+
+	c.mutex.Lock()
+	stored := cloneResponse(entry.response)
+	for _, field := range notModified.RawHeaders {
+		name := http.CanonicalHeaderKey(field.Name)
+		if notMergedHeaders[name] {
+			continue
+		}
+		stored.RawHeaders = removeHeader(stored.RawHeaders, name)
+	}
+	for _, field := range notModified.RawHeaders {
+		if !notMergedHeaders[http.CanonicalHeaderKey(field.Name)] {
+			stored.RawHeaders = append(stored.RawHeaders, field)
+		}
+	}
+	stored.Headers = stored.RawHeaders.Map()
+
+	entry.response = cloneResponse(stored)
+	entry.responseTime = now
+	entry.initialAge = initialAge(notModified.RawHeaders, requestTime, now)
+	c.mutex.Unlock()
+
+	// The body is the stored one, everything about the exchange is the 304's
+	stored.CacheStatus = CacheRevalidated
+	stored.Protocol = notModified.Protocol
+	stored.TLS = notModified.TLS
+	stored.Timing = notModified.Timing
+	stored.ResponseTime = notModified.ResponseTime
+	stored.Redirects = notModified.Redirects
+	stored.Attempts = notModified.Attempts
+	return stored
+}
+
+// invalidate removes the stored responses of key
+func (c *ResponseCache) invalidate(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.count -= len(c.entries[key])
+	delete(c.entries, key)
+}
+
+// evictOldest removes the entry received longest ago. The caller holds the mutex.
+func (c *ResponseCache) evictOldest() {
+	var oldestKey string
+	oldestIndex := -1
+	var oldest time.Time
+	for key, entries := range c.entries {
+		for i, entry := range entries {
+			if oldestIndex < 0 || entry.responseTime.Before(oldest) {
+				oldestKey, oldestIndex, oldest = key, i, entry.responseTime
+			}
+		}
+	}
+	if oldestIndex < 0 {
+		return
+	}
+
+	entries := c.entries[oldestKey]
+	c.entries[oldestKey] = append(entries[:oldestIndex], entries[oldestIndex+1:]...)
+	if len(c.entries[oldestKey]) == 0 {
+		delete(c.entries, oldestKey)
+	}
+	c.count--
+}
+
+// matches reports whether the request headers select this entry
+func (e *cacheEntry) matches(headers HeaderList) bool {
+	for name, value := range e.vary {
+		if strings.Join(headers.Values(name), ", ") != value {
+			return false
+		}
+	}
+	return true
+}
+
+// age is the current age of the entry, RFC 9111 4.2.3
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	return e.initialAge + now.Sub(e.responseTime)
+}
+
+// lifetime is the freshness lifetime of the entry, RFC 9111 4.2.1
+func (e *cacheEntry) lifetime() time.Duration {
+	headers := e.response.RawHeaders
+	directives := parseCacheControl(headers.Values("Cache-Control"))
+	if value, exists := directives["max-age"]; exists {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date := e.responseTime
+	if parsed, err := http.ParseTime(headers.Get("Date")); err == nil {
+		date = parsed
+	}
+
+	if value := headers.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+
+	// Heuristic freshness: a tenth of the time since the last change
+	if lastModified, err := http.ParseTime(headers.Get("Last-Modified")); err == nil && heuristicStatusCodes[e.response.StatusCode] {
+		lifetime := date.Sub(lastModified) / 10
+		if lifetime > maxHeuristicFreshness {
+			lifetime = maxHeuristicFreshness
+		}
+		return lifetime
+	}
+	return 0
+}
+
+// fresh reports whether the entry may be used without revalidation, taking
+// the max-age, min-fresh and max-stale directives of the request into account
+func (e *cacheEntry) fresh(now time.Time, requestDirectives map[string]string) bool {
+	responseDirectives := parseCacheControl(e.response.RawHeaders.Values("Cache-Control"))
+	if _, noCache := responseDirectives["no-cache"]; noCache {
+		return false
+	}
+
+	age := e.age(now)
+	lifetime := e.lifetime()
+
+	if value, exists := requestDirectives["max-age"]; exists {
+		if seconds, err := strconv.Atoi(value); err == nil && age > time.Duration(seconds)*time.Second {
+			return false
+		}
+	}
+	if value, exists := requestDirectives["min-fresh"]; exists {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			age += time.Duration(seconds) * time.Second
+		}
+	}
+	if age < lifetime {
+		return true
+	}
+
+	// max-stale accepts stale responses, unless the server forbids it
+	value, maxStale := requestDirectives["max-stale"]
+	if !maxStale {
+		return false
+	}
+	if _, mustRevalidate := responseDirectives["must-revalidate"]; mustRevalidate {
+		return false
+	}
+	if value == "" {
+		return true
+	}
+	seconds, err := strconv.Atoi(value)
+	return err == nil && age-lifetime < time.Duration(seconds)*time.Second
+}
+
+// hit returns the stored response as served from the cache
+func (e *cacheEntry) hit(start time.Time) APIResponse {
+	response := cloneResponse(e.response)
+	response.RawHeaders = append(removeHeader(response.RawHeaders, "Age"), HeaderField{
+		Name:  "Age",
+		Value: strconv.FormatInt(int64(e.age(start)/time.Second), 10),
+	})
+	response.Headers = response.RawHeaders.Map()
+	response.CacheStatus = CacheHit
+	response.Timing = nil
+	response.Redirects = nil
+	response.Attempts = nil
+	response.ResponseTime = time.Since(start)
+	return response
+}
+
+// validators returns the conditional headers that revalidate the entry
+func (e *cacheEntry) validators() HeaderList {
+	var validators HeaderList
+	if etag := e.response.RawHeaders.Get("ETag"); etag != "" {
+		validators = append(validators, HeaderField{Name: "If-None-Match", Value: etag})
+	}
+	if lastModified := e.response.RawHeaders.Get("Last-Modified"); lastModified != "" {
+		validators = append(validators, HeaderField{Name: "If-Modified-Since", Value: lastModified})
+	}
+	return validators
+}
+
+// storable reports whether a response to a GET request may be stored
+func storable(response APIResponse) bool {
+	if response.Error != "" || response.StatusCode == 0 || response.StatusCode == http.StatusPartialContent {
+		return false
+	}
+	// Only complete in-memory bodies of the requested URL are kept
+	if response.BodyTruncated || response.BodyFile != "" || len(response.Redirects) > 0 {
+		return false
+	}
+
+	directives := parseCacheControl(response.RawHeaders.Values("Cache-Control"))
+	if _, noStore := directives["no-store"]; noStore {
+		return false
+	}
+	if heuristicStatusCodes[response.StatusCode] {
+		return true
+	}
+	_, maxAge := directives["max-age"]
+	_, public := directives["public"]
+	return maxAge || public || response.RawHeaders.Has("Expires")
+}
+
+// initialAge is the corrected initial age of a response, RFC 9111 4.2.3
+func initialAge(headers HeaderList, requestTime, responseTime time.Time) time.Duration {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(headers.Get("Date")); err == nil && responseTime.After(date) {
+		apparentAge = responseTime.Sub(date)
+	}
+
+	correctedAge := responseTime.Sub(requestTime)
+	if seconds, err := strconv.Atoi(strings.TrimSpace(headers.Get("Age"))); err == nil && seconds > 0 {
+		correctedAge += time.Duration(seconds) * time.Second
+	}
+
+	if apparentAge > correctedAge {
+		return apparentAge
+	}
+	return correctedAge
+}
+
+// parseCacheControl parses Cache-Control field values into lower case
+// directive names and their unquoted arguments
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range splitHeaderTokens(values) {
+		name, value, _ := strings.Cut(directive, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		directives[name] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+// splitHeaderTokens splits comma separated field values into trimmed items
+func splitHeaderTokens(values []string) []string {
+	var tokens []string
+	for _, value := range values {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// removeHeader returns the list without the fields named name
+func removeHeader(headers HeaderList, name string) HeaderList {
+	kept := make(HeaderList, 0, len(headers))
+	for _, field := range headers {
+		if !strings.EqualFold(field.Name, name) {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// cloneResponse copies the header collections so a stored response is not
+// changed through a response handed out
+func cloneResponse(response APIResponse) APIResponse {
+	response.RawHeaders = append(HeaderList{}, response.RawHeaders...)
+	response.Headers = response.RawHeaders.Map()
+	return response
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	default:
+		return false
+	}
+}
+
+func mapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, exists := b[key]; !exists || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// CacheStore keeps one response cache per user and workspace
+type CacheStore struct {
+	mutex  sync.Mutex
+	caches map[cacheOwner]*ResponseCache
+}
+
+type cacheOwner struct {
+	userID      uint
+	workspaceID uint
+}
+
+// NewCacheStore creates a new cache store
+func NewCacheStore() *CacheStore {
+	return &CacheStore{
+		caches: make(map[cacheOwner]*ResponseCache),
+	}
+}
+
+// Cache returns the response cache of a user in a workspace
+func (s *CacheStore) Cache(userID, workspaceID uint) *ResponseCache {
+	owner := cacheOwner{userID: userID, workspaceID: workspaceID}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cache, exists := s.caches[owner]
+	if !exists {
+		cache = NewResponseCache()
+		s.caches[owner] = cache
+	}
+	return cache
+}
@@ -0,0 +1,165 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// cacheSend is one request of a cache test and what it should get
+type cacheSend struct {
+	method     string
+	headers    map[string]string
+	wantStatus int
+	wantCache  string // CacheStatus
+}
+
+func TestResponseCacheThroughEngine(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	conditional := map[string]int{} // requests that carried If-None-Match
+	mux := http.NewServeMux()
+	handle := func(path, cacheControl string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			requests[path]++
+			if r.Header.Get("If-None-Match") != "" {
+				conditional[path]++
+			}
+			mutex.Unlock()
+
+			w.Header().Set("Cache-Control", cacheControl)
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte("body of " + path))
+		})
+	}
+	handle("/fresh", "max-age=60")
+	handle("/stale", "max-age=0")
+	handle("/no-store", "no-store")
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := cacheSend{method: "GET", wantStatus: http.StatusOK}
+	with := func(send cacheSend, cache string) cacheSend {
+		send.wantCache = cache
+		return send
+	}
+	tests := []struct {
+		name            string
+		path            string
+		mode            string
+		sends           []cacheSend
+		wantRequests    int
+		wantConditional int
+	}{
+		{
+			name:         "fresh response served from the cache",
+			path:         "/fresh",
+			mode:         CacheDefault,
+			sends:        []cacheSend{with(get, CacheMiss), with(get, CacheHit), with(get, CacheHit)},
+			wantRequests: 1,
+		},
+		{
+			name:            "stale response revalidated",
+			path:            "/stale",
+			mode:            CacheDefault,
+			sends:           []cacheSend{with(get, CacheMiss), with(get, CacheRevalidated)},
+			wantRequests:    2,
+			wantConditional: 1,
+		},
+		{
+			name:            "no-cache revalidates fresh responses",
+			path:            "/fresh",
+			mode:            CacheNoCache,
+			sends:           []cacheSend{with(get, CacheMiss), with(get, CacheRevalidated)},
+			wantRequests:    2,
+			wantConditional: 1,
+		},
+		{
+			name:         "reload",
+			path:         "/fresh",
+			mode:         CacheReload,
+			sends:        []cacheSend{with(get, CacheMiss), with(get, CacheMiss)},
+			wantRequests: 2,
+		},
+		{
+			name:         "no-store mode",
+			path:         "/fresh",
+			mode:         CacheNoStore,
+			sends:        []cacheSend{get, get},
+			wantRequests: 2,
+		},
+		{
+			name:         "no cache mode",
+			path:         "/fresh",
+			sends:        []cacheSend{get, get},
+			wantRequests: 2,
+		},
+		{
+			name:         "response not to be stored",
+			path:         "/no-store",
+			mode:         CacheDefault,
+			sends:        []cacheSend{with(get, CacheMiss), with(get, CacheMiss)},
+			wantRequests: 2,
+		},
+		{
+			name: "caller's own conditional request",
+			path: "/fresh",
+			mode: CacheDefault,
+			sends: []cacheSend{
+				with(get, CacheMiss),
+				{method: "GET", headers: map[string]string{"If-None-Match": `"v1"`}, wantStatus: http.StatusNotModified},
+			},
+			wantRequests:    2,
+			wantConditional: 1,
+		},
+		{
+			name: "unsafe method invalidates",
+			path: "/fresh",
+			mode: CacheDefault,
+			sends: []cacheSend{
+				with(get, CacheMiss),
+				{method: "POST", wantStatus: http.StatusOK},
+				with(get, CacheMiss),
+			},
+			wantRequests: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutex.Lock()
+			requests[test.path], conditional[test.path] = 0, 0
+			mutex.Unlock()
+			engine := NewRequestEngine()
+
+			for i, send := range test.sends {
+				response := engine.Execute(context.Background(), APIRequest{
+					Method:  send.method,
+					URL:     server.URL + test.path,
+					Headers: send.headers,
+					Options: RequestOptions{CacheMode: test.mode},
+				})
+				if response.StatusCode != send.wantStatus || response.CacheStatus != send.wantCache {
+					t.Fatalf("request %d: status %d and cache %q, want %d and %q, error %q",
+						i+1, response.StatusCode, response.CacheStatus, send.wantStatus, send.wantCache, response.Error)
+				}
+				if send.wantStatus == http.StatusOK && response.Body != "body of "+test.path {
+					t.Fatalf("request %d: body %q", i+1, response.Body)
+				}
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if requests[test.path] != test.wantRequests || conditional[test.path] != test.wantConditional {
+				t.Fatalf("server got %d requests, %d conditional, want %d and %d",
+					requests[test.path], conditional[test.path], test.wantRequests, test.wantConditional)
+			}
+		})
+	}
+}
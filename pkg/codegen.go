@@ -1,20 +1,71 @@
 package pkg
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // CodeGenerator generates code snippets for various programming languages
-type CodeGenerator struct{}
+type CodeGenerator struct {
+	schemas *GraphQLSchemaCache // checks GraphQL operations when their schema is known
+}
 
 // NewCodeGenerator creates a new code generator
 func NewCodeGenerator() *CodeGenerator {
-	return &CodeGenerator{}
+	return &CodeGenerator{schemas: defaultEngine.GraphQLSchemas()}
 }
 
 // GenerateCode generates code for a given request in the specified language
 func (cg *CodeGenerator) GenerateCode(request APIRequest, language string) string {
+	// Auth becomes the header or query param it sends. An OAuth2 token is
+	// fetched when the request is sent, the code reads it from its variable.
+	if request.Auth != nil && request.Auth.Type == AuthOAuth2 && request.Auth.OAuth2 != nil {
+		config := request.Auth.OAuth2
+		request.Auth = &RequestAuth{Type: AuthBearer, Bearer: &BearerAuth{Token: "{{" + config.variable() + "}}", Prefix: config.prefix()}}
+	}
+	if authorized, err := applyAuth(request); err == nil {
+		request = authorized
+	}
+	if request.GRPC != nil {
+		// Calling gRPC from code needs generated stubs, every language gets grpcurl
+		return cg.generateGRPCurl(request)
+	}
+	// JSON-RPC calls and SOAP envelopes are plain requests once built
+	if request.JSONRPC != nil {
+		if expanded, _, err := expandJSONRPC(request); err == nil {
+			request = expanded
+		}
+	}
+	if request.SOAP != nil {
+		if expanded, err := expandSOAP(request, request.SOAP.operation()); err == nil {
+			request = expanded
+		}
+	}
+	var header string
+	if codegenAWS(request) != nil {
+		request, header = cg.prepareAWS(request, language)
+	}
+	if request.Auth != nil && request.Auth.Type == AuthDigest && request.Auth.Digest != nil {
+		header = cg.prepareDigest(request.Auth.Digest, language)
+	}
+	if request.Auth != nil && request.Auth.Type == AuthHMAC && request.Auth.HMAC != nil {
+		header = cg.prepareHMAC(request.Auth.HMAC, language)
+	}
+	if request.GraphQL != nil {
+		var graphQLHeader string
+		request, graphQLHeader = cg.prepareGraphQL(request, language)
+		header += graphQLHeader
+	}
+	return header + cg.generate(request, language)
+}
+
+func (cg *CodeGenerator) generate(request APIRequest, language string) string {
 	switch strings.ToLower(language) {
 	case "curl":
 		return cg.generateCurl(request)
@@ -35,38 +86,167 @@ func (cg *CodeGenerator) generateCurl(request APIRequest) string {
 	var parts []string
 	
 	// Basic curl command
-	parts = append(parts, fmt.Sprintf(`curl -X %s "%s"`, request.Method, request.URL))
+	target, socket := codegenTarget(request)
+	parts = append(parts, fmt.Sprintf(`curl -X %s "%s"`, request.Method, target))
+	
+	// Protocol and connection target
+	switch request.Options.Protocol {
+	case ProtocolHTTP1:
+		parts = append(parts, "  --http1.1")
+	case ProtocolHTTP2:
+		parts = append(parts, "  --http2")
+	case ProtocolH2C:
+		parts = append(parts, "  --http2-prior-knowledge")
+	}
+	if socket != "" {
+		parts = append(parts, fmt.Sprintf(`  --unix-socket "%s"`, socket))
+	} else {
+		parts = append(parts, curlResolveFlags(request.Options.Resolve, target)...)
+	}
+	if aws := codegenAWS(request); aws != nil {
+		parts = append(parts, awsCurlFlags(aws)...)
+	}
+	if digest := codegenDigest(request); digest != nil {
+		parts = append(parts, "  --digest", fmt.Sprintf(`  --user "%s:%s"`, shellEscape(digest.Username), shellEscape(digest.Password)))
+	}
 	
 	// Headers
-	for key, value := range request.Headers {
-		parts = append(parts, fmt.Sprintf(`  -H "%s: %s"`, key, value))
+	for _, field := range codegenHeaders(request) {
+		parts = append(parts, fmt.Sprintf(`  -H "%s: %s"`, field.Name, shellEscape(field.Value)))
 	}
 	
-	// Body for POST/PUT/PATCH
-	if request.Body != "" && (request.Method == "POST" || request.Method == "PUT" || request.Method == "PATCH") {
-		parts = append(parts, fmt.Sprintf(`  -d '%s'`, request.Body))
+	if request.GraphQL != nil {
+		payload := graphQLCodegenPayload(request.GraphQL)
+		parts = append(parts, fmt.Sprintf(`  --data-raw '%s'`, strings.ReplaceAll(payload, "'", `'\''`)))
+		return strings.Join(parts, " \\\n")
+	}
+	
+	switch request.BodyType {
+	case BodyTypeFormData:
+		for _, field := range enabledFields(request.Form) {
+			if field.IsFile() {
+				part := fmt.Sprintf("%s=@%s;filename=%s", field.Name, field.localPath(), field.UploadName())
+				if field.ContentType != "" {
+					part += ";type=" + field.ContentType
+				}
+				parts = append(parts, fmt.Sprintf(`  -F "%s"`, part))
+			} else {
+				parts = append(parts, fmt.Sprintf(`  --form-string "%s=%s"`, field.Name, field.Value))
+			}
+		}
+	case BodyTypeURLEncoded:
+		for _, field := range enabledFields(request.Form) {
+			parts = append(parts, fmt.Sprintf(`  --data-urlencode "%s=%s"`, field.Name, field.Value))
+		}
+	default:
+		// Body for POST/PUT/PATCH
+		if request.Body != "" && (request.Method == "POST" || request.Method == "PUT" || request.Method == "PATCH") {
+			parts = append(parts, fmt.Sprintf(`  -d '%s'`, request.Body))
+		}
 	}
 	
 	return strings.Join(parts, " \\\n")
 }
 
+// generateGRPCurl generates a grpcurl command for a gRPC call
+func (cg *CodeGenerator) generateGRPCurl(request APIRequest) string {
+	address, secure, socket, err := grpcTarget(request.URL)
+	if err != nil {
+		return "# " + err.Error()
+	}
+
+	parts := []string{"grpcurl"}
+	if !secure {
+		parts = append(parts, "  -plaintext")
+	}
+	if socket != "" {
+		parts = append(parts, "  -unix")
+		address = socket
+	}
+	for _, path := range request.GRPC.ImportPaths {
+		parts = append(parts, fmt.Sprintf(`  -import-path "%s"`, path))
+	}
+	for _, file := range request.GRPC.ProtoFiles {
+		parts = append(parts, fmt.Sprintf(`  -proto "%s"`, file))
+	}
+	for _, field := range request.HeaderFields() {
+		parts = append(parts, fmt.Sprintf(`  -H "%s: %s"`, field.Name, shellEscape(field.Value)))
+	}
+
+	// Streamed messages follow each other in the data
+	data := request.Body
+	if len(request.GRPC.Messages) > 0 {
+		messages := make([]string, len(request.GRPC.Messages))
+		for i, message := range request.GRPC.Messages {
+			messages[i] = string(message)
+		}
+		data = strings.Join(messages, "\n")
+	}
+	if data != "" {
+		parts = append(parts, fmt.Sprintf(`  -d '%s'`, strings.ReplaceAll(data, "'", `'\''`)))
+	}
+
+	parts = append(parts, "  "+address, "  "+strings.TrimPrefix(request.GRPC.Method, "/"))
+	return strings.Join(parts, " \\\n")
+}
+
 func (cg *CodeGenerator) generateJavaScript(request APIRequest) string {
 	var code strings.Builder
 	
-	code.WriteString("const response = await fetch(")
-	code.WriteString(fmt.Sprintf(`"%s", {\n`, request.URL))
-	code.WriteString(fmt.Sprintf(`  method: "%s",\n`, request.Method))
+	aws := codegenAWS(request)
+	if aws != nil {
+		code.WriteString(awsJSPrelude(aws))
+	}
 	
-	if len(request.Headers) > 0 {
+	switch request.BodyType {
+	case BodyTypeFormData:
+		code.WriteString("const formData = new FormData();\n")
+		for _, field := range enabledFields(request.Form) {
+			if field.IsFile() {
+				code.WriteString(fmt.Sprintf("// Choose %s in a file input\n", field.localPath()))
+				code.WriteString(fmt.Sprintf("formData.append(%q, fileInput.files[0], %q);\n", field.Name, field.UploadName()))
+			} else {
+				code.WriteString(fmt.Sprintf("formData.append(%q, %q);\n", field.Name, field.Value))
+			}
+		}
+		code.WriteString("\n")
+	case BodyTypeURLEncoded:
+		code.WriteString("const formData = new URLSearchParams();\n")
+		for _, field := range enabledFields(request.Form) {
+			code.WriteString(fmt.Sprintf("formData.append(%q, %q);\n", field.Name, field.Value))
+		}
+		code.WriteString("\n")
+	}
+	
+	if request.GraphQL != nil {
+		code.WriteString(graphQLJSPrelude(request.GraphQL))
+	}
+	
+	// aws4fetch signs the request and sends it with fetch
+	if aws != nil {
+		code.WriteString("const response = await aws.fetch(")
+	} else {
+		code.WriteString("const response = await fetch(")
+	}
+	code.WriteString(fmt.Sprintf(`"%s", {` + "\n", request.FullURL()))
+	code.WriteString(fmt.Sprintf(`  method: "%s",` + "\n", request.Method))
+	
+	// fetch joins repeated headers with a comma, so emit them that way
+	names, values := groupHeaders(codegenHeaders(request))
+	if len(names) > 0 {
 		code.WriteString("  headers: {\n")
-		for key, value := range request.Headers {
-			code.WriteString(fmt.Sprintf(`    "%s": "%s",\n`, key, value))
+		for _, name := range names {
+			code.WriteString(fmt.Sprintf("    %q: %q,\n", name, joinHeaderValues(name, values[name])))
 		}
 		code.WriteString("  },\n")
 	}
 	
-	if request.Body != "" {
-		code.WriteString(fmt.Sprintf(`  body: %s,\n`, formatJSBody(request.Body)))
+	if request.GraphQL != nil {
+		code.WriteString(fmt.Sprintf("  body: JSON.stringify(%s),\n", graphQLJSBody(request.GraphQL)))
+	} else if isFormBody(request) {
+		code.WriteString("  body: formData,\n")
+	} else if request.Body != "" {
+		code.WriteString(fmt.Sprintf(`  body: %s,` + "\n", formatJSBody(request.Body)))
 	}
 	
 	code.WriteString("});\n\n")
@@ -79,31 +259,85 @@ func (cg *CodeGenerator) generateJavaScript(request APIRequest) string {
 func (cg *CodeGenerator) generatePython(request APIRequest) string {
 	var code strings.Builder
 	
-	code.WriteString("import requests\n\n")
-	code.WriteString(fmt.Sprintf(`url = "%s"\n`, request.URL))
+	aws := codegenAWS(request)
+	digest := codegenDigest(request)
+	if aws != nil {
+		code.WriteString(awsPythonPrelude(aws))
+	} else if digest != nil {
+		code.WriteString("import requests\n")
+		code.WriteString("from requests.auth import HTTPDigestAuth\n\n")
+		code.WriteString(fmt.Sprintf("auth = HTTPDigestAuth(%q, %q)\n", digest.Username, digest.Password))
+	} else {
+		code.WriteString("import requests\n\n")
+	}
+	code.WriteString(fmt.Sprintf(`url = "%s"` + "\n", request.FullURL()))
 	
-	if len(request.Headers) > 0 {
+	// requests takes a dict, so repeated headers are joined into one value
+	names, values := groupHeaders(codegenHeaders(request))
+	if len(names) > 0 {
 		code.WriteString("headers = {\n")
-		for key, value := range request.Headers {
-			code.WriteString(fmt.Sprintf(`    "%s": "%s",\n`, key, value))
+		for _, name := range names {
+			code.WriteString(fmt.Sprintf("    %q: %q,\n", name, joinHeaderValues(name, values[name])))
 		}
 		code.WriteString("}\n\n")
 	}
 	
-	if request.Body != "" {
-		code.WriteString(fmt.Sprintf(`data = %s\n\n`, formatPythonBody(request.Body)))
+	hasFiles := false
+	if request.GraphQL != nil {
+		code.WriteString(graphQLPythonPrelude(request.GraphQL))
+	} else if isFormBody(request) {
+		// Lists of tuples keep the field order and allow repeated names
+		code.WriteString("data = [\n")
+		for _, field := range enabledFields(request.Form) {
+			if !field.IsFile() {
+				code.WriteString(fmt.Sprintf("    (%q, %q),\n", field.Name, field.Value))
+			}
+		}
+		code.WriteString("]\n")
+		if request.BodyType == BodyTypeFormData {
+			code.WriteString("files = [\n")
+			for _, field := range enabledFields(request.Form) {
+				if field.IsFile() {
+					hasFiles = true
+					contentType := field.ContentType
+					if contentType == "" {
+						contentType = "application/octet-stream"
+					}
+					code.WriteString(fmt.Sprintf("    (%q, (%q, open(%q, \"rb\"), %q)),\n",
+						field.Name, field.UploadName(), field.localPath(), contentType))
+				}
+			}
+			code.WriteString("]\n")
+		}
+		code.WriteString("\n")
+	} else if request.Body != "" {
+		code.WriteString(fmt.Sprintf(`data = %s` + "\n\n", formatPythonBody(request.Body)))
 	}
 	
 	// Generate request
 	args := []string{`url`}
-	if len(request.Headers) > 0 {
+	if len(names) > 0 {
 		args = append(args, "headers=headers")
 	}
-	if request.Body != "" {
+	if request.GraphQL != nil {
 		args = append(args, "json=data")
+	} else if isFormBody(request) {
+		args = append(args, "data=data")
+		if hasFiles {
+			args = append(args, "files=files")
+		}
+	} else if request.Body != "" {
+		if body := strings.TrimSpace(request.Body); strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[") {
+			args = append(args, "json=data")
+		} else {
+			args = append(args, "data=data")
+		}
+	}
+	if aws != nil || digest != nil {
+		args = append(args, "auth=auth")
 	}
 	
-	code.WriteString(fmt.Sprintf(`response = requests.%s(%s)\n`, 
+	code.WriteString(fmt.Sprintf(`response = requests.%s(%s)` + "\n", 
 		strings.ToLower(request.Method), strings.Join(args, ", ")))
 	code.WriteString("print(response.json())")
 	
@@ -113,27 +347,92 @@ func (cg *CodeGenerator) generatePython(request APIRequest) string {
 func (cg *CodeGenerator) generateGo(request APIRequest) string {
 	var code strings.Builder
 	
+	imports := []string{"fmt", "io/ioutil", "net/http"}
+	var body strings.Builder
+	
+	switch {
+	case request.GraphQL != nil:
+		imports = append(imports, "bytes", "encoding/json")
+		body.WriteString(graphQLGoPayload(request.GraphQL))
+		body.WriteString(`    req, _ := http.NewRequest("` + request.Method + `", url, bytes.NewBuffer(payload))` + "\n")
+	case request.BodyType == BodyTypeFormData:
+		imports = append(imports, "bytes", "mime/multipart")
+		body.WriteString("    payload := &bytes.Buffer{}\n")
+		body.WriteString("    writer := multipart.NewWriter(payload)\n")
+		for _, field := range enabledFields(request.Form) {
+			if !field.IsFile() {
+				body.WriteString(fmt.Sprintf("    writer.WriteField(%q, %q)\n", field.Name, field.Value))
+				continue
+			}
+			// Each file part gets its own block so the variable names can repeat
+			body.WriteString("    {\n")
+			if field.ContentType != "" {
+				imports = appendOnce(imports, "net/textproto")
+				body.WriteString("        partHeader := make(textproto.MIMEHeader)\n")
+				body.WriteString(fmt.Sprintf("        partHeader.Set(\"Content-Disposition\", %q)\n",
+					fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field.Name, field.UploadName())))
+				body.WriteString(fmt.Sprintf("        partHeader.Set(\"Content-Type\", %q)\n", field.ContentType))
+				body.WriteString("        part, _ := writer.CreatePart(partHeader)\n")
+			} else {
+				body.WriteString(fmt.Sprintf("        part, _ := writer.CreateFormFile(%q, %q)\n", field.Name, field.UploadName()))
+			}
+			imports = appendOnce(imports, "io")
+			imports = appendOnce(imports, "os")
+			body.WriteString(fmt.Sprintf("        file, _ := os.Open(%q)\n", field.localPath()))
+			body.WriteString("        io.Copy(part, file)\n")
+			body.WriteString("        file.Close()\n")
+			body.WriteString("    }\n")
+		}
+		body.WriteString("    writer.Close()\n")
+		body.WriteString(`    req, _ := http.NewRequest("` + request.Method + `", url, payload)` + "\n")
+		body.WriteString(`    req.Header.Set("Content-Type", writer.FormDataContentType())` + "\n")
+	case request.BodyType == BodyTypeURLEncoded:
+		imports = append(imports, "net/url", "strings")
+		body.WriteString("    form := url.Values{}\n")
+		for _, field := range enabledFields(request.Form) {
+			body.WriteString(fmt.Sprintf("    form.Add(%q, %q)\n", field.Name, field.Value))
+		}
+		body.WriteString(`    req, _ := http.NewRequest("` + request.Method + `", endpoint, strings.NewReader(form.Encode()))` + "\n")
+		body.WriteString(`    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")` + "\n")
+	case request.Body != "":
+		imports = append(imports, "bytes")
+		body.WriteString(fmt.Sprintf(`    jsonData := []byte(%s)` + "\n", formatGoBody(request.Body)))
+		body.WriteString(`    req, _ := http.NewRequest("` + request.Method + `", url, bytes.NewBuffer(jsonData))` + "\n")
+	default:
+		body.WriteString(`    req, _ := http.NewRequest("` + request.Method + `", url, nil)` + "\n")
+	}
+	aws := codegenAWS(request)
+	var signing string
+	if aws != nil {
+		var awsImports []string
+		signing, awsImports = awsGoSigning(aws)
+		for _, imp := range awsImports {
+			imports = appendOnce(imports, imp)
+		}
+	}
+	sort.Strings(imports)
+	
 	code.WriteString("package main\n\n")
 	code.WriteString("import (\n")
-	code.WriteString(`    "bytes"` + "\n")
-	code.WriteString(`    "fmt"` + "\n")
-	code.WriteString(`    "io/ioutil"` + "\n")
-	code.WriteString(`    "net/http"` + "\n")
+	for _, imp := range imports {
+		code.WriteString(fmt.Sprintf(`    "%s"` + "\n", imp))
+	}
 	code.WriteString(")\n\n")
 	
 	code.WriteString("func main() {\n")
-	code.WriteString(fmt.Sprintf(`    url := "%s"` + "\n", request.URL))
-	
-	if request.Body != "" {
-		code.WriteString(fmt.Sprintf(`    jsonData := []byte(%s)` + "\n", formatGoBody(request.Body)))
-		code.WriteString(`    req, _ := http.NewRequest("` + request.Method + `", url, bytes.NewBuffer(jsonData))` + "\n")
+	// url.Values needs the net/url package name, so the URL variable is renamed
+	if request.BodyType == BodyTypeURLEncoded {
+		code.WriteString(fmt.Sprintf(`    endpoint := "%s"` + "\n", request.FullURL()))
 	} else {
-		code.WriteString(`    req, _ := http.NewRequest("` + request.Method + `", url, nil)` + "\n")
+		code.WriteString(fmt.Sprintf(`    url := "%s"` + "\n", request.FullURL()))
 	}
+	code.WriteString(body.String())
+	
 	
-	for key, value := range request.Headers {
-		code.WriteString(fmt.Sprintf(`    req.Header.Set("%s", "%s")` + "\n", key, value))
+	for _, field := range codegenHeaders(request) {
+		code.WriteString(fmt.Sprintf("    req.Header.Add(%q, %q)\n", field.Name, field.Value))
 	}
+	code.WriteString(signing)
 	
 	code.WriteString("\n    client := &http.Client{}\n")
 	code.WriteString("    resp, err := client.Do(req)\n")
@@ -151,21 +450,73 @@ func (cg *CodeGenerator) generateGo(request APIRequest) string {
 func (cg *CodeGenerator) generateNodeJS(request APIRequest) string {
 	var code strings.Builder
 	
-	code.WriteString("const https = require('https');\n\n")
+	code.WriteString("const https = require('https');\n")
+	aws := codegenAWS(request)
+	if aws != nil {
+		code.WriteString("const aws4 = require('aws4');\n")
+	}
+	if request.GraphQL != nil {
+		code.WriteString("\n" + strings.TrimSuffix(graphQLJSPrelude(request.GraphQL), "\n"))
+	}
+	switch request.BodyType {
+	case BodyTypeFormData:
+		code.WriteString("const fs = require('fs');\n")
+		code.WriteString("const FormData = require('form-data');\n\n")
+		code.WriteString("const form = new FormData();\n")
+		for _, field := range enabledFields(request.Form) {
+			if field.IsFile() {
+				fileOptions := fmt.Sprintf("filename: %s", jsString(field.UploadName()))
+				if field.ContentType != "" {
+					fileOptions += fmt.Sprintf(", contentType: %s", jsString(field.ContentType))
+				}
+				code.WriteString(fmt.Sprintf("form.append(%s, fs.createReadStream(%s), { %s });\n",
+					jsString(field.Name), jsString(field.localPath()), fileOptions))
+			} else {
+				code.WriteString(fmt.Sprintf("form.append(%s, %s);\n", jsString(field.Name), jsString(field.Value)))
+			}
+		}
+	case BodyTypeURLEncoded:
+		code.WriteString("\nconst body = new URLSearchParams([\n")
+		for _, field := range enabledFields(request.Form) {
+			code.WriteString(fmt.Sprintf("  [%s, %s],\n", jsString(field.Name), jsString(field.Value)))
+		}
+		code.WriteString("]).toString();\n")
+	}
+	code.WriteString("\n")
 	code.WriteString("const options = {\n")
-	code.WriteString(fmt.Sprintf(`  hostname: '%s',\n`, extractHostname(request.URL)))
-	code.WriteString(fmt.Sprintf(`  path: '%s',\n`, extractPath(request.URL)))
-	code.WriteString(fmt.Sprintf(`  method: '%s',\n`, request.Method))
+	code.WriteString(fmt.Sprintf(`  hostname: '%s',` + "\n", extractHostname(request.FullURL())))
+	code.WriteString(fmt.Sprintf(`  path: '%s',` + "\n", extractPath(request.FullURL())))
+	code.WriteString(fmt.Sprintf(`  method: '%s',` + "\n", request.Method))
 	
-	if len(request.Headers) > 0 {
+	// Node accepts an array of values for headers that repeat
+	names, values := groupHeaders(codegenHeaders(request))
+	if request.BodyType == BodyTypeURLEncoded && !codegenHeaders(request).Has("Content-Type") {
+		names = append(names, "Content-Type")
+		values["Content-Type"] = []string{"application/x-www-form-urlencoded"}
+	}
+	if len(names) > 0 || request.BodyType == BodyTypeFormData {
 		code.WriteString("  headers: {\n")
-		for key, value := range request.Headers {
-			code.WriteString(fmt.Sprintf(`    '%s': '%s',\n`, key, value))
+		if request.BodyType == BodyTypeFormData {
+			code.WriteString("    ...form.getHeaders(),\n")
+		}
+		for _, name := range names {
+			if len(values[name]) > 1 {
+				quoted := make([]string, len(values[name]))
+				for i, value := range values[name] {
+					quoted[i] = jsString(value)
+				}
+				code.WriteString(fmt.Sprintf(`    '%s': [%s],` + "\n", name, strings.Join(quoted, ", ")))
+			} else {
+				code.WriteString(fmt.Sprintf(`    '%s': %s,` + "\n", name, jsString(values[name][0])))
+			}
 		}
 		code.WriteString("  }\n")
 	}
 	
 	code.WriteString("};\n\n")
+	if aws != nil {
+		code.WriteString(awsNodeSigning(aws, request))
+	}
 	
 	code.WriteString("const req = https.request(options, (res) => {\n")
 	code.WriteString("  let data = '';\n")
@@ -173,8 +524,17 @@ func (cg *CodeGenerator) generateNodeJS(request APIRequest) string {
 	code.WriteString("  res.on('end', () => { console.log(data); });\n")
 	code.WriteString("});\n\n")
 	
-	if request.Body != "" {
-		code.WriteString(fmt.Sprintf(`req.write(%s);\n`, formatJSBody(request.Body)))
+	switch {
+	case request.GraphQL != nil:
+		code.WriteString(fmt.Sprintf("req.write(JSON.stringify(%s));\n", graphQLJSBody(request.GraphQL)))
+	case request.BodyType == BodyTypeFormData:
+		// form-data ends the request once the last part is written
+		code.WriteString("form.pipe(req);")
+		return code.String()
+	case request.BodyType == BodyTypeURLEncoded:
+		code.WriteString("req.write(body);\n")
+	case request.Body != "":
+		code.WriteString(fmt.Sprintf(`req.write(%s);` + "\n", formatJSBody(request.Body)))
 	}
 	
 	code.WriteString("req.end();")
@@ -182,20 +542,268 @@ func (cg *CodeGenerator) generateNodeJS(request APIRequest) string {
 	return code.String()
 }
 
+// prepareGraphQL readies a GraphQL request for the generators and returns a
+// comment describing the operation. An operation sent with GET becomes a
+// plain request with the operation in the query string. When the schema of
+// the endpoint has been fetched the operation is checked against it and any
+// problems are listed in the comment.
+func (cg *CodeGenerator) prepareGraphQL(request APIRequest, language string) (APIRequest, string) {
+	comment := codegenComment(language)
+
+	var header strings.Builder
+	if operation := graphQLOperation(request.GraphQL.Query, request.GraphQL.OperationName); operation != nil {
+		header.WriteString(fmt.Sprintf("%s GraphQL %s", comment, operation.kind))
+		if operation.name != "" {
+			header.WriteString(" " + operation.name)
+		}
+		if len(operation.variables) > 0 {
+			var variables []string
+			for _, definition := range operation.variables {
+				variables = append(variables, fmt.Sprintf("$%s: %s", definition.name, definition.typ))
+			}
+			header.WriteString("(" + strings.Join(variables, ", ") + ")")
+		}
+		header.WriteString("\n")
+	}
+	if cg.schemas != nil {
+		if schema := cg.schemas.Get(request.URL); schema != nil {
+			errs := schema.Validate(request.GraphQL.Query, request.GraphQL.OperationName, request.GraphQL.Variables)
+			if len(errs) == 0 {
+				header.WriteString(fmt.Sprintf("%s Valid against the schema fetched %s\n", comment, schema.FetchedAt.Format("2006-01-02 15:04")))
+			}
+			for _, err := range errs {
+				header.WriteString(fmt.Sprintf("%s Warning: %s\n", comment, err.Error()))
+			}
+		}
+	}
+	if header.Len() > 0 {
+		header.WriteString("\n")
+	}
+
+	if strings.ToUpper(request.Method) == "GET" {
+		if expanded, err := expandGraphQL(request); err == nil {
+			return expanded, header.String()
+		}
+	}
+
+	request.Method = "POST"
+	if !request.HeaderFields().Has("Content-Type") {
+		request.RawHeaders = append(append(HeaderList{}, request.RawHeaders...), HeaderField{Name: "Content-Type", Value: "application/json"})
+	}
+	return request, header.String()
+}
+
+// prepareAWS notes the AWS signature in a comment. An unsigned payload is
+// asked for with its header, which the signing libraries of every language
+// use as the payload hash.
+func (cg *CodeGenerator) prepareAWS(request APIRequest, language string) (APIRequest, string) {
+	aws := request.Auth.AWS
+	comment := codegenComment(language)
+	header := fmt.Sprintf("%s Signed with AWS Signature Version 4 for %s\n", comment, aws.Service)
+	switch strings.ToLower(aws.Payload) {
+	case AWSPayloadUnsigned:
+		request.RawHeaders = append(append(HeaderList{}, request.RawHeaders...), HeaderField{Name: "X-Amz-Content-Sha256", Value: awsUnsignedPayload})
+	case AWSPayloadChunked:
+		header += fmt.Sprintf("%s The payload is signed whole, aws-chunked uploads need an AWS SDK client\n", comment)
+	}
+	return request, header + "\n"
+}
+
+// prepareDigest notes Digest auth in a comment. curl and Python answer the
+// challenge themselves, other languages need a Digest client.
+func (cg *CodeGenerator) prepareDigest(digest *DigestAuth, language string) string {
+	switch strings.ToLower(language) {
+	case "javascript", "go", "nodejs":
+		return fmt.Sprintf("%s Uses HTTP Digest auth as %q, answer the 401 challenge of the server with a Digest client\n\n",
+			codegenComment(language), digest.Username)
+	}
+	return ""
+}
+
+// prepareHMAC notes in a comment how the request is signed, since the
+// signature changes with every request
+func (cg *CodeGenerator) prepareHMAC(config *HMACAuth, language string) string {
+	comment := codegenComment(language)
+	template := config.Template
+	if template == "" {
+		template = DefaultHMACTemplate
+	}
+	value := config.Value
+	if value == "" {
+		value = DefaultHMACValue
+	}
+	algorithm := config.Algorithm
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+
+	var header strings.Builder
+	header.WriteString(fmt.Sprintf("%s Signed with HMAC-%s of these lines:\n", comment, strings.ToUpper(algorithm)))
+	for _, line := range strings.Split(template, "\n") {
+		header.WriteString(fmt.Sprintf("%s   %s\n", comment, line))
+	}
+	header.WriteString(fmt.Sprintf("%s and sent as %s: %s\n", comment, config.header(), value))
+	if name := optionalHeader(config.TimestampHeader, DefaultHMACTimestampHeader); name != "" {
+		header.WriteString(fmt.Sprintf("%s with the timestamp in %s\n", comment, name))
+	}
+	if name := optionalHeader(config.NonceHeader, DefaultHMACNonceHeader); name != "" {
+		header.WriteString(fmt.Sprintf("%s with the nonce in %s\n", comment, name))
+	}
+	return header.String() + "\n"
+}
+
 // Helper functions
+
+// codegenComment returns the line comment marker of a language
+func codegenComment(language string) string {
+	switch strings.ToLower(language) {
+	case "javascript", "go", "nodejs":
+		return "//"
+	}
+	return "#"
+}
+
+// codegenAWS returns the AWS auth of a request, which generated code signs
+// itself, or nil
+func codegenAWS(request APIRequest) *AWSSigV4Auth {
+	if request.Auth != nil && request.Auth.Type == AuthAWSSigV4 {
+		return request.Auth.AWS
+	}
+	return nil
+}
+
+// codegenDigest returns the Digest auth of a request, which curl and Python
+// answer themselves, or nil
+func codegenDigest(request APIRequest) *DigestAuth {
+	if request.Auth != nil && request.Auth.Type == AuthDigest {
+		return request.Auth.Digest
+	}
+	return nil
+}
+
+// isFormBody reports whether the request body is built from its form fields
+func isFormBody(request APIRequest) bool {
+	return request.BodyType == BodyTypeFormData || request.BodyType == BodyTypeURLEncoded
+}
+
+// codegenHeaders returns the headers to emit. For multipart bodies the
+// Content-Type is left out because each client library adds its own boundary.
+func codegenHeaders(request APIRequest) HeaderList {
+	fields := request.HeaderFields()
+	if request.BodyType != BodyTypeFormData {
+		return fields
+	}
+
+	var filtered HeaderList
+	for _, field := range fields {
+		if !strings.EqualFold(field.Name, "Content-Type") {
+			filtered = append(filtered, field)
+		}
+	}
+	return filtered
+}
+
+// codegenTarget returns the HTTP URL to request and the Unix socket to send
+// it over, if any
+func codegenTarget(request APIRequest) (string, string) {
+	target := request.FullURL()
+	if socket, httpURL, ok := splitUnixURL(target); ok {
+		return httpURL, socket
+	}
+	return target, request.Options.UnixSocket
+}
+
+// curlResolveFlags turns host overrides into curl flags. Overrides without a
+// port apply to the port of target. An address with a port of its own needs
+// --connect-to, since --resolve keeps the original port.
+func curlResolveFlags(resolve map[string]string, target string) []string {
+	if len(resolve) == 0 {
+		return nil
+	}
+
+	defaultPort := "80"
+	if u, err := url.Parse(target); err == nil {
+		if u.Port() != "" {
+			defaultPort = u.Port()
+		} else if u.Scheme == "https" {
+			defaultPort = "443"
+		}
+	}
+
+	keys := make([]string, 0, len(resolve))
+	for key := range resolve {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var flags []string
+	for _, key := range keys {
+		host, port, err := net.SplitHostPort(key)
+		if err != nil {
+			host, port = key, defaultPort
+		}
+
+		address := resolve[key]
+		if addressHost, addressPort, err := net.SplitHostPort(address); err == nil {
+			flags = append(flags, fmt.Sprintf(`  --connect-to "%s:%s:%s"`, host, port, net.JoinHostPort(addressHost, addressPort)))
+			continue
+		}
+		address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+		if strings.Contains(address, ":") {
+			address = "[" + address + "]"
+		}
+		flags = append(flags, fmt.Sprintf(`  --resolve "%s:%s:%s"`, host, port, address))
+	}
+	return flags
+}
+
+// appendOnce appends value unless it is already present
+func appendOnce(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// shellEscape escapes a value for use inside double quotes in a shell
+func shellEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s)
+}
+
+// jsString quotes s as a single quoted JavaScript string
+func jsString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+// groupHeaders groups header values by name, keeping the order names first appear in
+func groupHeaders(fields HeaderList) ([]string, map[string][]string) {
+	var names []string
+	values := make(map[string][]string)
+	for _, field := range fields {
+		if _, exists := values[field.Name]; !exists {
+			names = append(names, field.Name)
+		}
+		values[field.Name] = append(values[field.Name], field.Value)
+	}
+	return names, values
+}
+
 func formatJSBody(body string) string {
 	// Try to parse as JSON, if successful return as object, otherwise as string
 	if strings.HasPrefix(strings.TrimSpace(body), "{") || strings.HasPrefix(strings.TrimSpace(body), "[") {
 		return fmt.Sprintf("JSON.stringify(%s)", body)
 	}
-	return fmt.Sprintf(`"%s"`, body)
+	// Quoted so XML bodies such as SOAP envelopes survive
+	return jsString(body)
 }
 
 func formatPythonBody(body string) string {
 	if strings.HasPrefix(strings.TrimSpace(body), "{") || strings.HasPrefix(strings.TrimSpace(body), "[") {
 		return body
 	}
-	return fmt.Sprintf(`"%s"`, body)
+	return jsString(body)
 }
 
 func formatGoBody(body string) string {
@@ -219,4 +827,282 @@ func extractPath(url string) string {
 		return "/" + strings.Join(parts[1:], "/")
 	}
 	return "/"
-}
\ No newline at end of file
+}
+
+// graphQLCodegenPayload returns the indented JSON body of an operation
+func graphQLCodegenPayload(graphQL *GraphQLRequest) string {
+	payload, err := graphQL.payload()
+	if err != nil {
+		return ""
+	}
+	var indented bytes.Buffer
+	if json.Indent(&indented, payload, "", "  ") != nil {
+		return string(payload)
+	}
+	return indented.String()
+}
+
+// graphQLVariablesJSON returns the variables as indented JSON, or "" if there are none
+func graphQLVariablesJSON(graphQL *GraphQLRequest, indent string) string {
+	if len(graphQL.Variables) == 0 {
+		return ""
+	}
+	variables, err := json.MarshalIndent(graphQL.Variables, indent, "  ")
+	if err != nil {
+		return ""
+	}
+	return string(variables)
+}
+
+// graphQLJSPrelude declares the query and variables for JavaScript
+func graphQLJSPrelude(graphQL *GraphQLRequest) string {
+	query := strings.NewReplacer(`\`, `\\`, "`", "\\`", "${", "\\${").Replace(strings.TrimSpace(graphQL.Query))
+	prelude := "const query = `\n" + query + "\n`;\n"
+	if variables := graphQLVariablesJSON(graphQL, ""); variables != "" {
+		prelude += "const variables = " + variables + ";\n"
+	}
+	return prelude + "\n"
+}
+
+// graphQLJSBody is the object literal sent by the JavaScript generators
+func graphQLJSBody(graphQL *GraphQLRequest) string {
+	fields := []string{"query"}
+	if graphQL.OperationName != "" {
+		fields = append(fields, "operationName: "+jsString(graphQL.OperationName))
+	}
+	if len(graphQL.Variables) > 0 {
+		fields = append(fields, "variables")
+	}
+	return "{ " + strings.Join(fields, ", ") + " }"
+}
+
+// graphQLPythonPrelude declares the query, variables and payload for Python
+func graphQLPythonPrelude(graphQL *GraphQLRequest) string {
+	query := strings.NewReplacer(`\`, `\\`, `"""`, `\"\"\"`).Replace(strings.TrimSpace(graphQL.Query))
+	prelude := "query = \"\"\"\n" + query + "\n\"\"\"\n"
+
+	fields := []string{`"query": query`}
+	if graphQL.OperationName != "" {
+		fields = append(fields, fmt.Sprintf(`"operationName": %q`, graphQL.OperationName))
+	}
+	if len(graphQL.Variables) > 0 {
+		prelude += "variables = " + pythonLiteral(graphQL.Variables, "") + "\n"
+		fields = append(fields, `"variables": variables`)
+	}
+	return prelude + "\ndata = {" + strings.Join(fields, ", ") + "}\n\n"
+}
+
+// pythonLiteral formats a decoded JSON value as a Python literal
+func pythonLiteral(value interface{}, indent string) string {
+	switch v := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return "{}"
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var literal strings.Builder
+		literal.WriteString("{\n")
+		for _, key := range keys {
+			keyJSON, _ := json.Marshal(key)
+			literal.WriteString(fmt.Sprintf("%s    %s: %s,\n", indent, keyJSON, pythonLiteral(v[key], indent+"    ")))
+		}
+		literal.WriteString(indent + "}")
+		return literal.String()
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = pythonLiteral(item, indent)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		// Strings and numbers are written the same way in JSON
+		literal, _ := json.Marshal(v)
+		return string(literal)
+	}
+}
+
+// graphQLGoPayload declares the query and variables for Go and marshals the payload
+func graphQLGoPayload(graphQL *GraphQLRequest) string {
+	var code strings.Builder
+	query := strings.TrimSpace(graphQL.Query)
+	if strings.Contains(query, "`") {
+		code.WriteString(fmt.Sprintf("    query := %q\n", query))
+	} else {
+		code.WriteString("    query := `\n" + query + "\n`\n")
+	}
+
+	fields := []string{`        "query": query,`}
+	if graphQL.OperationName != "" {
+		fields = append(fields, fmt.Sprintf(`        "operationName": %q,`, graphQL.OperationName))
+	}
+	if variables := graphQLVariablesJSON(graphQL, "    "); variables != "" {
+		if strings.Contains(variables, "`") {
+			code.WriteString(fmt.Sprintf("    variables := json.RawMessage(%q)\n", variables))
+		} else {
+			code.WriteString("    variables := json.RawMessage(`" + variables + "`)\n")
+		}
+		fields = append(fields, `        "variables": variables,`)
+	}
+
+	code.WriteString("    payload, _ := json.Marshal(map[string]interface{}{\n")
+	code.WriteString(strings.Join(fields, "\n") + "\n")
+	code.WriteString("    })\n")
+	return code.String()
+}
+
+// awsCodegenSettings returns the settings of AWS auth as expressions of
+// generated code: literals when set, otherwise reads of the environment
+// variables they default to. The session token is empty when there is none.
+func awsCodegenSettings(aws *AWSSigV4Auth, literal, env func(string) string) (accessKey, secretKey, sessionToken, region string) {
+	setting := func(value, name string) string {
+		if value != "" {
+			return literal(value)
+		}
+		return env(name)
+	}
+	accessKey = setting(aws.AccessKey, "AWS_ACCESS_KEY_ID")
+	secretKey = setting(aws.SecretKey, "AWS_SECRET_ACCESS_KEY")
+	region = setting(aws.Region, "AWS_REGION")
+	if aws.SessionToken != "" || aws.AccessKey == "" {
+		sessionToken = setting(aws.SessionToken, "AWS_SESSION_TOKEN")
+	}
+	return accessKey, secretKey, sessionToken, region
+}
+
+// awsCurlFlags signs a curl command with curl's own SigV4 support. A session
+// token is only sent when set, an empty header would be sent otherwise.
+func awsCurlFlags(aws *AWSSigV4Auth) []string {
+	accessKey, secretKey, _, region := awsCodegenSettings(aws, shellEscape, func(name string) string {
+		return "$" + name
+	})
+	flags := []string{
+		fmt.Sprintf(`  --aws-sigv4 "aws:amz:%s:%s"`, region, shellEscape(aws.Service)),
+		fmt.Sprintf(`  --user "%s:%s"`, accessKey, secretKey),
+	}
+	if aws.SessionToken != "" {
+		flags = append(flags, fmt.Sprintf(`  -H "X-Amz-Security-Token: %s"`, shellEscape(aws.SessionToken)))
+	}
+	return flags
+}
+
+// awsJSPrelude creates the aws4fetch client that signs a fetch request
+func awsJSPrelude(aws *AWSSigV4Auth) string {
+	accessKey, secretKey, sessionToken, region := awsCodegenSettings(aws, strconv.Quote, func(name string) string {
+		return "process.env." + name
+	})
+
+	var code strings.Builder
+	code.WriteString("import { AwsClient } from \"aws4fetch\";\n\n")
+	code.WriteString("const aws = new AwsClient({\n")
+	code.WriteString(fmt.Sprintf("  accessKeyId: %s,\n", accessKey))
+	code.WriteString(fmt.Sprintf("  secretAccessKey: %s,\n", secretKey))
+	if sessionToken != "" {
+		code.WriteString(fmt.Sprintf("  sessionToken: %s,\n", sessionToken))
+	}
+	code.WriteString(fmt.Sprintf("  region: %s,\n", region))
+	code.WriteString(fmt.Sprintf("  service: %q,\n", aws.Service))
+	code.WriteString("});\n\n")
+	return code.String()
+}
+
+// awsPythonPrelude imports requests with requests-aws4auth and creates the
+// auth that signs the request
+func awsPythonPrelude(aws *AWSSigV4Auth) string {
+	usesEnv := false
+	accessKey, secretKey, sessionToken, region := awsCodegenSettings(aws, strconv.Quote, func(name string) string {
+		usesEnv = true
+		if name == "AWS_SESSION_TOKEN" {
+			return `os.environ.get("AWS_SESSION_TOKEN")`
+		}
+		return fmt.Sprintf("os.environ[%q]", name)
+	})
+
+	var code strings.Builder
+	if usesEnv {
+		code.WriteString("import os\n")
+	}
+	code.WriteString("import requests\n")
+	code.WriteString("from requests_aws4auth import AWS4Auth\n\n")
+	args := []string{accessKey, secretKey, region, strconv.Quote(aws.Service)}
+	if sessionToken != "" {
+		args = append(args, "session_token="+sessionToken)
+	}
+	code.WriteString(fmt.Sprintf("auth = AWS4Auth(%s)\n", strings.Join(args, ", ")))
+	return code.String()
+}
+
+// awsNodeSigning signs the https options with aws4, which hashes the body
+// it is given in the options
+func awsNodeSigning(aws *AWSSigV4Auth, request APIRequest) string {
+	accessKey, secretKey, sessionToken, region := awsCodegenSettings(aws, jsString, func(name string) string {
+		return "process.env." + name
+	})
+
+	var code strings.Builder
+	code.WriteString(fmt.Sprintf("options.service = %s;\n", jsString(aws.Service)))
+	code.WriteString(fmt.Sprintf("options.region = %s;\n", region))
+	switch {
+	case request.GraphQL != nil:
+		code.WriteString(fmt.Sprintf("options.body = JSON.stringify(%s);\n", graphQLJSBody(request.GraphQL)))
+	case request.BodyType == BodyTypeFormData:
+		code.WriteString("// aws4 cannot hash a streamed form, the signature covers an empty body\n")
+	case request.BodyType == BodyTypeURLEncoded:
+		code.WriteString("options.body = body;\n")
+	case request.Body != "":
+		code.WriteString(fmt.Sprintf("options.body = %s;\n", formatJSBody(request.Body)))
+	}
+	code.WriteString("aws4.sign(options, {\n")
+	code.WriteString(fmt.Sprintf("  accessKeyId: %s,\n", accessKey))
+	code.WriteString(fmt.Sprintf("  secretAccessKey: %s,\n", secretKey))
+	if sessionToken != "" {
+		code.WriteString(fmt.Sprintf("  sessionToken: %s,\n", sessionToken))
+	}
+	code.WriteString("});\n\n")
+	return code.String()
+}
+
+// awsGoSigning returns the code signing req with the AWS SDK for Go v2, and
+// the imports it needs
+func awsGoSigning(aws *AWSSigV4Auth) (string, []string) {
+	imports := []string{"context", "time", "github.com/aws/aws-sdk-go-v2/aws", "github.com/aws/aws-sdk-go-v2/aws/signer/v4"}
+	accessKey, secretKey, sessionToken, region := awsCodegenSettings(aws, strconv.Quote, func(name string) string {
+		imports = appendOnce(imports, "os")
+		return fmt.Sprintf("os.Getenv(%q)", name)
+	})
+
+	var code strings.Builder
+	code.WriteString("\n    // Sign the request with AWS Signature Version 4\n")
+	if strings.EqualFold(aws.Payload, AWSPayloadUnsigned) {
+		code.WriteString(fmt.Sprintf("    payloadHash := %q\n", awsUnsignedPayload))
+	} else {
+		imports = append(imports, "crypto/sha256", "encoding/hex")
+		imports = appendOnce(imports, "io")
+		code.WriteString("    hash := sha256.New()\n")
+		code.WriteString("    if req.GetBody != nil {\n")
+		code.WriteString("        payload, _ := req.GetBody()\n")
+		code.WriteString("        io.Copy(hash, payload)\n")
+		code.WriteString("    }\n")
+		code.WriteString("    payloadHash := hex.EncodeToString(hash.Sum(nil))\n")
+		if aws.Service == "s3" {
+			code.WriteString("    req.Header.Set(\"X-Amz-Content-Sha256\", payloadHash)\n")
+		}
+	}
+	credentials := fmt.Sprintf("AccessKeyID: %s, SecretAccessKey: %s", accessKey, secretKey)
+	if sessionToken != "" {
+		credentials += ", SessionToken: " + sessionToken
+	}
+	code.WriteString(fmt.Sprintf("    credentials := aws.Credentials{%s}\n", credentials))
+	code.WriteString(fmt.Sprintf("    v4.NewSigner().SignHTTP(context.Background(), credentials, req, payloadHash, %q, %s, time.Now())\n", aws.Service, region))
+	return code.String(), imports
+}
@@ -10,6 +10,8 @@ type Collection struct {
 	Name        string           `json:"name"`
 	Description string           `json:"description"`
 	Requests    []SavedRequest   `json:"requests"`
+	Folders     []Folder         `json:"folders,omitempty"`
+	Auth        *RequestAuth     `json:"auth,omitempty"` // inherited by requests and folders that do not set their own
 	Variables   map[string]string `json:"variables"`
 	CreatedAt   time.Time        `json:"createdAt"`
 	UpdatedAt   time.Time        `json:"updatedAt"`
@@ -21,14 +23,59 @@ type SavedRequest struct {
 	Name        string            `json:"name"`
 	Method      string            `json:"method"`
 	URL         string            `json:"url"`
+	QueryParams []QueryParam      `json:"queryParams,omitempty"`
 	Headers     map[string]string `json:"headers"`
+	RawHeaders  HeaderList        `json:"rawHeaders,omitempty"`
 	Body        string            `json:"body"`
+	BodyType    string            `json:"bodyType,omitempty"`
+	Form        []FormField       `json:"form,omitempty"`
+	GraphQL     *GraphQLRequest   `json:"graphql,omitempty"`
+	WebSocket   *WebSocketOptions `json:"webSocket,omitempty"` // subprotocols and message sequence of a saved WebSocket session
+	GRPC        *GRPCRequest      `json:"grpc,omitempty"`
+	JSONRPC     *JSONRPCRequest   `json:"jsonrpc,omitempty"`
+	SOAP        *SOAPRequest      `json:"soap,omitempty"`
+	Auth        *RequestAuth      `json:"auth,omitempty"`     // nil inherits from the folder or collection
+	FolderID    string            `json:"folderId,omitempty"` // folder holding the request, the collection root when empty
 	Tests       []TestScript      `json:"tests"`
 	PreScript   string            `json:"preScript"`
 	PostScript  string            `json:"postScript"`
 	CreatedAt   time.Time         `json:"createdAt"`
 }
 
+// Folder groups requests of a collection. Folders nest through ParentID.
+type Folder struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	ParentID string       `json:"parentId,omitempty"` // the collection root when empty
+	Auth     *RequestAuth `json:"auth,omitempty"`     // nil inherits from the parent folder or collection
+}
+
+// RequestAuth returns the auth that applies to a request in the folder with
+// the given ID, walking up the folders to the collection
+func (c *Collection) RequestAuth(folderID string, auth *RequestAuth) *RequestAuth {
+	levels := []*RequestAuth{auth}
+	seen := make(map[string]bool)
+	for folderID != "" && !seen[folderID] {
+		seen[folderID] = true
+		folder := c.folder(folderID)
+		if folder == nil {
+			break
+		}
+		levels = append(levels, folder.Auth)
+		folderID = folder.ParentID
+	}
+	return InheritAuth(append(levels, c.Auth)...)
+}
+
+func (c *Collection) folder(id string) *Folder {
+	for i := range c.Folders {
+		if c.Folders[i].ID == id {
+			return &c.Folders[i]
+		}
+	}
+	return nil
+}
+
 // TestScript represents a test script for validation
 type TestScript struct {
 	Name        string `json:"name"`
@@ -42,6 +89,9 @@ type Environment struct {
 	Name      string            `json:"name"`
 	Variables map[string]string `json:"variables"`
 	Active    bool              `json:"active"`
+	TLS       *TLSOptions       `json:"tls,omitempty"`
+	Proxy     *ProxyOptions     `json:"proxy,omitempty"`
+	Resolve   map[string]string `json:"resolve,omitempty"` // host overrides, see RequestOptions.Resolve
 }
 
 // Workspace represents a workspace containing collections
@@ -68,8 +118,12 @@ func NewCollectionManager() *CollectionManager {
 
 // CreateWorkspace creates a new workspace
 func (cm *CollectionManager) CreateWorkspace(name, description string) *Workspace {
+	return cm.addWorkspace(generateID(), name, description)
+}
+
+func (cm *CollectionManager) addWorkspace(id, name, description string) *Workspace {
 	workspace := &Workspace{
-		ID:           generateID(),
+		ID:           id,
 		Name:         name,
 		Description:  description,
 		Collections:  []Collection{},
@@ -83,7 +137,10 @@ func (cm *CollectionManager) CreateWorkspace(name, description string) *Workspac
 // CreateCollection creates a new collection in a workspace
 func (cm *CollectionManager) CreateCollection(workspaceID, name, description string) (*Collection, error) {
 	workspace, exists := cm.workspaces[workspaceID]
-	if !exists {
+	if !exists && workspaceID != "" {
+		// The first collection of a workspace creates it under its ID
+		workspace = cm.addWorkspace(workspaceID, "Default", "Default workspace")
+	} else if !exists {
 		workspace = cm.CreateWorkspace("Default", "Default workspace")
 	}
 
@@ -110,6 +167,9 @@ func (cm *CollectionManager) AddRequestToCollection(workspaceID, collectionID st
 
 	for i := range workspace.Collections {
 		if workspace.Collections[i].ID == collectionID {
+			if request.FolderID != "" && workspace.Collections[i].folder(request.FolderID) == nil {
+				return &APIError{Message: "Folder not found"}
+			}
 			request.ID = generateID()
 			request.CreatedAt = time.Now()
 			workspace.Collections[i].Requests = append(workspace.Collections[i].Requests, request)
@@ -120,11 +180,110 @@ func (cm *CollectionManager) AddRequestToCollection(workspaceID, collectionID st
 	return &APIError{Message: "Collection not found"}
 }
 
+// CreateFolder creates a folder in a collection, inside the folder parentID
+// unless it is empty
+func (cm *CollectionManager) CreateFolder(workspaceID, collectionID, parentID, name string, auth *RequestAuth) (*Folder, error) {
+	collection, err := cm.collection(workspaceID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != "" && collection.folder(parentID) == nil {
+		return nil, &APIError{Message: "Parent folder not found"}
+	}
+
+	folder := Folder{
+		ID:       generateID(),
+		Name:     name,
+		ParentID: parentID,
+		Auth:     auth,
+	}
+	collection.Folders = append(collection.Folders, folder)
+	collection.UpdatedAt = time.Now()
+	return &folder, nil
+}
+
+// SetAuth sets the auth of a folder, or of the collection when folderID is empty
+func (cm *CollectionManager) SetAuth(workspaceID, collectionID, folderID string, auth *RequestAuth) error {
+	collection, err := cm.collection(workspaceID, collectionID)
+	if err != nil {
+		return err
+	}
+	// The browser is shown masked secrets, those it sends back are kept
+	if folderID == "" {
+		KeepMaskedSecrets(auth, collection.Auth)
+		collection.Auth = auth
+	} else if folder := collection.folder(folderID); folder != nil {
+		KeepMaskedSecrets(auth, folder.Auth)
+		folder.Auth = auth
+	} else {
+		return &APIError{Message: "Folder not found"}
+	}
+	collection.UpdatedAt = time.Now()
+	return nil
+}
+
+// RequestAuth returns the auth that applies to a request sent from the
+// folder folderID of a collection, see Collection.RequestAuth
+func (cm *CollectionManager) RequestAuth(workspaceID, collectionID, folderID string, auth *RequestAuth) (*RequestAuth, error) {
+	collection, err := cm.collection(workspaceID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	return collection.RequestAuth(folderID, auth), nil
+}
+
+func (cm *CollectionManager) collection(workspaceID, collectionID string) (*Collection, error) {
+	workspace, exists := cm.workspaces[workspaceID]
+	if !exists {
+		return nil, &APIError{Message: "Workspace not found"}
+	}
+	for i := range workspace.Collections {
+		if workspace.Collections[i].ID == collectionID {
+			return &workspace.Collections[i], nil
+		}
+	}
+	return nil, &APIError{Message: "Collection not found"}
+}
+
 // GetWorkspaces returns all workspaces
 func (cm *CollectionManager) GetWorkspaces() map[string]*Workspace {
 	return cm.workspaces
 }
 
+// MaskedWorkspace returns a copy of a workspace in which the auth of
+// collections, folders and requests has its secrets masked, or nil if the
+// workspace has no collections yet
+func (cm *CollectionManager) MaskedWorkspace(workspaceID string) *Workspace {
+	workspace, exists := cm.workspaces[workspaceID]
+	if !exists {
+		return nil
+	}
+	masked := *workspace
+	masked.Collections = make([]Collection, len(workspace.Collections))
+	for i, collection := range workspace.Collections {
+		masked.Collections[i] = collection.masked()
+	}
+	return &masked
+}
+
+// masked returns a copy of the collection with the secrets of its auth masked
+func (c Collection) masked() Collection {
+	c.Auth = MaskAuth(c.Auth)
+	folders := make([]Folder, len(c.Folders))
+	for i, folder := range c.Folders {
+		folder.Auth = MaskAuth(folder.Auth)
+		folders[i] = folder
+	}
+	c.Folders = folders
+	requests := make([]SavedRequest, len(c.Requests))
+	for i, request := range c.Requests {
+		request.Auth = MaskAuth(request.Auth)
+		requests[i] = request
+	}
+	c.Requests = requests
+	return c
+}
+
 // APIError represents an API error
 type APIError struct {
 	Message string `json:"message"`
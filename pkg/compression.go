@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is sent on requests that do not set Accept-Encoding themselves
+const acceptEncoding = "gzip, deflate, br, zstd"
+
+// decoders undo a content coding of a response body
+var decoders = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": func(r io.Reader) (io.ReadCloser, error) {
+		// Some servers send raw DEFLATE instead of the zlib format the spec asks for
+		buffered := bufio.NewReader(r)
+		header, err := buffered.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	},
+	"br": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	},
+}
+
+// encoders apply a content coding to a request body
+var encoders = map[string]func(io.Writer) (io.WriteCloser, error){
+	"gzip": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	"deflate": func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriter(w), nil
+	},
+	"br": func(w io.Writer) (io.WriteCloser, error) {
+		return brotli.NewWriter(w), nil
+	},
+	"zstd": func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+}
+
+// contentCodings splits a Content-Encoding value into lower case codings,
+// leaving out identity
+func contentCodings(value string) []string {
+	var codings []string
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "", "identity":
+			continue
+		case "x-gzip":
+			coding = "gzip"
+		}
+		codings = append(codings, coding)
+	}
+	return codings
+}
+
+// canDecode reports whether there is a decoder for every coding
+func canDecode(codings []string) bool {
+	for _, coding := range codings {
+		if _, ok := decoders[coding]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeBody wraps r with decoders for the codings, undoing them in reverse
+// order as they were applied in the order listed. The returned function
+// closes the decoders.
+func decodeBody(r io.Reader, codings []string) (io.Reader, func(), error) {
+	var closers []io.Closer
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoded, err := decoders[codings[i]](r)
+		if err == io.EOF {
+			// An empty body, as sent with HEAD or 204 responses
+			return bytes.NewReader(nil), closeAll, nil
+		}
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("decoding %s body: %w", codings[i], err)
+		}
+		closers = append(closers, decoded)
+		r = decoded
+	}
+	return r, closeAll, nil
+}
+
+// compressBody returns body compressed with the given coding. Bodies of a
+// known size up to DefaultMaxBodySize are compressed in memory so the
+// request keeps a Content-Length; larger ones are streamed.
+func compressBody(body *requestBody, coding string) (*requestBody, error) {
+	coding = strings.ToLower(coding)
+	newEncoder, ok := encoders[coding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported body compression %q", coding)
+	}
+
+	compress := func(w io.Writer) error {
+		source, err := body.open()
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+
+		encoder, err := newEncoder(w)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(encoder, source); err != nil {
+			encoder.Close()
+			return err
+		}
+		return encoder.Close()
+	}
+
+	compressed := &requestBody{
+		contentType:     body.contentType,
+		contentEncoding: coding,
+	}
+
+	if body.contentLength >= 0 && body.contentLength <= DefaultMaxBodySize {
+		var buffer bytes.Buffer
+		if err := compress(&buffer); err != nil {
+			return nil, err
+		}
+		data := buffer.Bytes()
+		compressed.open = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		compressed.contentLength = int64(len(data))
+		return compressed, nil
+	}
+
+	compressed.open = func() (io.ReadCloser, error) {
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(compress(writer))
+		}()
+		return reader, nil
+	}
+	compressed.contentLength = -1
+	return compressed, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
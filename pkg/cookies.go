@@ -0,0 +1,344 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Cookie is a cookie held by a CookieJar
+type Cookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires"` // zero for session cookies
+	Secure   bool      `json:"secure"`
+	HttpOnly bool      `json:"httpOnly"`
+	SameSite string    `json:"sameSite,omitempty"`
+	HostOnly bool      `json:"hostOnly"` // only sent to Domain itself, not its subdomains
+}
+
+// expired reports whether the cookie has expired at now
+func (c Cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// matches reports whether the cookie should be sent to u
+func (c Cookie) matches(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if c.HostOnly {
+		if host != c.Domain {
+			return false
+		}
+	} else if host != c.Domain && !strings.HasSuffix(host, "."+c.Domain) {
+		return false
+	}
+
+	if c.Secure && u.Scheme != "https" && u.Scheme != "wss" {
+		return false
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == c.Path {
+		return true
+	}
+	return strings.HasPrefix(path, c.Path) && (strings.HasSuffix(c.Path, "/") || path[len(c.Path)] == '/')
+}
+
+// CookieJar is an http.CookieJar that can list, edit and persist its
+// cookies. The zero value is not usable; use NewCookieJar.
+type CookieJar struct {
+	mutex    sync.Mutex
+	cookies  []Cookie
+	onChange func([]Cookie) // called with the mutex held after every change
+}
+
+// NewCookieJar creates an empty in-memory cookie jar
+func NewCookieJar() *CookieJar {
+	return &CookieJar{}
+}
+
+// SetCookies stores the cookies received in a response from u
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if len(cookies) == 0 {
+		return
+	}
+
+	now := time.Now()
+	host := strings.ToLower(u.Hostname())
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	changed := false
+	for _, received := range cookies {
+		cookie, ok := newJarCookie(received, host, u.EscapedPath(), now)
+		if !ok {
+			continue
+		}
+		j.store(cookie, now)
+		changed = true
+	}
+	if changed {
+		j.changed()
+	}
+}
+
+// Cookies returns the cookies to send in a request to u, longest path first
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	now := time.Now()
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var matched []Cookie
+	for _, cookie := range j.cookies {
+		if !cookie.expired(now) && cookie.matches(u) {
+			matched = append(matched, cookie)
+		}
+	}
+	sort.SliceStable(matched, func(a, b int) bool {
+		return len(matched[a].Path) > len(matched[b].Path)
+	})
+
+	result := make([]*http.Cookie, 0, len(matched))
+	for _, cookie := range matched {
+		result = append(result, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return result
+}
+
+// All returns every cookie that has not expired
+func (j *CookieJar) All() []Cookie {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	now := time.Now()
+	result := []Cookie{}
+	for _, cookie := range j.cookies {
+		if !cookie.expired(now) {
+			result = append(result, cookie)
+		}
+	}
+	return result
+}
+
+// Set adds a cookie or replaces the one with the same name, domain and path
+func (j *CookieJar) Set(cookie Cookie) error {
+	if cookie.Name == "" {
+		return &APIError{Message: "Cookie name is required"}
+	}
+	cookie.Domain = strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+	if cookie.Domain == "" {
+		return &APIError{Message: "Cookie domain is required"}
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.store(cookie, time.Now())
+	j.changed()
+	return nil
+}
+
+// Delete removes the cookie with the given name, domain and path. An empty
+// domain or path matches any.
+func (j *CookieJar) Delete(name, domain, path string) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	kept := j.cookies[:0]
+	for _, cookie := range j.cookies {
+		if cookie.Name == name && (domain == "" || cookie.Domain == domain) && (path == "" || cookie.Path == path) {
+			continue
+		}
+		kept = append(kept, cookie)
+	}
+	j.cookies = kept
+	j.changed()
+}
+
+// Clear removes every cookie
+func (j *CookieJar) Clear() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.cookies = nil
+	j.changed()
+}
+
+// store replaces a cookie with the same identity, or drops it when expired.
+// The caller holds the mutex.
+func (j *CookieJar) store(cookie Cookie, now time.Time) {
+	kept := j.cookies[:0]
+	for _, existing := range j.cookies {
+		if existing.expired(now) {
+			continue
+		}
+		if existing.Name == cookie.Name && existing.Domain == cookie.Domain && existing.Path == cookie.Path {
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	j.cookies = kept
+
+	if !cookie.expired(now) {
+		j.cookies = append(j.cookies, cookie)
+	}
+}
+
+// changed runs the persistence hook. The caller holds the mutex, so saves
+// happen in the order the changes were made.
+func (j *CookieJar) changed() {
+	if j.onChange != nil {
+		j.onChange(j.cookies)
+	}
+}
+
+// newJarCookie applies the RFC 6265 storage rules to a received cookie.
+// It returns false when the cookie must be ignored.
+func newJarCookie(received *http.Cookie, host, requestPath string, now time.Time) (Cookie, bool) {
+	cookie := Cookie{
+		Name:     received.Name,
+		Value:    received.Value,
+		Path:     received.Path,
+		Secure:   received.Secure,
+		HttpOnly: received.HttpOnly,
+		SameSite: sameSiteName(received.SameSite),
+	}
+
+	domain := strings.TrimPrefix(strings.ToLower(received.Domain), ".")
+	switch {
+	case domain == "" || domain == host:
+		cookie.Domain = host
+		cookie.HostOnly = domain == ""
+	case net.ParseIP(host) != nil:
+		// Cookies for IP addresses can only be host cookies
+		return Cookie{}, false
+	case !strings.HasSuffix(host, "."+domain):
+		return Cookie{}, false
+	default:
+		// Refuse cookies for a whole public suffix such as "com" or "co.uk"
+		if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+			return Cookie{}, false
+		}
+		cookie.Domain = domain
+	}
+
+	if cookie.Path == "" || cookie.Path[0] != '/' {
+		cookie.Path = defaultCookiePath(requestPath)
+	}
+
+	switch {
+	case received.MaxAge < 0:
+		cookie.Expires = now.Add(-time.Second)
+	case received.MaxAge > 0:
+		cookie.Expires = now.Add(time.Duration(received.MaxAge) * time.Second)
+	case !received.Expires.IsZero():
+		cookie.Expires = received.Expires
+	}
+
+	return cookie, true
+}
+
+// defaultCookiePath is the directory of the request path, see RFC 6265 5.1.4
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	default:
+		return ""
+	}
+}
+
+// CookieStore keeps one cookie jar per workspace and environment and saves
+// them to the database whenever they change
+type CookieStore struct {
+	mutex sync.Mutex
+	jars  map[cookieScope]*CookieJar
+}
+
+type cookieScope struct {
+	workspaceID uint
+	environment string
+}
+
+// NewCookieStore creates a new cookie store
+func NewCookieStore() *CookieStore {
+	return &CookieStore{
+		jars: make(map[cookieScope]*CookieJar),
+	}
+}
+
+// Jar returns the jar of a workspace and environment, loading it from the
+// database the first time. An empty environment selects the workspace jar.
+func (s *CookieStore) Jar(workspaceID uint, environment string) *CookieJar {
+	scope := cookieScope{workspaceID: workspaceID, environment: environment}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if jar, exists := s.jars[scope]; exists {
+		return jar
+	}
+
+	jar := NewCookieJar()
+	if DB != nil {
+		var stored DBCookieJar
+		// Find rather than First, a missing jar is not an error worth logging
+		DB.Where("workspace_id = ? AND environment = ?", workspaceID, environment).Limit(1).Find(&stored)
+		if stored.ID != 0 {
+			json.Unmarshal([]byte(stored.Cookies), &jar.cookies)
+		}
+		jar.onChange = func(cookies []Cookie) {
+			saveCookieJar(scope, cookies)
+		}
+	}
+
+	s.jars[scope] = jar
+	return jar
+}
+
+// saveCookieJar writes the cookies of a scope to the database
+func saveCookieJar(scope cookieScope, cookies []Cookie) {
+	data, err := json.Marshal(cookies)
+	if err != nil {
+		return
+	}
+
+	stored := DBCookieJar{WorkspaceID: scope.workspaceID, Environment: scope.environment}
+	DB.Where("workspace_id = ? AND environment = ?", scope.workspaceID, scope.environment).Limit(1).Find(&stored)
+	stored.Cookies = string(data)
+	DB.Save(&stored)
+}
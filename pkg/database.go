@@ -34,6 +34,7 @@ type WorkspaceDB struct {
 	CreatedBy   uint      `json:"createdBy"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+	RateLimit   string    `json:"rateLimit"` // JSON encoded RateLimit, empty to use the global limit
 	
 	// Relationships - Use proper GORM associations
 	Members     []UserWorkspace   `json:"members" gorm:"foreignKey:WorkspaceID"`
@@ -62,23 +63,48 @@ type DBCollection struct {
 	Version     int       `json:"version" gorm:"default:1"`
 	IsPublic    bool      `json:"isPublic" gorm:"default:false"`
 	Tags        string    `json:"tags"` // JSON string for tags
+	AuthType    string    `json:"authType"` // inherited by requests and folders, see ParseRequestAuth
+	AuthData    string    `json:"authData"` // JSON string
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 	
 	// Relationships - Use proper GORM associations
 	Workspace WorkspaceDB `json:"workspace" gorm:"foreignKey:WorkspaceID"`
 	Requests  []DBRequest `json:"requests" gorm:"foreignKey:CollectionID"`
+	Folders   []DBFolder  `json:"folders" gorm:"foreignKey:CollectionID"`
+}
+
+// DBFolder groups requests of a collection, nested through ParentID
+type DBFolder struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CollectionID uint      `json:"collectionId"`
+	ParentID     *uint     `json:"parentId"` // nil for a folder at the collection root
+	Name         string    `json:"name" gorm:"not null"`
+	AuthType     string    `json:"authType"` // inherited by requests and folders, see ParseRequestAuth
+	AuthData     string    `json:"authData"` // JSON string
+	Order        int       `json:"order"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
 }
 
 type DBRequest struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	CollectionID uint      `json:"collectionId"`
+	FolderID     *uint     `json:"folderId"` // nil for a request at the collection root
 	Name         string    `json:"name" gorm:"not null"`
 	Method       string    `json:"method" gorm:"not null"`
 	URL          string    `json:"url" gorm:"not null"`
+	QueryParams  string    `json:"queryParams"` // JSON string of []QueryParam
 	Headers      string    `json:"headers"` // JSON string
 	Body         string    `json:"body"`
-	AuthType     string    `json:"authType"`
+	BodyType     string    `json:"bodyType"`
+	Form         string    `json:"form"` // JSON string of []FormField
+	GraphQL      string    `json:"graphql"` // JSON string of GraphQLRequest
+	WebSocket    string    `json:"webSocket"` // JSON string of WebSocketOptions, for saved WebSocket sessions
+	GRPC         string    `json:"grpc"` // JSON string of GRPCRequest
+	JSONRPC      string    `json:"jsonrpc"` // JSON string of JSONRPCRequest
+	SOAP         string    `json:"soap"` // JSON string of SOAPRequest
+	AuthType     string    `json:"authType"` // see ParseRequestAuth, empty or inherit uses the folder or collection auth
 	AuthData     string    `json:"authData"` // JSON string
 	Tests        string    `json:"tests"` // JSON string
 	PreScript    string    `json:"preScript"`
@@ -113,11 +139,17 @@ type RequestHistory struct {
 	WorkspaceID  uint      `json:"workspaceId"`
 	Method       string    `json:"method" gorm:"not null"`
 	URL          string    `json:"url" gorm:"not null"`
-	Headers      string    `json:"headers"` // JSON string
+	Headers      string    `json:"headers"` // JSON object, see HeaderList.ObjectJSON
 	Body         string    `json:"body"`
 	StatusCode   int       `json:"statusCode"`
+	GRPCStatus   string    `json:"grpcStatus"` // status name of a gRPC call, e.g. NotFound
+	Protocol     string    `json:"protocol"` // negotiated HTTP version, e.g. HTTP/2
+	RespHeaders  string    `json:"responseHeaders"` // JSON object, see HeaderList.ObjectJSON
+	Trailers     string    `json:"trailers"` // JSON object of the gRPC trailers, see HeaderList.ObjectJSON
 	ResponseTime int64     `json:"responseTime"` // milliseconds
-	ResponseSize int64     `json:"responseSize"` // bytes
+	ResponseSize int64     `json:"responseSize"` // bytes, after decompression
+	WireSize     int64     `json:"wireSize"` // bytes as received
+	Timing       string    `json:"timing"` // JSON string of ResponseTiming
 	Success      bool      `json:"success"`
 	CreatedAt    time.Time `json:"createdAt"`
 	
@@ -126,6 +158,15 @@ type RequestHistory struct {
 	Workspace WorkspaceDB `json:"workspace" gorm:"foreignKey:WorkspaceID"`
 }
 
+// DBCookieJar holds the cookies of one workspace and environment
+type DBCookieJar struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint      `json:"workspaceId" gorm:"uniqueIndex:idx_cookie_jar_scope"`
+	Environment string    `json:"environment" gorm:"uniqueIndex:idx_cookie_jar_scope"` // environment ID, empty for the workspace jar
+	Cookies     string    `json:"cookies"` // JSON string of []Cookie
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
 type APIMonitor struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	WorkspaceID  uint      `json:"workspaceId"`
@@ -135,6 +176,10 @@ type APIMonitor struct {
 	Headers      string    `json:"headers"` // JSON string
 	Interval     int       `json:"interval" gorm:"default:300"` // seconds
 	Timeout      int       `json:"timeout" gorm:"default:30"` // seconds
+	Proxy        string    `json:"proxy"` // proxy URL, empty uses the global proxy
+	AuthType     string    `json:"authType"` // see ParseRequestAuth, empty sends no auth
+	AuthData     string    `json:"authData"` // JSON string
+	Auth         *RequestAuth `json:"auth,omitempty" gorm:"-"` // when given on create, stored in AuthType and AuthData
 	IsActive     bool      `json:"isActive" gorm:"default:true"`
 	AlertEmail   string    `json:"alertEmail"`
 	CreatedBy    uint      `json:"createdBy"`
@@ -175,9 +220,11 @@ func InitDatabase(dsn string) error {
 		&WorkspaceDB{},
 		&UserWorkspace{},
 		&DBCollection{},
+		&DBFolder{},
 		&DBRequest{},
 		&DBEnvironment{},
 		&RequestHistory{},
+		&DBCookieJar{},
 		&APIMonitor{},
 		&MonitorCheck{},
 	)
@@ -2,7 +2,7 @@ package pkg
 
 // HandleDeleteRequest sends a DELETE request to the specified URL and prints the response body
 func HandleDeleteRequest(url string) {
-	response := MakeHTTPRequest("DELETE", url, "", map[string]string{})
+	response := makeCLIRequest("DELETE", url, "", map[string]string{})
 	printResponse(response)
 }
 
@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// unixURLPrefix starts a Unix socket target: unix:///path/to.sock:/request/path
+const unixURLPrefix = "unix://"
+
+// errUnixSocketDenied is returned for unix:// targets when the engine does
+// not allow local access
+var errUnixSocketDenied = errors.New("Unix socket targets cannot be used here")
+
+// splitUnixURL splits a unix:// target into the socket path and the HTTP URL
+// to request over it. The request path follows the first colon after the
+// socket path and defaults to "/".
+func splitUnixURL(rawURL string) (socket, httpURL string, ok bool) {
+	if !strings.HasPrefix(strings.ToLower(rawURL), unixURLPrefix) {
+		return "", "", false
+	}
+
+	rest := rawURL[len(unixURLPrefix):]
+	socket, path, _ := strings.Cut(rest, ":")
+	if path == "" || (path[0] != '/' && path[0] != '?') {
+		path = "/" + path
+	}
+	return socket, "http://localhost" + path, true
+}
+
+// ParseResolveEntry parses a curl style --resolve entry, host:port:address,
+// into a Resolve key and address. IPv6 addresses may be in brackets.
+func ParseResolveEntry(entry string) (string, string, error) {
+	host, rest, found := strings.Cut(entry, ":")
+	if !found || host == "" {
+		return "", "", fmt.Errorf("invalid resolve entry %q, expected host:port:address", entry)
+	}
+	port, address, found := strings.Cut(rest, ":")
+	if !found || port == "" || address == "" {
+		return "", "", fmt.Errorf("invalid resolve entry %q, expected host:port:address", entry)
+	}
+
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	return strings.ToLower(host) + ":" + port, address, nil
+}
+
+// mergeResolve returns the overrides of base with those of top taking precedence
+func mergeResolve(base, top map[string]string) map[string]string {
+	if len(base) == 0 {
+		return top
+	}
+	if len(top) == 0 {
+		return base
+	}
+
+	merged := make(map[string]string, len(base)+len(top))
+	for key, address := range base {
+		merged[key] = address
+	}
+	for key, address := range top {
+		merged[key] = address
+	}
+	return merged
+}
+
+// resolveAddress applies the overrides to a host:port dial address. Entries
+// for host:port win over entries for the host alone; an override without a
+// port keeps the original one.
+func resolveAddress(resolve map[string]string, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	host = strings.ToLower(host)
+
+	override, exists := resolve[net.JoinHostPort(host, port)]
+	if !exists {
+		if override, exists = resolve[host]; !exists {
+			return addr
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(override); err == nil {
+		return override
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(override, "["), "]"), port)
+}
+
+// dialFunc returns the DialContext of a transport. Connections go to the
+// Unix socket when one is set, otherwise to the address after overrides.
+func dialFunc(dialer *net.Dialer, unixSocket string, resolve map[string]string) func(context.Context, string, string) (net.Conn, error) {
+	if unixSocket != "" {
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", unixSocket)
+		}
+	}
+	if len(resolve) == 0 {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, resolveAddress(resolve, addr))
+	}
+}
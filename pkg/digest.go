@@ -0,0 +1,328 @@
+package pkg
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DigestAuth answers the Digest challenge of a server (RFC 7616) with a
+// username and password. MD5, SHA-256 and SHA-512-256, and their -sess
+// variants, are supported with qop=auth or without qop.
+type DigestAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (d *DigestAuth) substitute(replace func(string) string) *DigestAuth {
+	if d == nil {
+		return nil
+	}
+	return &DigestAuth{Username: replace(d.Username), Password: replace(d.Password)}
+}
+
+// authChallenge is one challenge of a WWW-Authenticate header
+type authChallenge struct {
+	scheme string // lower case
+	params map[string]string
+}
+
+// parseAuthChallenges reads the challenges of WWW-Authenticate header
+// values, several of which may share a value
+func parseAuthChallenges(values []string) []authChallenge {
+	var challenges []authChallenge
+	for _, value := range values {
+		s := value
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if s == "" {
+				break
+			}
+			end := strings.IndexAny(s, " \t,=")
+			if end < 0 {
+				end = len(s)
+			}
+			name, rest := s[:end], strings.TrimLeft(s[end:], " \t")
+			if name == "" {
+				break
+			}
+			if strings.HasPrefix(rest, "=") && len(challenges) > 0 {
+				var param string
+				param, s = authParamValue(rest[1:])
+				challenges[len(challenges)-1].params[strings.ToLower(name)] = param
+				continue
+			}
+			challenges = append(challenges, authChallenge{scheme: strings.ToLower(name), params: map[string]string{}})
+			s = rest
+		}
+	}
+	return challenges
+}
+
+// authParamValue reads a token or quoted string and returns the rest of s
+func authParamValue(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexByte(s, ',')
+		if end < 0 {
+			end = len(s)
+		}
+		return strings.TrimSpace(s[:end]), s[end:]
+	}
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return value.String(), ""
+}
+
+// digestAlgorithms are the supported algorithms, most preferred first
+var digestAlgorithms = []string{"SHA-512-256", "SHA-256", "MD5"}
+
+// digestChallenge is a Digest challenge being answered. Its nonce is reused
+// for later requests to the same server until the server asks again.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string // as sent by the server, empty means MD5
+	qop       string // auth, or empty when the server offers no qop
+	userhash  bool
+
+	mutex sync.Mutex
+	count int // nonce count of the last answer
+}
+
+// newDigestChallenge picks the Digest challenge to answer from the
+// WWW-Authenticate headers of a response. It returns nil when the server
+// asks for no Digest auth, and an error when it asks in a way not supported.
+func newDigestChallenge(headers HeaderList) (*digestChallenge, error) {
+	var values []string
+	for _, field := range headers {
+		if strings.EqualFold(field.Name, "WWW-Authenticate") {
+			values = append(values, field.Value)
+		}
+	}
+
+	var best *digestChallenge
+	rank := len(digestAlgorithms)
+	var unsupported []string
+	for _, challenge := range parseAuthChallenges(values) {
+		if challenge.scheme != "digest" {
+			continue
+		}
+		params := challenge.params
+		algorithm := params["algorithm"]
+		base := strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS")
+		index := -1
+		for i, supported := range digestAlgorithms {
+			if base == supported || (base == "" && supported == "MD5") {
+				index = i
+			}
+		}
+		qop, qopOK := "", params["qop"] == ""
+		for _, offered := range strings.Split(params["qop"], ",") {
+			if strings.TrimSpace(strings.ToLower(offered)) == "auth" {
+				qop, qopOK = "auth", true
+			}
+		}
+		if index < 0 || !qopOK || params["nonce"] == "" {
+			unsupported = append(unsupported, fmt.Sprintf("algorithm=%s qop=%s", algorithm, params["qop"]))
+			continue
+		}
+		if index < rank {
+			rank = index
+			best = &digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: algorithm,
+				qop:       qop,
+				userhash:  strings.EqualFold(params["userhash"], "true"),
+			}
+		}
+	}
+	if best == nil && len(unsupported) > 0 {
+		return nil, fmt.Errorf("unsupported Digest challenge (%s), qop=auth with MD5, SHA-256 or SHA-512-256 is supported",
+			strings.Join(unsupported, "; "))
+	}
+	return best, nil
+}
+
+func (c *digestChallenge) hash() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+	case "SHA-256":
+		return sha256.New()
+	case "SHA-512-256":
+		return sha512.New512_256()
+	}
+	return md5.New()
+}
+
+func (c *digestChallenge) digest(parts ...string) string {
+	h := c.hash()
+	h.Write([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorization returns the Authorization header answering the challenge for
+// a request, counting the nonce's use
+func (c *digestChallenge) authorization(auth DigestAuth, method, uri string) string {
+	c.mutex.Lock()
+	c.count++
+	nc := fmt.Sprintf("%08x", c.count)
+	c.mutex.Unlock()
+
+	cnonce := randomToken(16)
+	ha1 := c.digest(auth.Username, c.realm, auth.Password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = c.digest(ha1, c.nonce, cnonce)
+	}
+	ha2 := c.digest(method, uri)
+
+	username := auth.Username
+	if c.userhash {
+		username = c.digest(auth.Username, c.realm)
+	}
+	fields := []string{
+		"username=" + quoteAuthParam(username),
+		"realm=" + quoteAuthParam(c.realm),
+		"nonce=" + quoteAuthParam(c.nonce),
+		"uri=" + quoteAuthParam(uri),
+	}
+	if c.algorithm != "" {
+		fields = append(fields, "algorithm="+c.algorithm)
+	}
+	if c.qop != "" {
+		response := c.digest(ha1, c.nonce, nc, cnonce, c.qop, ha2)
+		fields = append(fields, "response="+quoteAuthParam(response), "qop="+c.qop, "nc="+nc, "cnonce="+quoteAuthParam(cnonce))
+	} else {
+		fields = append(fields, "response="+quoteAuthParam(c.digest(ha1, c.nonce, ha2)))
+	}
+	if c.opaque != "" {
+		fields = append(fields, "opaque="+quoteAuthParam(c.opaque))
+	}
+	if c.userhash {
+		fields = append(fields, "userhash=true")
+	}
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+func quoteAuthParam(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// DigestChallenges remembers the Digest challenge last answered for each
+// server and user, so that later requests answer it without a 401 first
+type DigestChallenges struct {
+	mutex      sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// NewDigestChallenges creates an empty challenge cache
+func NewDigestChallenges() *DigestChallenges {
+	return &DigestChallenges{challenges: make(map[string]*digestChallenge)}
+}
+
+func (d *DigestChallenges) get(key string) *digestChallenge {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.challenges[key]
+}
+
+func (d *DigestChallenges) set(key string, challenge *digestChallenge) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if challenge == nil {
+		delete(d.challenges, key)
+	} else {
+		d.challenges[key] = challenge
+	}
+}
+
+// Clear forgets every challenge
+func (d *DigestChallenges) Clear() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.challenges = make(map[string]*digestChallenge)
+}
+
+// DigestChallenges returns the Digest challenges the engine answers
+func (e *RequestEngine) DigestChallenges() *DigestChallenges {
+	return e.digestChallenges
+}
+
+// executeDigest sends a request with Digest auth. The challenge of an
+// earlier request to the server is answered right away, otherwise the
+// request is sent without auth and sent again answering the challenge of
+// the 401 response.
+func (e *RequestEngine) executeDigest(ctx context.Context, request APIRequest) APIResponse {
+	config := request.Auth.Digest
+	if config == nil {
+		return APIResponse{Error: "digest auth has no settings"}
+	}
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "GET"
+	}
+	target := request.FullURL()
+	if _, httpURL, ok := splitUnixURL(target); ok {
+		target = httpURL
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return APIResponse{Error: err.Error()}
+	}
+	uri := u.RequestURI()
+	key := u.Scheme + "://" + u.Host + " " + config.Username
+
+	send := func(challenge *digestChallenge) APIResponse {
+		authorized := request
+		authorized.Auth = &RequestAuth{Type: AuthNone}
+		if challenge != nil {
+			authorized = setHeader(authorized, "Authorization", challenge.authorization(*config, method, uri))
+		}
+		return e.Execute(ctx, authorized)
+	}
+
+	start := time.Now()
+	response := send(e.digestChallenges.get(key))
+	if response.StatusCode != http.StatusUnauthorized {
+		return response
+	}
+	challenge, err := newDigestChallenge(response.RawHeaders)
+	if err != nil {
+		response.Error = err.Error()
+	}
+	if challenge == nil {
+		e.digestChallenges.set(key, nil)
+		return response
+	}
+	response = send(challenge)
+	if response.StatusCode == http.StatusUnauthorized {
+		// Wrong credentials, the next request starts over
+		challenge = nil
+	}
+	e.digestChallenges.set(key, challenge)
+	response.ResponseTime = time.Since(start)
+	return response
+}
@@ -0,0 +1,223 @@
+package pkg
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// digestServer accepts user "user" with password "pass" answering one of the
+// WWW-Authenticate challenges it sends, all with realm "test" and nonce "n1"
+type digestServer struct {
+	*httptest.Server
+	challenges []string
+
+	mutex    sync.Mutex
+	requests int
+	answers  []map[string]string // parameters of the answers received
+}
+
+func newDigestServer(t *testing.T, challenges ...string) *digestServer {
+	t.Helper()
+	server := &digestServer{challenges: challenges}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *digestServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests++
+
+	if answer := parseAuthChallenges([]string{r.Header.Get("Authorization")}); len(answer) == 1 && answer[0].scheme == "digest" {
+		params := answer[0].params
+		s.answers = append(s.answers, params)
+		if params["response"] == expectedDigest(params, r.Method, "pass") {
+			w.Write([]byte("ok"))
+			return
+		}
+	}
+	for _, challenge := range s.challenges {
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// expectedDigest computes the response of an answer as RFC 7616 defines it
+func expectedDigest(params map[string]string, method, password string) string {
+	algorithm := strings.ToUpper(params["algorithm"])
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	case "SHA-512-256":
+		newHash = sha512.New512_256
+	default:
+		return ""
+	}
+	h := func(parts ...string) string {
+		sum := newHash()
+		sum.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	username := params["username"]
+	if params["userhash"] == "true" {
+		if username != h("user", params["realm"]) {
+			return ""
+		}
+		username = "user"
+	}
+	ha1 := h(username, params["realm"], password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1, params["nonce"], params["cnonce"])
+	}
+	ha2 := h(method, params["uri"])
+	if params["qop"] == "" {
+		return h(ha1, params["nonce"], ha2)
+	}
+	return h(ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2)
+}
+
+func TestDigestAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		challenges []string
+		password   string
+		sends      int // requests sent in a row
+
+		wantStatus    int
+		wantError     string
+		wantRequests  int    // requests the server received
+		wantAlgorithm string // of the last answer
+		wantNC        string // of the last answer
+	}{
+		{
+			name:         "MD5",
+			challenges:   []string{`Digest realm="test", nonce="n1", qop="auth"`},
+			sends:        1,
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+			wantNC:       "00000001",
+		},
+		{
+			name:          "SHA-256 session",
+			challenges:    []string{`Digest realm="test", nonce="n1", qop="auth", algorithm=SHA-256-sess`},
+			sends:         1,
+			wantStatus:    http.StatusOK,
+			wantRequests:  2,
+			wantNC:        "00000001",
+			wantAlgorithm: "SHA-256-sess",
+		},
+		{
+			name:         "without qop",
+			challenges:   []string{`Digest realm="test", nonce="n1"`},
+			sends:        1,
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			name:          "user hash",
+			challenges:    []string{`Digest realm="test", nonce="n1", qop="auth", algorithm=SHA-512-256, userhash=true`},
+			sends:         1,
+			wantStatus:    http.StatusOK,
+			wantRequests:  2,
+			wantNC:        "00000001",
+			wantAlgorithm: "SHA-512-256",
+		},
+		{
+			name: "strongest algorithm offered",
+			challenges: []string{
+				`Digest realm="test", nonce="n1", qop="auth", algorithm=MD5`,
+				`Digest realm="test", nonce="n1", qop="auth", algorithm=SHA-256`,
+			},
+			sends:         1,
+			wantStatus:    http.StatusOK,
+			wantRequests:  2,
+			wantNC:        "00000001",
+			wantAlgorithm: "SHA-256",
+		},
+		{
+			name:         "challenge reused",
+			challenges:   []string{`Digest realm="test", nonce="n1", qop="auth"`},
+			sends:        2,
+			wantStatus:   http.StatusOK,
+			wantRequests: 3,
+			wantNC:       "00000002",
+		},
+		{
+			name:         "wrong password",
+			challenges:   []string{`Digest realm="test", nonce="n1", qop="auth"`},
+			password:     "wrong",
+			sends:        2,
+			wantStatus:   http.StatusUnauthorized,
+			wantRequests: 4,
+			wantNC:       "00000001",
+		},
+		{
+			name:         "unsupported qop",
+			challenges:   []string{`Digest realm="test", nonce="n1", qop="auth-int"`},
+			sends:        1,
+			wantStatus:   http.StatusUnauthorized,
+			wantError:    "unsupported Digest challenge",
+			wantRequests: 1,
+		},
+		{
+			name:         "no Digest challenge",
+			challenges:   []string{`Basic realm="test"`},
+			sends:        1,
+			wantStatus:   http.StatusUnauthorized,
+			wantRequests: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newDigestServer(t, test.challenges...)
+			engine := NewRequestEngine()
+			password := test.password
+			if password == "" {
+				password = "pass"
+			}
+			request := APIRequest{
+				Method: "GET",
+				URL:    server.URL + "/private?page=1",
+				Auth:   &RequestAuth{Type: AuthDigest, Digest: &DigestAuth{Username: "user", Password: password}},
+			}
+
+			var response APIResponse
+			for i := 0; i < test.sends; i++ {
+				response = engine.Execute(context.Background(), request)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status %d, want %d, error %q", response.StatusCode, test.wantStatus, response.Error)
+			}
+			if test.wantError == "" && response.Error != "" || !strings.Contains(response.Error, test.wantError) {
+				t.Fatalf("error %q, want %q", response.Error, test.wantError)
+			}
+			if server.requests != test.wantRequests {
+				t.Fatalf("%d requests, want %d", server.requests, test.wantRequests)
+			}
+			if len(server.answers) == 0 {
+				return
+			}
+			last := server.answers[len(server.answers)-1]
+			if last["uri"] != "/private?page=1" {
+				t.Fatalf("uri %q, want the request URI", last["uri"])
+			}
+			if last["algorithm"] != test.wantAlgorithm || last["nc"] != test.wantNC {
+				t.Fatalf("algorithm %q and nc %q, want %q and %q", last["algorithm"], last["nc"], test.wantAlgorithm, test.wantNC)
+			}
+		})
+	}
+}
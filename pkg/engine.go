@@ -0,0 +1,704 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultRequestTimeout is used when a request does not set its own timeout
+	DefaultRequestTimeout = 30 * time.Second
+	// DefaultMaxRedirects is the number of redirects followed when no limit is set
+	DefaultMaxRedirects = 10
+	// DefaultMaxBodySize is the largest response body kept in memory (10 MB)
+	DefaultMaxBodySize int64 = 10 << 20
+)
+
+// RequestOptions controls how the request engine sends a single request.
+// Zero values fall back to the engine defaults.
+type RequestOptions struct {
+	Timeout           time.Duration  `json:"timeout"` // milliseconds or a duration such as "1m30s" in JSON
+	Redirects         RedirectPolicy `json:"redirects"`
+	MaxBodySize       int64          `json:"maxBodySize"`
+	DisableKeepAlives bool           `json:"disableKeepAlives"`
+	TLS               *TLSOptions    `json:"tls,omitempty"`
+	Proxy             *ProxyOptions  `json:"proxy,omitempty"`
+	Retry             RetryPolicy    `json:"retry"`
+	Protocol          string         `json:"protocol,omitempty"` // http1, http2 or h2c, see ProtocolAuto
+
+	// authHeaders are the headers the request's auth sets, dropped with the
+	// other credentials when a redirect leaves the origin
+	authHeaders []string
+
+	// Connection targets. UnixSocket sends requests over a Unix domain socket,
+	// as does a unix:///path/to.sock:/request/path URL. Resolve maps "host" or
+	// "host:port" to the address to connect to instead, like curl --resolve;
+	// the Host header and TLS server name still use the URL host. Unix
+	// sockets need the engine's local access, UnixSocket is only settable
+	// from Go code.
+	UnixSocket string            `json:"-"`
+	Resolve    map[string]string `json:"resolve,omitempty"`
+
+	// Content codings. Responses are decoded unless DisableDecompression is
+	// set, in which case Accept-Encoding is not sent either.
+	DisableDecompression bool   `json:"disableDecompression,omitempty"`
+	CompressBody         string `json:"compressBody,omitempty"` // gzip, deflate, br or zstd
+
+	// Cookies is the jar used for the request and its redirects; the web API
+	// and test runs fill it in. DisableCookies sends the request without it.
+	Cookies        *CookieJar `json:"-"`
+	DisableCookies bool       `json:"disableCookies,omitempty"`
+
+	// Cache holds responses to GET requests when CacheMode is set; nil uses
+	// the engine's cache. CacheMode is one of CacheDefault, CacheNoCache,
+	// CacheReload or CacheNoStore, empty sends every request to the server.
+	Cache     *ResponseCache `json:"-"`
+	CacheMode string         `json:"cacheMode,omitempty"`
+
+	// EventStream subscribes to a text/event-stream response, see SSEOptions.
+	// The request then has no timeout unless Timeout is set.
+	EventStream *SSEOptions `json:"eventStream,omitempty"`
+	sse         *sseState
+
+	// WebSocket runs the request as a scripted WebSocket session, see
+	// WebSocketOptions; ws:// and wss:// URLs always do
+	WebSocket *WebSocketOptions `json:"webSocket,omitempty"`
+
+	// RateLimitScope selects the engine rate limit that applies, such as
+	// WorkspaceRateLimitScope; empty uses the global limit
+	RateLimitScope string `json:"-"`
+
+	// Environment is the ID of the environment the request is sent in, set
+	// by WithEnvironment; OAuth2 tokens are cached per environment
+	Environment string `json:"-"`
+
+	// OAuth2Tokens caches the tokens of OAuth2 auth; nil uses the engine's.
+	// The web API keeps one per user and workspace.
+	OAuth2Tokens *OAuth2TokenCache `json:"-"`
+
+	// Local file system options, only settable from Go code
+	SpillToFile bool         `json:"-"` // keep bodies over MaxBodySize in a temp file
+	SaveTo      string       `json:"-"` // stream the body to this file instead of memory
+	Progress    ProgressFunc `json:"-"` // called while saving to SaveTo
+}
+
+// UnmarshalJSON reads Timeout as milliseconds, or as a duration string such
+// as "500ms" or "2m"
+func (o *RequestOptions) UnmarshalJSON(data []byte) error {
+	type plain RequestOptions
+	decoded := struct {
+		*plain
+		Timeout json.RawMessage `json:"timeout"`
+	}{plain: (*plain)(o)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Timeout == nil {
+		return nil
+	}
+	timeout, err := parseJSONDuration(decoded.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %v", err)
+	}
+	o.Timeout = timeout
+	return nil
+}
+
+// MarshalJSON writes Timeout in milliseconds, as UnmarshalJSON reads it
+func (o RequestOptions) MarshalJSON() ([]byte, error) {
+	type plain RequestOptions
+	return json.Marshal(struct {
+		plain
+		Timeout float64 `json:"timeout"`
+	}{plain(o), float64(o.Timeout) / float64(time.Millisecond)})
+}
+
+// parseJSONDuration reads a JSON number of milliseconds or a duration string
+func parseJSONDuration(data json.RawMessage) (time.Duration, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return 0, err
+	}
+	switch value := value.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return time.Duration(value * float64(time.Millisecond)), nil
+	case string:
+		if milliseconds, err := strconv.ParseFloat(value, 64); err == nil {
+			return time.Duration(milliseconds * float64(time.Millisecond)), nil
+		}
+		return time.ParseDuration(value)
+	}
+	return 0, fmt.Errorf("expected milliseconds or a duration string, got %s", data)
+}
+
+// WithEnvironment fills settings the request leaves unset from the environment
+func (o RequestOptions) WithEnvironment(env *Environment) RequestOptions {
+	if env == nil {
+		return o
+	}
+	if o.TLS == nil {
+		o.TLS = env.TLS
+	}
+	if o.Proxy == nil {
+		o.Proxy = env.Proxy
+	}
+	o.Resolve = mergeResolve(env.Resolve, o.Resolve)
+	o.Environment = env.ID
+	return o
+}
+
+// RequestEngine sends every HTTP request made by RESTerX. It keeps one
+// transport per connection configuration so keep-alive connections are reused
+// between the CLI, the web API, test runs and monitors. At most
+// maxTransports are kept, the least recently used is dropped first.
+type RequestEngine struct {
+	mutex      sync.Mutex
+	transports map[string]*keptTransport
+	uses       uint64 // transport lookups, orders the transports by last use
+	proxy      *ProxyOptions
+	unixSocket string
+	resolve    map[string]string
+	protocol   string
+	cacheMode  string
+	cache      *ResponseCache
+	limiter    *RateLimiter
+
+	graphQLSchemas   *GraphQLSchemaCache
+	oauth2Tokens     *OAuth2TokenCache
+	digestChallenges *DigestChallenges
+	openBrowser      func(url string) error
+
+	localAccess atomic.Bool
+}
+
+var defaultEngine = NewRequestEngine()
+
+// NewRequestEngine creates a new request engine
+func NewRequestEngine() *RequestEngine {
+	return &RequestEngine{
+		transports: make(map[string]*keptTransport),
+		cache:      NewResponseCache(),
+		limiter:    NewRateLimiter(),
+
+		graphQLSchemas:   NewGraphQLSchemaCache(),
+		oauth2Tokens:     NewOAuth2TokenCache(),
+		digestChallenges: NewDigestChallenges(),
+	}
+}
+
+// DefaultEngine returns the engine shared by the package level helpers
+func DefaultEngine() *RequestEngine {
+	return defaultEngine
+}
+
+// SetProxy sets the proxy used by requests that do not configure their own.
+// Passing nil restores the HTTP_PROXY/HTTPS_PROXY/NO_PROXY variables.
+func (e *RequestEngine) SetProxy(proxy *ProxyOptions) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.proxy = proxy
+}
+
+// SetUnixSocket sends requests that do not set their own target over the
+// Unix socket at path. An empty path restores normal connections.
+func (e *RequestEngine) SetUnixSocket(path string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.unixSocket = path
+}
+
+// SetLocalAccess lets requests use the machine the engine runs on: reading
+// TLS certificates and keys, form files, .proto files and WSDLs given as
+// paths, connecting to Unix sockets, reading AWS credentials from the process
+// environment, and opening a browser and a redirect listener for the OAuth2
+// authorization_code grant. The CLI allows it; the web server does not, its
+// users must not use the server's files, ports or credentials.
+func (e *RequestEngine) SetLocalAccess(allow bool) {
+	e.localAccess.Store(allow)
+}
+
+// SetResolve sets host overrides applied under those of requests and environments
+func (e *RequestEngine) SetResolve(resolve map[string]string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.resolve = resolve
+}
+
+// SetProtocol sets the protocol of requests that do not choose their own
+func (e *RequestEngine) SetProtocol(protocol string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.protocol = protocol
+}
+
+// SetCacheMode sets the cache mode of requests that do not choose their own
+func (e *RequestEngine) SetCacheMode(mode string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.cacheMode = mode
+}
+
+// SetRateLimit sets the per-host rate limit of a scope, see RateLimiter.SetLimit
+func (e *RequestEngine) SetRateLimit(scope string, limit *RateLimit) {
+	e.limiter.SetLimit(scope, limit)
+}
+
+// RateLimit returns the per-host rate limit that applies to a scope
+func (e *RequestEngine) RateLimit(scope string) RateLimit {
+	return e.limiter.Limit(scope)
+}
+
+// Execute sends the request and returns the structured response, answering
+// from the response cache when the cache mode allows and retrying as the
+// request's RetryPolicy allows. Cancelling ctx aborts the request, including
+// while the body is being read or between attempts.
+func (e *RequestEngine) Execute(ctx context.Context, request APIRequest) APIResponse {
+	if request.Auth != nil {
+		request.Options.authHeaders = append(request.Auth.headerNames(), request.Options.authHeaders...)
+		switch request.Auth.Type {
+		case AuthOAuth2:
+			return e.executeOAuth2(ctx, request)
+		case AuthDigest:
+			// Protocol requests answer the challenge once built, as that
+			// may change their method
+			if request.GraphQL == nil && request.JSONRPC == nil && request.SOAP == nil {
+				return e.executeDigest(ctx, request)
+			}
+		case AuthAWSSigV4:
+			// Signed in send, once the body and headers are final
+			if request.Auth.AWS == nil {
+				return APIResponse{Error: "AWS SigV4 auth has no settings"}
+			}
+		case AuthHMAC:
+			if request.Auth.HMAC == nil {
+				return APIResponse{Error: "HMAC auth has no settings"}
+			}
+		default:
+			authorized, err := applyAuth(request)
+			if err != nil {
+				return APIResponse{Error: err.Error()}
+			}
+			request = authorized
+		}
+	}
+
+	switch {
+	case request.GraphQL != nil:
+		return e.executeGraphQL(ctx, request)
+	case request.JSONRPC != nil:
+		return e.executeJSONRPC(ctx, request)
+	case request.SOAP != nil:
+		return e.executeSOAP(ctx, request)
+	}
+
+	opts := request.Options
+	e.mutex.Lock()
+	if opts.Proxy == nil {
+		opts.Proxy = e.proxy
+	}
+	if opts.UnixSocket == "" {
+		opts.UnixSocket = e.unixSocket
+	}
+	if opts.Protocol == ProtocolAuto {
+		opts.Protocol = e.protocol
+	}
+	if opts.CacheMode == "" {
+		opts.CacheMode = e.cacheMode
+	}
+	if opts.Cache == nil {
+		opts.Cache = e.cache
+	}
+	opts.Resolve = mergeResolve(e.resolve, opts.Resolve)
+	e.mutex.Unlock()
+
+	// Event streams are neither cached nor retried, they reconnect instead
+	if opts.EventStream != nil {
+		return e.stream(ctx, request, opts)
+	}
+	if opts.WebSocket != nil || isWebSocketURL(request.URL) {
+		return e.webSocket(ctx, request, opts)
+	}
+	if request.GRPC != nil {
+		return e.grpcCall(ctx, request, opts)
+	}
+
+	switch opts.CacheMode {
+	case "", CacheNoStore:
+		return e.execute(ctx, request, opts)
+	case CacheDefault, CacheNoCache, CacheReload:
+		return opts.Cache.execute(ctx, request, opts, e.execute)
+	default:
+		return APIResponse{Error: fmt.Sprintf("unknown cache mode %q", opts.CacheMode)}
+	}
+}
+
+// execute sends the request, retrying as the retry policy allows
+func (e *RequestEngine) execute(ctx context.Context, request APIRequest, opts RequestOptions) APIResponse {
+	start := time.Now()
+
+	policy := opts.Retry
+	if !policy.allows(request) {
+		response, _ := e.send(ctx, request, opts)
+		return response
+	}
+
+	var attempts []RetryAttempt
+	for attempt := 1; ; attempt++ {
+		attemptStart := time.Now()
+		response, failed := e.send(ctx, request, opts)
+
+		record := RetryAttempt{
+			Attempt:    attempt,
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Error:      response.Error,
+			Duration:   time.Since(attemptStart),
+		}
+
+		wait, retry := policy.next(attempt, response, failed)
+		if retry && ctx.Err() == nil {
+			record.Wait = wait
+			if response.BodyFile != "" && opts.SaveTo == "" {
+				os.Remove(response.BodyFile)
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+				attempts = append(attempts, record)
+				continue
+			case <-ctx.Done():
+				// Cancelled while waiting, there is no next attempt
+				timer.Stop()
+				record.Wait = 0
+			}
+		}
+
+		response.Attempts = append(attempts, record)
+		response.ResponseTime = time.Since(start)
+		return response
+	}
+}
+
+// send makes a single attempt at the request. failed is set when no
+// response was received, which is when a retry may help.
+func (e *RequestEngine) send(ctx context.Context, request APIRequest, opts RequestOptions) (response APIResponse, failed bool) {
+	start := time.Now()
+
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	target := request.FullURL()
+	if socket, httpURL, ok := splitUnixURL(target); ok {
+		if !e.localAccess.Load() {
+			return APIResponse{Error: errUnixSocketDenied.Error(), ResponseTime: time.Since(start)}, false
+		}
+		target, opts.UnixSocket = httpURL, socket
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err == nil {
+		err = checkProtocolTarget(opts.Protocol, req.URL.Scheme)
+	}
+	if err != nil {
+		return APIResponse{
+			Error:        err.Error(),
+			ResponseTime: time.Since(start),
+		}, false
+	}
+
+	for _, field := range request.HeaderFields() {
+		if strings.EqualFold(field.Name, "Host") {
+			req.Host = field.Value
+			continue
+		}
+		req.Header.Add(field.Name, field.Value)
+	}
+
+	if !opts.DisableDecompression && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	body, err := buildRequestBody(request, e.localAccess.Load())
+	if err == nil && body != nil && opts.CompressBody != "" {
+		body, err = compressBody(body, opts.CompressBody)
+	}
+	if err != nil {
+		return APIResponse{
+			Error:        err.Error(),
+			ResponseTime: time.Since(start),
+		}, false
+	}
+	if body != nil {
+		if err := attachBody(req, body); err != nil {
+			return APIResponse{
+				Error:        err.Error(),
+				ResponseTime: time.Since(start),
+			}, false
+		}
+	}
+	if err := signRequest(req, body, request.Auth, time.Now(), e.localAccess.Load()); err != nil {
+		return APIResponse{
+			Error:        err.Error(),
+			ResponseTime: time.Since(start),
+		}, false
+	}
+
+	transport, err := e.transportFor(opts)
+	if err != nil {
+		return APIResponse{
+			Error:        err.Error(),
+			ResponseTime: time.Since(start),
+		}, false
+	}
+
+	// Wait for the rate limit of the first host before the timeout starts.
+	// Redirects to other hosts are not limited.
+	limitKey := req.URL.Host
+	if opts.UnixSocket != "" {
+		limitKey = unixURLPrefix + opts.UnixSocket
+	}
+	queued, release, err := e.limiter.acquire(ctx, opts.RateLimitScope, limitKey)
+	if err != nil {
+		return APIResponse{
+			Error:        "Waiting for rate limit: " + err.Error(),
+			Timing:       &ResponseTiming{Queued: queued},
+			ResponseTime: time.Since(start),
+		}, false
+	}
+	defer release()
+	start = time.Now()
+
+	timeout := opts.Timeout
+	if timeout <= 0 && opts.EventStream == nil {
+		timeout = DefaultRequestTimeout
+	}
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	// Redirects are followed by the policy so that each hop is recorded
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if opts.Cookies != nil && !opts.DisableCookies {
+		client.Jar = opts.Cookies
+	}
+
+	resp, tracer, hops, redirectErr := opts.Redirects.follow(ctx, client, req, body, opts.authHeaders)
+	if resp == nil {
+		timing := tracer.finish()
+		timing.Queued = queued
+		return APIResponse{
+			Redirects:    hops,
+			Error:        redirectErr.Error(),
+			Timing:       timing,
+			ResponseTime: time.Since(start),
+		}, true
+	}
+	defer resp.Body.Close()
+
+	response = APIResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Protocol:   protocolName(resp),
+		Headers:    convertHeaders(resp.Header),
+		RawHeaders: tracer.headers(resp.Header),
+		TLS:        newTLSInfo(resp.TLS),
+		Redirects:  hops,
+	}
+
+	if err := readResponseBody(resp, opts, &response); err != nil {
+		response.Error = "Error reading response body: " + err.Error()
+	}
+	if redirectErr != nil {
+		response.Error = redirectErr.Error()
+	}
+	if err := checkNegotiated(opts.Protocol, resp); err != nil {
+		response.Error = err.Error()
+	}
+
+	response.Timing = tracer.finish()
+	response.Timing.Queued = queued
+	response.ResponseTime = time.Since(start)
+	return response, false
+}
+
+// attachBody sets the body of req so it can be replayed by the transport
+func attachBody(req *http.Request, body *requestBody) error {
+	reader, err := body.open()
+	if err != nil {
+		return err
+	}
+
+	req.Body = reader
+	req.GetBody = body.open
+	req.ContentLength = body.contentLength
+
+	// The boundary is generated here, so a multipart type always wins
+	if strings.HasPrefix(body.contentType, "multipart/") || (body.contentType != "" && req.Header.Get("Content-Type") == "") {
+		req.Header.Set("Content-Type", body.contentType)
+	}
+	if body.contentEncoding != "" {
+		req.Header.Set("Content-Encoding", body.contentEncoding)
+	}
+	return nil
+}
+
+// transportKey holds the options that need a transport of their own
+type transportKey struct {
+	DisableKeepAlives bool              `json:"disableKeepAlives"`
+	Protocol          string            `json:"protocol"`
+	TLS               *TLSOptions       `json:"tls"`
+	Proxy             *ProxyOptions     `json:"proxy"`
+	UnixSocket        string            `json:"unixSocket"`
+	Resolve           map[string]string `json:"resolve"`
+}
+
+// maxTransports bounds the transports kept for distinct connection settings,
+// which requests from the web API may vary freely
+const maxTransports = 64
+
+// keptTransport is a transport of the engine with when it was last used
+type keptTransport struct {
+	transport http.RoundTripper
+	lastUsed  uint64
+}
+
+// transportFor returns the shared transport matching the connection related options
+func (e *RequestEngine) transportFor(opts RequestOptions) (http.RoundTripper, error) {
+	keyData, err := json.Marshal(transportKey{
+		DisableKeepAlives: opts.DisableKeepAlives,
+		Protocol:          opts.Protocol,
+		TLS:               opts.TLS,
+		Proxy:             opts.Proxy,
+		UnixSocket:        opts.UnixSocket,
+		Resolve:           opts.Resolve,
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := string(keyData)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.uses++
+	if kept, exists := e.transports[key]; exists {
+		kept.lastUsed = e.uses
+		return kept.transport, nil
+	}
+
+	tlsConfig, err := buildTLSConfig(opts.TLS, e.localAccess.Load())
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := proxyFunc(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UnixSocket != "" {
+		// The socket is the destination, there is nothing to proxy
+		proxy = nil
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if opts.Protocol == ProtocolH2C {
+		if opts.Proxy != nil && !opts.Proxy.Disabled && opts.Proxy.URL != "" {
+			return nil, fmt.Errorf("h2c requests cannot go through a proxy")
+		}
+		transport := newH2CTransport(dialFunc(dialer, opts.UnixSocket, opts.Resolve))
+		e.keepTransport(key, transport)
+		return transport, nil
+	}
+
+	dial := dialFunc(dialer, opts.UnixSocket, opts.Resolve)
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           recordingDial(dial),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     opts.DisableKeepAlives,
+		TLSClientConfig:       tlsConfig,
+		// Bodies are decoded by readResponseBody, which also reports the wire size
+		DisableCompression: true,
+	}
+	// Heads of HTTP/1.1 responses are read above TLS to keep their order
+	transport.DialTLSContext = recordingDialTLS(transport, dial)
+	switch opts.Protocol {
+	case ProtocolHTTP1:
+		disableHTTP2(transport)
+	case ProtocolHTTP2:
+		if err := requireHTTP2(transport); err != nil {
+			return nil, err
+		}
+	}
+	e.keepTransport(key, transport)
+	return transport, nil
+}
+
+// keepTransport stores a new transport, first dropping the least recently
+// used one when maxTransports are kept. The connections of the dropped
+// transport close once idle; requests still using it complete. The caller
+// holds the mutex.
+func (e *RequestEngine) keepTransport(key string, transport http.RoundTripper) {
+	if len(e.transports) >= maxTransports {
+		var oldestKey string
+		var oldest *keptTransport
+		for key, kept := range e.transports {
+			if oldest == nil || kept.lastUsed < oldest.lastUsed {
+				oldestKey, oldest = key, kept
+			}
+		}
+		delete(e.transports, oldestKey)
+		closeIdleConnections(oldest.transport)
+	}
+	e.transports[key] = &keptTransport{transport: transport, lastUsed: e.uses}
+}
+
+// closeIdleConnections closes the idle keep-alive connections of a transport
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections closes idle keep-alive connections on every transport
+func (e *RequestEngine) CloseIdleConnections() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, kept := range e.transports {
+		closeIdleConnections(kept.transport)
+	}
+}
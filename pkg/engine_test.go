@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransportEviction(t *testing.T) {
+	var mutex sync.Mutex
+	opened, closed := 0, 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch state {
+		case http.StateNew:
+			opened++
+		case http.StateClosed:
+			closed++
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	counts := func() (int, int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return opened, closed
+	}
+
+	engine := NewRequestEngine()
+	send := func(i int) {
+		t.Helper()
+		// Every distinct Resolve needs a transport of its own
+		request := APIRequest{Method: "GET", URL: server.URL, Options: RequestOptions{
+			Resolve: map[string]string{fmt.Sprintf("unused-%d", i): "127.0.0.1"},
+		}}
+		if response := engine.Execute(context.Background(), request); response.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d, error %q", i, response.StatusCode, response.Error)
+		}
+	}
+
+	for i := 0; i < maxTransports; i++ {
+		send(i)
+	}
+	// The first transport is used again, the second is now the least recent
+	send(0)
+	if opened, closed := counts(); opened != maxTransports || closed != 0 {
+		t.Fatalf("%d connections opened and %d closed, want %d and 0", opened, closed, maxTransports)
+	}
+
+	send(maxTransports)
+	if got := len(engine.transports); got != maxTransports {
+		t.Fatalf("%d transports kept, want %d", got, maxTransports)
+	}
+
+	// The idle connection of the dropped transport is closed
+	deadline := time.Now().Add(5 * time.Second)
+	for _, closed := counts(); closed != 1; _, closed = counts() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections closed, want 1", closed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The recently used transport still has its connection, the dropped one dials again
+	send(0)
+	send(1)
+	if opened, _ := counts(); opened != maxTransports+2 {
+		t.Fatalf("%d connections opened, want %d", opened, maxTransports+2)
+	}
+}
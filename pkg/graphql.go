@@ -0,0 +1,684 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphQLRequest makes a request a GraphQL operation. The body is built
+// from these fields: a JSON POST by default, or query parameters when the
+// request method is GET.
+type GraphQLRequest struct {
+	Query          string                 `json:"query"`
+	OperationName  string                 `json:"operationName,omitempty"`
+	Variables      map[string]interface{} `json:"variables,omitempty"`
+	SkipValidation bool                   `json:"skipValidation,omitempty"` // send without checking against a cached schema
+}
+
+// GraphQLError is an entry of the errors list of a GraphQL response
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation is a position in the query, starting at line 1, column 1
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e GraphQLError) Error() string {
+	if len(e.Locations) > 0 {
+		return fmt.Sprintf("%s (%d:%d)", e.Message, e.Locations[0].Line, e.Locations[0].Column)
+	}
+	return e.Message
+}
+
+// substitute returns a copy with replace applied to the query and to every
+// string in the variables
+func (g *GraphQLRequest) substitute(replace func(string) string) *GraphQLRequest {
+	if g == nil {
+		return nil
+	}
+	copied := *g
+	copied.Query = replace(g.Query)
+	if g.Variables != nil {
+		copied.Variables = substituteJSON(g.Variables, replace).(map[string]interface{})
+	}
+	return &copied
+}
+
+func substituteJSON(value interface{}, replace func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return replace(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = substituteJSON(item, replace)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = substituteJSON(item, replace)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// payload returns the JSON body of the operation
+func (g *GraphQLRequest) payload() ([]byte, error) {
+	body := map[string]interface{}{"query": g.Query}
+	if g.OperationName != "" {
+		body["operationName"] = g.OperationName
+	}
+	if len(g.Variables) > 0 {
+		body["variables"] = g.Variables
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(body); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// expandGraphQL turns a GraphQL request into the plain HTTP request sent for it
+func expandGraphQL(request APIRequest) (APIRequest, error) {
+	graphQL := request.GraphQL
+	request.GraphQL = nil
+
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "POST"
+	}
+	request.Method = method
+
+	if method == "GET" {
+		// GraphQL over HTTP: the operation goes in the query string
+		request.QueryParams = append(append([]QueryParam{}, request.QueryParams...), QueryParam{Name: "query", Value: graphQL.Query})
+		if graphQL.OperationName != "" {
+			request.QueryParams = append(request.QueryParams, QueryParam{Name: "operationName", Value: graphQL.OperationName})
+		}
+		if len(graphQL.Variables) > 0 {
+			variables, err := json.Marshal(graphQL.Variables)
+			if err != nil {
+				return request, err
+			}
+			request.QueryParams = append(request.QueryParams, QueryParam{Name: "variables", Value: string(variables)})
+		}
+		request.Body, request.BodyType, request.Form = "", "", nil
+	} else {
+		body, err := graphQL.payload()
+		if err != nil {
+			return request, err
+		}
+		request.Body, request.BodyType, request.Form = string(body), BodyTypeRaw, nil
+		if !request.HeaderFields().Has("Content-Type") {
+			request.RawHeaders = append(append(HeaderList{}, request.RawHeaders...), HeaderField{Name: "Content-Type", Value: "application/json"})
+		}
+	}
+
+	if !request.HeaderFields().Has("Accept") {
+		request.RawHeaders = append(append(HeaderList{}, request.RawHeaders...), HeaderField{Name: "Accept", Value: "application/graphql-response+json, application/json"})
+	}
+	return request, nil
+}
+
+// parseGraphQLErrors returns the errors list of a GraphQL response body
+func parseGraphQLErrors(body string) []GraphQLError {
+	var result struct {
+		Errors []GraphQLError `json:"errors"`
+	}
+	if json.Unmarshal([]byte(body), &result) != nil {
+		return nil
+	}
+	return result.Errors
+}
+
+// executeGraphQL validates the operation against the cached schema of the
+// endpoint, if there is one, and sends it
+func (e *RequestEngine) executeGraphQL(ctx context.Context, request APIRequest) APIResponse {
+	start := time.Now()
+
+	if !request.GraphQL.SkipValidation {
+		if schema := e.graphQLSchemas.Get(request.URL); schema != nil {
+			if errs := schema.Validate(request.GraphQL.Query, request.GraphQL.OperationName, request.GraphQL.Variables); len(errs) > 0 {
+				return APIResponse{
+					Error:         "GraphQL validation failed: " + errs[0].Error(),
+					GraphQLErrors: errs,
+					ResponseTime:  time.Since(start),
+				}
+			}
+		}
+	}
+
+	expanded, err := expandGraphQL(request)
+	if err != nil {
+		return APIResponse{Error: err.Error(), ResponseTime: time.Since(start)}
+	}
+	response := e.Execute(ctx, expanded)
+	response.GraphQLErrors = parseGraphQLErrors(response.Body)
+	return response
+}
+
+// GraphQLSchema is the part of an introspected schema used to validate
+// operations and describe them in generated code
+type GraphQLSchema struct {
+	Endpoint         string                  `json:"endpoint"`
+	QueryType        string                  `json:"queryType"`
+	MutationType     string                  `json:"mutationType,omitempty"`
+	SubscriptionType string                  `json:"subscriptionType,omitempty"`
+	Types            map[string]*GraphQLType `json:"types"`
+	FetchedAt        time.Time               `json:"fetchedAt"`
+}
+
+// GraphQLType is a named type of a schema
+type GraphQLType struct {
+	Kind          string                      `json:"kind"` // SCALAR, OBJECT, INTERFACE, UNION, ENUM or INPUT_OBJECT
+	Name          string                      `json:"name"`
+	Fields        map[string]*GraphQLField    `json:"fields,omitempty"`
+	InputFields   map[string]*GraphQLArgument `json:"inputFields,omitempty"`
+	PossibleTypes []string                    `json:"possibleTypes,omitempty"`
+	EnumValues    []string                    `json:"enumValues,omitempty"`
+}
+
+// GraphQLField is a field of an object or interface type
+type GraphQLField struct {
+	Type string                      `json:"type"` // in SDL notation, e.g. [User!]!
+	Args map[string]*GraphQLArgument `json:"args,omitempty"`
+}
+
+// GraphQLArgument is an argument of a field or a field of an input type
+type GraphQLArgument struct {
+	Type       string `json:"type"`
+	HasDefault bool   `json:"hasDefault,omitempty"`
+}
+
+// graphQLIntrospectionQuery fetches what GraphQLSchema keeps
+const graphQLIntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind
+      name
+      fields(includeDeprecated: true) {
+        name
+        args { name defaultValue type { ...TypeRef } }
+        type { ...TypeRef }
+      }
+      inputFields { name defaultValue type { ...TypeRef } }
+      possibleTypes { name }
+      enumValues(includeDeprecated: true) { name }
+    }
+  }
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } }
+}`
+
+// introspectionTypeRef is a type reference as returned by introspection
+type introspectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   string                `json:"name"`
+	OfType *introspectionTypeRef `json:"ofType"`
+}
+
+// String formats the reference in SDL notation
+func (t *introspectionTypeRef) String() string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	default:
+		return t.Name
+	}
+}
+
+type introspectionInputValue struct {
+	Name         string                `json:"name"`
+	DefaultValue *string               `json:"defaultValue"`
+	Type         *introspectionTypeRef `json:"type"`
+}
+
+type introspectionResult struct {
+	Data *struct {
+		Schema struct {
+			QueryType        *struct{ Name string } `json:"queryType"`
+			MutationType     *struct{ Name string } `json:"mutationType"`
+			SubscriptionType *struct{ Name string } `json:"subscriptionType"`
+			Types            []struct {
+				Kind   string `json:"kind"`
+				Name   string `json:"name"`
+				Fields []struct {
+					Name string                    `json:"name"`
+					Args []introspectionInputValue `json:"args"`
+					Type *introspectionTypeRef     `json:"type"`
+				} `json:"fields"`
+				InputFields   []introspectionInputValue `json:"inputFields"`
+				PossibleTypes []struct{ Name string }   `json:"possibleTypes"`
+				EnumValues    []struct{ Name string }   `json:"enumValues"`
+			} `json:"types"`
+		} `json:"__schema"`
+	} `json:"data"`
+	Errors []GraphQLError `json:"errors"`
+}
+
+// newGraphQLSchema builds a schema from an introspection response body
+func newGraphQLSchema(endpoint, body string) (*GraphQLSchema, error) {
+	var result introspectionResult
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		return nil, fmt.Errorf("introspection response is not JSON: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("introspection failed: %s", result.Errors[0].Error())
+	}
+	if result.Data == nil || result.Data.Schema.QueryType == nil {
+		return nil, fmt.Errorf("introspection response has no schema")
+	}
+
+	source := result.Data.Schema
+	schema := &GraphQLSchema{
+		Endpoint:  endpoint,
+		QueryType: source.QueryType.Name,
+		Types:     make(map[string]*GraphQLType, len(source.Types)),
+		FetchedAt: time.Now(),
+	}
+	if source.MutationType != nil {
+		schema.MutationType = source.MutationType.Name
+	}
+	if source.SubscriptionType != nil {
+		schema.SubscriptionType = source.SubscriptionType.Name
+	}
+
+	arguments := func(values []introspectionInputValue) map[string]*GraphQLArgument {
+		if len(values) == 0 {
+			return nil
+		}
+		result := make(map[string]*GraphQLArgument, len(values))
+		for _, value := range values {
+			result[value.Name] = &GraphQLArgument{Type: value.Type.String(), HasDefault: value.DefaultValue != nil}
+		}
+		return result
+	}
+
+	for _, source := range source.Types {
+		typ := &GraphQLType{Kind: source.Kind, Name: source.Name, InputFields: arguments(source.InputFields)}
+		if len(source.Fields) > 0 {
+			typ.Fields = make(map[string]*GraphQLField, len(source.Fields))
+			for _, field := range source.Fields {
+				typ.Fields[field.Name] = &GraphQLField{Type: field.Type.String(), Args: arguments(field.Args)}
+			}
+		}
+		for _, possible := range source.PossibleTypes {
+			typ.PossibleTypes = append(typ.PossibleTypes, possible.Name)
+		}
+		for _, value := range source.EnumValues {
+			typ.EnumValues = append(typ.EnumValues, value.Name)
+		}
+		schema.Types[typ.Name] = typ
+	}
+	return schema, nil
+}
+
+// GraphQLSchemaCache keeps the introspected schema of each endpoint URL
+type GraphQLSchemaCache struct {
+	mutex   sync.Mutex
+	schemas map[string]*GraphQLSchema
+}
+
+// NewGraphQLSchemaCache creates an empty schema cache
+func NewGraphQLSchemaCache() *GraphQLSchemaCache {
+	return &GraphQLSchemaCache{schemas: make(map[string]*GraphQLSchema)}
+}
+
+// Get returns the cached schema of an endpoint, or nil
+func (c *GraphQLSchemaCache) Get(endpoint string) *GraphQLSchema {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.schemas[endpoint]
+}
+
+// Set caches the schema of its endpoint
+func (c *GraphQLSchemaCache) Set(schema *GraphQLSchema) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.schemas[schema.Endpoint] = schema
+}
+
+// Remove drops the schema of an endpoint, or of every endpoint when empty
+func (c *GraphQLSchemaCache) Remove(endpoint string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if endpoint == "" {
+		c.schemas = make(map[string]*GraphQLSchema)
+		return
+	}
+	delete(c.schemas, endpoint)
+}
+
+// GraphQLSchemas returns the engine's introspected schemas; operations sent
+// to an endpoint with a cached schema are validated against it
+func (e *RequestEngine) GraphQLSchemas() *GraphQLSchemaCache {
+	return e.graphQLSchemas
+}
+
+// IntrospectGraphQL fetches the schema of the endpoint at request.URL with
+// the request's headers and options and caches it. A cached schema is
+// returned without a request unless refresh is set.
+func (e *RequestEngine) IntrospectGraphQL(ctx context.Context, request APIRequest, refresh bool) (*GraphQLSchema, error) {
+	if !refresh {
+		if schema := e.graphQLSchemas.Get(request.URL); schema != nil {
+			return schema, nil
+		}
+	}
+
+	request.Method = "POST"
+	request.GraphQL = &GraphQLRequest{Query: graphQLIntrospectionQuery, OperationName: "IntrospectionQuery", SkipValidation: true}
+	response := e.Execute(ctx, request)
+	if response.Error != "" {
+		return nil, fmt.Errorf("%s", response.Error)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, fmt.Errorf("introspection failed with status %s", response.Status)
+	}
+
+	schema, err := newGraphQLSchema(request.URL, response.Body)
+	if err != nil {
+		return nil, err
+	}
+	e.graphQLSchemas.Set(schema)
+	return schema, nil
+}
+
+// rootType returns the root type of an operation kind
+func (s *GraphQLSchema) rootType(kind string) string {
+	switch kind {
+	case "mutation":
+		return s.MutationType
+	case "subscription":
+		return s.SubscriptionType
+	default:
+		return s.QueryType
+	}
+}
+
+// namedType strips list and non-null markers from an SDL type
+func namedType(sdl string) string {
+	return strings.Trim(sdl, "[]!")
+}
+
+// isComposite reports whether selections can be made on a type
+func (t *GraphQLType) isComposite() bool {
+	return t.Kind == "OBJECT" || t.Kind == "INTERFACE" || t.Kind == "UNION"
+}
+
+// graphQLValidator collects the errors of one operation
+type graphQLValidator struct {
+	schema    *GraphQLSchema
+	document  *gqlDocument
+	errors    []GraphQLError
+	used      map[string]bool // variables referenced
+	fragments map[string]bool // fragments being visited, to catch cycles
+}
+
+func (v *graphQLValidator) errorf(line, column int, format string, args ...interface{}) {
+	err := GraphQLError{Message: fmt.Sprintf(format, args...)}
+	if line > 0 {
+		err.Locations = []GraphQLLocation{{Line: line, Column: column}}
+	}
+	v.errors = append(v.errors, err)
+}
+
+// Validate checks an operation against the schema: the document parses,
+// the operation exists, fields, arguments, fragments and variables are
+// known and used correctly, and required arguments and variables are
+// given. It returns nil when the operation is valid.
+func (s *GraphQLSchema) Validate(query, operationName string, variables map[string]interface{}) []GraphQLError {
+	document, err := parseGraphQL(query)
+	if err != nil {
+		if syntaxErr, ok := err.(*GraphQLSyntaxError); ok {
+			return []GraphQLError{{Message: "Syntax error: " + syntaxErr.Message, Locations: []GraphQLLocation{{Line: syntaxErr.Line, Column: syntaxErr.Column}}}}
+		}
+		return []GraphQLError{{Message: err.Error()}}
+	}
+	operation, err := document.operationNamed(operationName)
+	if err != nil {
+		return []GraphQLError{{Message: err.Error()}}
+	}
+
+	v := &graphQLValidator{schema: s, document: document, used: make(map[string]bool), fragments: make(map[string]bool)}
+
+	root := s.rootType(operation.kind)
+	if root == "" {
+		v.errorf(operation.line, operation.column, "the schema does not support %s operations", operation.kind)
+		return v.errors
+	}
+	rootType := s.Types[root]
+	if rootType == nil {
+		v.errorf(operation.line, operation.column, "the schema names %s as its %s type but does not define it", root, operation.kind)
+		return v.errors
+	}
+
+	defined := make(map[string]bool)
+	for _, definition := range operation.variables {
+		if defined[definition.name] {
+			v.errorf(definition.line, definition.column, "variable $%s is defined more than once", definition.name)
+		}
+		defined[definition.name] = true
+
+		typ := s.Types[definition.typ.namedType()]
+		switch {
+		case typ == nil:
+			v.errorf(definition.line, definition.column, "unknown type %s of variable $%s", definition.typ.namedType(), definition.name)
+		case typ.Kind != "SCALAR" && typ.Kind != "ENUM" && typ.Kind != "INPUT_OBJECT":
+			v.errorf(definition.line, definition.column, "variable $%s has type %s, which is not an input type", definition.name, typ.Name)
+		}
+
+		value, given := variables[definition.name]
+		if definition.typ.nonNull && (!given || value == nil) {
+			v.errorf(definition.line, definition.column, "variable $%s of type %s is required", definition.name, definition.typ)
+		}
+	}
+
+	v.selections(operation.selections, rootType)
+
+	for name := range v.used {
+		if !defined[name] {
+			v.errorf(operation.line, operation.column, "variable $%s is used but not defined", name)
+		}
+	}
+	for _, definition := range operation.variables {
+		if !v.used[definition.name] {
+			v.errorf(definition.line, definition.column, "variable $%s is defined but not used", definition.name)
+		}
+	}
+
+	// Errors found while walking a map come out in random order
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		a, b := v.errors[i].Locations, v.errors[j].Locations
+		if len(a) == 0 || len(b) == 0 {
+			return len(a) > len(b)
+		}
+		return a[0].Line < b[0].Line || (a[0].Line == b[0].Line && a[0].Column < b[0].Column)
+	})
+	return v.errors
+}
+
+// selections validates a selection set made on parent
+func (v *graphQLValidator) selections(selections []*gqlSelection, parent *GraphQLType) {
+	for _, selection := range selections {
+		switch selection.kind {
+		case gqlField:
+			v.field(selection, parent)
+
+		case gqlInlineFragment:
+			typ := parent
+			if selection.typeCondition != "" {
+				if typ = v.typeCondition(selection.typeCondition, selection.line, selection.column); typ == nil {
+					continue
+				}
+			}
+			v.selections(selection.selections, typ)
+
+		case gqlFragmentSpread:
+			fragment, exists := v.document.fragments[selection.name]
+			if !exists {
+				v.errorf(selection.line, selection.column, "unknown fragment %q", selection.name)
+				continue
+			}
+			if v.fragments[fragment.name] {
+				v.errorf(selection.line, selection.column, "fragment %q spreads itself", fragment.name)
+				continue
+			}
+			typ := v.typeCondition(fragment.typeCondition, fragment.line, fragment.column)
+			if typ == nil {
+				continue
+			}
+			v.fragments[fragment.name] = true
+			v.selections(fragment.selections, typ)
+			delete(v.fragments, fragment.name)
+		}
+	}
+}
+
+// typeCondition returns the composite type a fragment applies to
+func (v *graphQLValidator) typeCondition(name string, line, column int) *GraphQLType {
+	typ := v.schema.Types[name]
+	if typ == nil {
+		v.errorf(line, column, "unknown type %s in fragment", name)
+		return nil
+	}
+	if !typ.isComposite() {
+		v.errorf(line, column, "fragment cannot apply to %s type %s", strings.ToLower(typ.Kind), name)
+		return nil
+	}
+	return typ
+}
+
+// field validates a field selected on parent and its own selections
+func (v *graphQLValidator) field(selection *gqlSelection, parent *GraphQLType) {
+	for _, argument := range selection.arguments {
+		for _, name := range argument.value.variables() {
+			v.used[name] = true
+		}
+	}
+
+	// Meta fields
+	switch {
+	case selection.name == "__typename":
+		if len(selection.selections) > 0 {
+			v.errorf(selection.line, selection.column, "field __typename of type String! must not have a selection")
+		}
+		return
+	case (selection.name == "__schema" || selection.name == "__type") && parent.Name == v.schema.QueryType:
+		return
+	}
+
+	if parent.Kind == "UNION" {
+		v.errorf(selection.line, selection.column, "cannot query field %q on union %s, use a fragment on one of its types", selection.name, parent.Name)
+		return
+	}
+	field, exists := parent.Fields[selection.name]
+	if !exists {
+		v.errorf(selection.line, selection.column, "cannot query field %q on type %s%s", selection.name, parent.Name, v.suggest(selection.name, parent))
+		return
+	}
+
+	given := make(map[string]bool)
+	for _, argument := range selection.arguments {
+		given[argument.name] = true
+		if _, exists := field.Args[argument.name]; !exists {
+			v.errorf(selection.line, selection.column, "unknown argument %q on field %s.%s", argument.name, parent.Name, selection.name)
+		}
+	}
+	for _, name := range sortedKeys(field.Args) {
+		argument := field.Args[name]
+		if strings.HasSuffix(argument.Type, "!") && !argument.HasDefault && !given[name] {
+			v.errorf(selection.line, selection.column, "field %s.%s requires argument %q of type %s", parent.Name, selection.name, name, argument.Type)
+		}
+	}
+
+	typ := v.schema.Types[namedType(field.Type)]
+	if typ == nil {
+		return
+	}
+	switch {
+	case typ.isComposite() && len(selection.selections) == 0:
+		v.errorf(selection.line, selection.column, "field %q of type %s must have a selection of subfields", selection.name, field.Type)
+	case !typ.isComposite() && len(selection.selections) > 0:
+		v.errorf(selection.line, selection.column, "field %q of type %s must not have a selection", selection.name, field.Type)
+	case typ.isComposite():
+		v.selections(selection.selections, typ)
+	}
+}
+
+// suggest names a field of parent that differs from name only in case
+func (v *graphQLValidator) suggest(name string, parent *GraphQLType) string {
+	for candidate := range parent.Fields {
+		if strings.EqualFold(candidate, name) {
+			return fmt.Sprintf(", did you mean %q?", candidate)
+		}
+	}
+	return ""
+}
+
+func sortedKeys(args map[string]*GraphQLArgument) []string {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// graphQLOperation returns the operation that would run, or nil when the
+// query does not parse
+func graphQLOperation(query, operationName string) *gqlOperation {
+	document, err := parseGraphQL(query)
+	if err != nil {
+		return nil
+	}
+	operation, err := document.operationNamed(operationName)
+	if err != nil {
+		return nil
+	}
+	return operation
+}
+
+// graphQLProperty looks up a value of a GraphQL response for an assertion.
+// "errors" is the number of errors and "errors.0.message" or
+// "data.user.name" follow a path into the response body.
+func graphQLProperty(response *APIResponse, property string) (interface{}, error) {
+	if property == "" || property == "errors" {
+		return len(parseGraphQLErrors(response.Body)), nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		return nil, fmt.Errorf("response is not JSON")
+	}
+	return jsonValue(body, property)
+}
@@ -0,0 +1,683 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A small GraphQL parser, enough to validate operations against an
+// introspected schema before they are sent. It follows the October 2021
+// specification for executable documents; type system definitions are
+// rejected.
+
+// gqlDocument is a parsed executable document
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+	order      []string // fragment names in document order
+}
+
+type gqlOperation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []gqlVariableDef
+	selections []*gqlSelection
+	line       int
+	column     int
+}
+
+type gqlFragment struct {
+	name          string
+	typeCondition string
+	selections    []*gqlSelection
+	line          int
+	column        int
+}
+
+type gqlVariableDef struct {
+	name   string
+	typ    *gqlTypeRef
+	line   int
+	column int
+}
+
+// gqlTypeRef is a type as written in a variable definition
+type gqlTypeRef struct {
+	name    string      // named type, empty for lists
+	ofType  *gqlTypeRef // element type of a list
+	nonNull bool
+}
+
+func (t *gqlTypeRef) String() string {
+	s := t.name
+	if t.ofType != nil {
+		s = "[" + t.ofType.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// namedType returns the innermost named type
+func (t *gqlTypeRef) namedType() string {
+	for t.ofType != nil {
+		t = t.ofType
+	}
+	return t.name
+}
+
+// Selection kinds
+const (
+	gqlField          = "field"
+	gqlFragmentSpread = "fragment spread"
+	gqlInlineFragment = "inline fragment"
+)
+
+type gqlSelection struct {
+	kind          string
+	alias         string
+	name          string // field name or spread fragment name
+	arguments     []gqlArgument
+	typeCondition string // inline fragments, empty for the enclosing type
+	selections    []*gqlSelection
+	line          int
+	column        int
+}
+
+type gqlArgument struct {
+	name  string
+	value *gqlValue
+}
+
+// gqlValue is an argument or default value. Only variable references are
+// inspected during validation, the rest is kept to walk into them.
+type gqlValue struct {
+	variable string // set for $name
+	list     []*gqlValue
+	fields   []gqlArgument
+}
+
+// variables returns the names of the variables referenced in v
+func (v *gqlValue) variables() []string {
+	if v == nil {
+		return nil
+	}
+	if v.variable != "" {
+		return []string{v.variable}
+	}
+	var names []string
+	for _, item := range v.list {
+		names = append(names, item.variables()...)
+	}
+	for _, field := range v.fields {
+		names = append(names, field.value.variables()...)
+	}
+	return names
+}
+
+// GraphQLSyntaxError reports where a document could not be parsed
+type GraphQLSyntaxError struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *GraphQLSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Token kinds
+const (
+	gqlEOF = iota
+	gqlPunctuator
+	gqlName
+	gqlNumber
+	gqlString
+)
+
+type gqlToken struct {
+	kind   int
+	value  string
+	line   int
+	column int
+}
+
+// gqlLexer splits a document into tokens, skipping whitespace, commas and comments
+type gqlLexer struct {
+	source    string
+	pos       int
+	line      int
+	lineStart int
+}
+
+func (l *gqlLexer) errorf(format string, args ...interface{}) error {
+	return &GraphQLSyntaxError{Message: fmt.Sprintf(format, args...), Line: l.line, Column: l.pos - l.lineStart + 1}
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	// Ignored tokens
+	for l.pos < len(l.source) {
+		c := l.source[l.pos]
+		switch {
+		case c == '\n':
+			l.pos++
+			l.line++
+			l.lineStart = l.pos
+		case c == '\r':
+			l.pos++
+			if l.pos < len(l.source) && l.source[l.pos] == '\n' {
+				l.pos++
+			}
+			l.line++
+			l.lineStart = l.pos
+		case c == ' ' || c == '\t' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.source) && l.source[l.pos] != '\n' && l.source[l.pos] != '\r' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.source[l.pos:], "\ufeff"):
+			l.pos += len("\ufeff")
+		default:
+			goto token
+		}
+	}
+	return gqlToken{kind: gqlEOF, line: l.line, column: l.pos - l.lineStart + 1}, nil
+
+token:
+	start := l.pos
+	token := gqlToken{line: l.line, column: start - l.lineStart + 1}
+	c := l.source[l.pos]
+
+	switch {
+	case strings.HasPrefix(l.source[l.pos:], "..."):
+		l.pos += 3
+		token.kind, token.value = gqlPunctuator, "..."
+	case strings.ContainsRune("!$&()=:@[]{}|", rune(c)):
+		l.pos++
+		token.kind, token.value = gqlPunctuator, string(c)
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.source) && (l.source[l.pos] == '_' || isLetter(l.source[l.pos]) || isDigit(l.source[l.pos])) {
+			l.pos++
+		}
+		token.kind, token.value = gqlName, l.source[start:l.pos]
+	case c == '-' || isDigit(c):
+		l.pos++
+		for l.pos < len(l.source) {
+			c := l.source[l.pos]
+			if isDigit(c) || c == '.' || c == 'e' || c == 'E' ||
+				((c == '+' || c == '-') && (l.source[l.pos-1] == 'e' || l.source[l.pos-1] == 'E')) {
+				l.pos++
+				continue
+			}
+			break
+		}
+		if l.pos < len(l.source) && (l.source[l.pos] == '_' || isLetter(l.source[l.pos])) {
+			return token, l.errorf("invalid number %q", l.source[start:l.pos+1])
+		}
+		token.kind, token.value = gqlNumber, l.source[start:l.pos]
+	case strings.HasPrefix(l.source[l.pos:], `"""`):
+		end := strings.Index(strings.ReplaceAll(l.source[l.pos+3:], `\"""`, "    "), `"""`)
+		if end < 0 {
+			return token, l.errorf("unterminated block string")
+		}
+		value := l.source[l.pos+3 : l.pos+3+end]
+		for _, r := range value {
+			if r == '\n' {
+				l.line++
+			}
+		}
+		if i := strings.LastIndex(value, "\n"); i >= 0 {
+			l.lineStart = l.pos + 3 + i + 1
+		}
+		l.pos += 3 + end + 3
+		token.kind, token.value = gqlString, value
+	case c == '"':
+		l.pos++
+		for {
+			if l.pos >= len(l.source) || l.source[l.pos] == '\n' || l.source[l.pos] == '\r' {
+				return token, l.errorf("unterminated string")
+			}
+			if l.source[l.pos] == '\\' {
+				l.pos += 2
+				continue
+			}
+			if l.source[l.pos] == '"' {
+				l.pos++
+				break
+			}
+			l.pos++
+		}
+		token.kind, token.value = gqlString, l.source[start:l.pos]
+	default:
+		return token, l.errorf("unexpected character %q", c)
+	}
+	return token, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// gqlParser is a recursive descent parser over gqlLexer with one token of lookahead
+type gqlParser struct {
+	lexer gqlLexer
+	token gqlToken
+}
+
+// parseGraphQL parses an executable GraphQL document
+func parseGraphQL(source string) (*gqlDocument, error) {
+	p := &gqlParser{lexer: gqlLexer{source: source, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	document := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.token.kind != gqlEOF {
+		switch {
+		case p.peek(gqlPunctuator, "{"):
+			// Query shorthand
+			operation := &gqlOperation{kind: "query", line: p.token.line, column: p.token.column}
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			operation.selections = selections
+			document.operations = append(document.operations, operation)
+		case p.peek(gqlName, "query"), p.peek(gqlName, "mutation"), p.peek(gqlName, "subscription"):
+			operation, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			document.operations = append(document.operations, operation)
+		case p.peek(gqlName, "fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := document.fragments[fragment.name]; exists {
+				return nil, &GraphQLSyntaxError{Message: fmt.Sprintf("fragment %q is defined more than once", fragment.name), Line: fragment.line, Column: fragment.column}
+			}
+			document.fragments[fragment.name] = fragment
+			document.order = append(document.order, fragment.name)
+		default:
+			return nil, p.unexpected("an operation or fragment")
+		}
+	}
+
+	if len(document.operations) == 0 {
+		return nil, &GraphQLSyntaxError{Message: "document has no operation", Line: 1, Column: 1}
+	}
+	return document, nil
+}
+
+func (p *gqlParser) advance() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = token
+	return nil
+}
+
+func (p *gqlParser) peek(kind int, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+func (p *gqlParser) unexpected(expected string) error {
+	found := p.token.value
+	if p.token.kind == gqlEOF {
+		found = "end of document"
+	} else {
+		found = fmt.Sprintf("%q", found)
+	}
+	return &GraphQLSyntaxError{Message: fmt.Sprintf("expected %s, found %s", expected, found), Line: p.token.line, Column: p.token.column}
+}
+
+// expect consumes the punctuator value or fails
+func (p *gqlParser) expect(value string) error {
+	if !p.peek(gqlPunctuator, value) {
+		return p.unexpected(fmt.Sprintf("%q", value))
+	}
+	return p.advance()
+}
+
+// skip consumes the punctuator value if it is next
+func (p *gqlParser) skip(value string) (bool, error) {
+	if !p.peek(gqlPunctuator, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.token.kind != gqlName {
+		return "", p.unexpected("a name")
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	operation := &gqlOperation{kind: p.token.value, line: p.token.line, column: p.token.column}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.token.kind == gqlName {
+		operation.name = p.token.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if found, err := p.skip("("); err != nil {
+		return nil, err
+	} else if found {
+		for !p.peek(gqlPunctuator, ")") {
+			definition := gqlVariableDef{line: p.token.line, column: p.token.column}
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			definition.name = name
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if definition.typ, err = p.typeRef(); err != nil {
+				return nil, err
+			}
+			if found, err := p.skip("="); err != nil {
+				return nil, err
+			} else if found {
+				if _, err := p.value(true); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.directives(); err != nil {
+				return nil, err
+			}
+			operation.variables = append(operation.variables, definition)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	operation.selections = selections
+	return operation, nil
+}
+
+func (p *gqlParser) fragment() (*gqlFragment, error) {
+	fragment := &gqlFragment{line: p.token.line, column: p.token.column}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, &GraphQLSyntaxError{Message: `a fragment cannot be named "on"`, Line: fragment.line, Column: fragment.column}
+	}
+	fragment.name = name
+
+	if !p.peek(gqlName, "on") {
+		return nil, p.unexpected(`"on"`)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.typeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+	if fragment.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *gqlParser) typeRef() (*gqlTypeRef, error) {
+	var typ *gqlTypeRef
+	if found, err := p.skip("["); err != nil {
+		return nil, err
+	} else if found {
+		ofType, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		typ = &gqlTypeRef{ofType: ofType}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		typ = &gqlTypeRef{name: name}
+	}
+
+	nonNull, err := p.skip("!")
+	if err != nil {
+		return nil, err
+	}
+	typ.nonNull = nonNull
+	return typ, nil
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []*gqlSelection
+	for !p.peek(gqlPunctuator, "}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, p.unexpected("a selection")
+	}
+	return selections, p.advance()
+}
+
+func (p *gqlParser) selection() (*gqlSelection, error) {
+	selection := &gqlSelection{line: p.token.line, column: p.token.column}
+
+	if found, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if found {
+		if p.token.kind == gqlName && p.token.value != "on" {
+			selection.kind = gqlFragmentSpread
+			selection.name = p.token.value
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			return selection, p.directives()
+		}
+
+		selection.kind = gqlInlineFragment
+		if p.peek(gqlName, "on") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if selection.typeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return nil, err
+		}
+		selection.selections, err = p.selectionSet()
+		return selection, err
+	}
+
+	selection.kind = gqlField
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if found, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if found {
+		selection.alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	selection.name = name
+
+	if selection.arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(gqlPunctuator, "{") {
+		if selection.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return selection, nil
+}
+
+func (p *gqlParser) arguments(constant bool) ([]gqlArgument, error) {
+	found, err := p.skip("(")
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var arguments []gqlArgument
+	for !p.peek(gqlPunctuator, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, gqlArgument{name: name, value: value})
+	}
+	if len(arguments) == 0 {
+		return nil, p.unexpected("an argument")
+	}
+	return arguments, p.advance()
+}
+
+// directives skips any directives; their arguments are parsed for syntax only
+func (p *gqlParser) directives() error {
+	for p.peek(gqlPunctuator, "@") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if _, err := p.arguments(false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *gqlParser) value(constant bool) (*gqlValue, error) {
+	switch {
+	case p.peek(gqlPunctuator, "$"):
+		if constant {
+			return nil, p.unexpected("a constant value")
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return &gqlValue{variable: name}, nil
+
+	case p.peek(gqlPunctuator, "["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		value := &gqlValue{}
+		for !p.peek(gqlPunctuator, "]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			value.list = append(value.list, item)
+		}
+		return value, p.advance()
+
+	case p.peek(gqlPunctuator, "{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		value := &gqlValue{}
+		for !p.peek(gqlPunctuator, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			field, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			value.fields = append(value.fields, gqlArgument{name: name, value: field})
+		}
+		return value, p.advance()
+
+	case p.token.kind == gqlName, p.token.kind == gqlNumber, p.token.kind == gqlString:
+		// Scalars and enum values
+		return &gqlValue{}, p.advance()
+
+	default:
+		return nil, p.unexpected("a value")
+	}
+}
+
+// operationNamed picks the operation to run, as a server would
+func (d *gqlDocument) operationNamed(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, fmt.Errorf("the document has %d operations, an operationName is required", len(d.operations))
+		}
+		return d.operations[0], nil
+	}
+	for _, operation := range d.operations {
+		if operation.name == name {
+			return operation, nil
+		}
+	}
+	return nil, fmt.Errorf("operation %q not found in the document", name)
+}
@@ -0,0 +1,770 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCRequest turns a request into a gRPC call to the server at the request's
+// URL: grpc://host:port for plaintext, grpcs://host:port (or a bare
+// host:port) for TLS, or unix:///path/to.sock. Request headers are sent as
+// metadata; names ending in -bin take base64 values.
+type GRPCRequest struct {
+	Method string `json:"method"` // package.Service/Method
+
+	// Messages are the request messages in protobuf JSON. Calls that are
+	// not client streaming take one; when empty the request body is used.
+	Messages []json.RawMessage `json:"messages,omitempty"`
+
+	// Services are described by .proto files when ProtoFiles is set and by
+	// server reflection otherwise. ProtoSources holds the contents of files
+	// that are not on disk, such as ones uploaded to the web interface;
+	// other files are only read where the engine allows local access.
+	ProtoFiles   []string          `json:"protoFiles,omitempty"`
+	ImportPaths  []string          `json:"importPaths,omitempty"`
+	ProtoSources map[string]string `json:"protoSources,omitempty"`
+}
+
+// GRPCStatus is the status a gRPC call ended with
+type GRPCStatus struct {
+	Code    int               `json:"code"`
+	Name    string            `json:"name"` // e.g. OK or NotFound
+	Message string            `json:"message,omitempty"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// GRPCService describes a service found by reflection or in .proto files
+type GRPCService struct {
+	Name    string       `json:"name"`
+	Methods []GRPCMethod `json:"methods"`
+}
+
+// GRPCMethod describes one method of a service
+type GRPCMethod struct {
+	Name            string          `json:"name"`
+	FullName        string          `json:"fullName"` // package.Service/Method, as used in GRPCRequest
+	InputType       string          `json:"inputType"`
+	OutputType      string          `json:"outputType"`
+	ClientStreaming bool            `json:"clientStreaming"`
+	ServerStreaming bool            `json:"serverStreaming"`
+	InputTemplate   json.RawMessage `json:"inputTemplate"` // the input message with every field zero
+}
+
+// substitute returns a copy of the call with replace applied to the method
+// and messages, or nil for a nil call
+func (g *GRPCRequest) substitute(replace func(string) string) *GRPCRequest {
+	if g == nil {
+		return nil
+	}
+	substituted := *g
+	substituted.Method = replace(g.Method)
+	substituted.Messages = make([]json.RawMessage, len(g.Messages))
+	for i, message := range g.Messages {
+		substituted.Messages[i] = json.RawMessage(replace(string(message)))
+	}
+	return &substituted
+}
+
+// grpcTarget splits a request URL into the address to dial, whether to use
+// TLS and the Unix socket to connect through, if any
+func grpcTarget(rawURL string) (address string, secure bool, socket string, err error) {
+	if strings.HasPrefix(rawURL, unixURLPrefix) {
+		socket = strings.TrimPrefix(rawURL, unixURLPrefix)
+		if s, _, ok := splitUnixURL(rawURL); ok {
+			socket = s
+		}
+		return "localhost", false, socket, nil
+	}
+
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "grpcs://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, "", err
+	}
+	port := "443"
+	switch strings.ToLower(u.Scheme) {
+	case "grpcs", "https":
+		secure = true
+	case "grpc", "http":
+		port = "80"
+	default:
+		return "", false, "", fmt.Errorf("unsupported gRPC URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", false, "", fmt.Errorf("gRPC URL %q has no host", rawURL)
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), port), secure, "", nil
+	}
+	return u.Host, secure, "", nil
+}
+
+// dialGRPC connects to the server of a gRPC request. Proxies are not used.
+func (e *RequestEngine) dialGRPC(ctx context.Context, request APIRequest, opts RequestOptions) (*grpc.ClientConn, error) {
+	address, secure, socket, err := grpcTarget(request.URL)
+	if err != nil {
+		return nil, err
+	}
+	if socket == "" {
+		socket = opts.UnixSocket
+	} else if !e.localAccess.Load() {
+		return nil, errUnixSocketDenied
+	}
+
+	creds := insecure.NewCredentials()
+	if secure {
+		tlsConfig, err := buildTLSConfig(opts.TLS, e.localAccess.Load())
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	dial := dialFunc(&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}, socket, opts.Resolve)
+	return grpc.DialContext(ctx, "passthrough:///"+address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}),
+		grpc.WithUserAgent("RESTerX"),
+	)
+}
+
+// grpcFiles returns the descriptors of the services a call can use, from
+// its .proto files or else from the server's reflection service
+func grpcFiles(ctx context.Context, conn *grpc.ClientConn, g *GRPCRequest, localFiles bool) (*protoregistry.Files, error) {
+	if g != nil && len(g.ProtoFiles) > 0 {
+		return compileProtoFiles(ctx, g, localFiles)
+	}
+
+	client, err := newReflectionClient(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	var services []string
+	if g != nil && g.Method != "" {
+		service, _, err := splitGRPCMethod(g.Method)
+		if err != nil {
+			return nil, err
+		}
+		services = []string{service}
+	} else if services, err = client.listServices(); err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		if err := client.fetchSymbol(service); err != nil {
+			return nil, err
+		}
+	}
+	return client.files()
+}
+
+// compileProtoFiles parses and links the .proto files of a call. Files not
+// in ProtoSources are only read from disk with localFiles set.
+func compileProtoFiles(ctx context.Context, g *GRPCRequest, localFiles bool) (*protoregistry.Files, error) {
+	accessor := func(path string) (io.ReadCloser, error) {
+		if source, found := g.ProtoSources[path]; found {
+			return io.NopCloser(strings.NewReader(source)), nil
+		}
+		if !localFiles {
+			// Not found lets the resolver try the next import path
+			return nil, fmt.Errorf("%s is not in protoSources, and files cannot be read here: %w", path, fs.ErrNotExist)
+		}
+		return os.Open(path)
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: g.ImportPaths,
+			Accessor:    accessor,
+		}),
+	}
+	compiled, err := compiler.Compile(ctx, g.ProtoFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := new(protoregistry.Files)
+	var register func(file protoreflect.FileDescriptor) error
+	register = func(file protoreflect.FileDescriptor) error {
+		if _, err := files.FindFileByPath(file.Path()); err == nil {
+			return nil
+		}
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := register(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return files.RegisterFile(file)
+	}
+	for _, file := range compiled {
+		if err := register(file); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// reflectionClient asks a server for its services over the v1alpha
+// reflection API, which servers offering v1 also support
+type reflectionClient struct {
+	stream      rpb.ServerReflection_ServerReflectionInfoClient
+	cancel      context.CancelFunc
+	descriptors map[string]*descriptorpb.FileDescriptorProto
+}
+
+func newReflectionClient(ctx context.Context, conn *grpc.ClientConn) (*reflectionClient, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("server reflection: %w", err)
+	}
+	return &reflectionClient{stream: stream, cancel: cancel, descriptors: make(map[string]*descriptorpb.FileDescriptorProto)}, nil
+}
+
+func (c *reflectionClient) close() {
+	c.stream.CloseSend()
+	c.cancel()
+}
+
+func (c *reflectionClient) ask(request *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := c.stream.Send(request); err != nil {
+		if _, recvErr := c.stream.Recv(); recvErr != nil {
+			err = recvErr
+		}
+		return nil, fmt.Errorf("server reflection: %w", err)
+	}
+	response, err := c.stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("server reflection: %w", err)
+	}
+	if failure := response.GetErrorResponse(); failure != nil {
+		return nil, fmt.Errorf("server reflection: %s", failure.ErrorMessage)
+	}
+	return response, nil
+}
+
+// listServices returns the services of the server except reflection itself
+func (c *reflectionClient) listServices() ([]string, error) {
+	response, err := c.ask(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		if !strings.HasPrefix(service.Name, "grpc.reflection.") {
+			services = append(services, service.Name)
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// fetchSymbol loads the file defining a symbol and the files it imports
+func (c *reflectionClient) fetchSymbol(symbol string) error {
+	response, err := c.ask(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	if err != nil {
+		return err
+	}
+	return c.add(response)
+}
+
+func (c *reflectionClient) fetchFile(name string) error {
+	// Well-known types are compiled in, servers do not always offer them
+	if file, err := protoregistry.GlobalFiles.FindFileByPath(name); err == nil {
+		c.descriptors[name] = protodesc.ToFileDescriptorProto(file)
+		return c.fetchImports(c.descriptors[name])
+	}
+	response, err := c.ask(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+	})
+	if err != nil {
+		return err
+	}
+	return c.add(response)
+}
+
+func (c *reflectionClient) add(response *rpb.ServerReflectionResponse) error {
+	var added []*descriptorpb.FileDescriptorProto
+	for _, raw := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(raw, file); err != nil {
+			return fmt.Errorf("server reflection: %w", err)
+		}
+		if _, found := c.descriptors[file.GetName()]; !found {
+			c.descriptors[file.GetName()] = file
+			added = append(added, file)
+		}
+	}
+	for _, file := range added {
+		if err := c.fetchImports(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *reflectionClient) fetchImports(file *descriptorpb.FileDescriptorProto) error {
+	for _, dependency := range file.GetDependency() {
+		if _, found := c.descriptors[dependency]; !found {
+			if err := c.fetchFile(dependency); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *reflectionClient) files() (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range c.descriptors {
+		set.File = append(set.File, file)
+	}
+	return protodesc.NewFiles(set)
+}
+
+// splitGRPCMethod splits package.Service/Method, also accepting a dot or a
+// leading slash, into the service and method names
+func splitGRPCMethod(fullName string) (string, string, error) {
+	fullName = strings.TrimPrefix(fullName, "/")
+	i := strings.LastIndexAny(fullName, "/.")
+	if i <= 0 || i == len(fullName)-1 {
+		return "", "", fmt.Errorf("invalid gRPC method %q, expected package.Service/Method", fullName)
+	}
+	return fullName[:i], fullName[i+1:], nil
+}
+
+// findGRPCMethod looks up the descriptor of a method
+func findGRPCMethod(files *protoregistry.Files, fullName string) (protoreflect.MethodDescriptor, error) {
+	serviceName, methodName, err := splitGRPCMethod(fullName)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("service %q not found", serviceName)
+	}
+	service, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a service", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, fmt.Errorf("service %s has no method %q", serviceName, methodName)
+	}
+	return method, nil
+}
+
+// GRPCServices lists the services of the server at request.URL, or those
+// in the request's .proto files
+func (e *RequestEngine) GRPCServices(ctx context.Context, request APIRequest) ([]GRPCService, error) {
+	opts := e.grpcOptions(request.Options)
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var files *protoregistry.Files
+	var err error
+	listing := &GRPCRequest{}
+	if request.GRPC != nil {
+		*listing = *request.GRPC
+		listing.Method = ""
+	}
+	if len(listing.ProtoFiles) > 0 {
+		files, err = compileProtoFiles(ctx, listing, e.localAccess.Load())
+	} else {
+		var conn *grpc.ClientConn
+		if conn, err = e.dialGRPC(ctx, request, opts); err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		ctx = metadata.NewOutgoingContext(ctx, grpcMetadata(request.HeaderFields()))
+		files, err = grpcFiles(ctx, conn, listing, e.localAccess.Load())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var services []GRPCService
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		for i := 0; i < file.Services().Len(); i++ {
+			descriptor := file.Services().Get(i)
+			if strings.HasPrefix(string(descriptor.FullName()), "grpc.reflection.") {
+				continue
+			}
+			service := GRPCService{Name: string(descriptor.FullName())}
+			for j := 0; j < descriptor.Methods().Len(); j++ {
+				method := descriptor.Methods().Get(j)
+				template, _ := json.Marshal(grpcTemplate(method.Input(), 0))
+				service.Methods = append(service.Methods, GRPCMethod{
+					Name:            string(method.Name()),
+					FullName:        fmt.Sprintf("%s/%s", service.Name, method.Name()),
+					InputType:       string(method.Input().FullName()),
+					OutputType:      string(method.Output().FullName()),
+					ClientStreaming: method.IsStreamingClient(),
+					ServerStreaming: method.IsStreamingServer(),
+					InputTemplate:   template,
+				})
+			}
+			services = append(services, service)
+		}
+		return true
+	})
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, nil
+}
+
+// grpcTemplate returns a message with every field set to its zero value, for
+// filling in. Well-known types and deep nesting are left null.
+func grpcTemplate(message protoreflect.MessageDescriptor, depth int) interface{} {
+	if depth > 3 || strings.HasPrefix(string(message.FullName()), "google.protobuf.") {
+		return nil
+	}
+	template := make(map[string]interface{})
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		var value interface{}
+		switch field.Kind() {
+		case protoreflect.BoolKind:
+			value = false
+		case protoreflect.StringKind, protoreflect.BytesKind:
+			value = ""
+		case protoreflect.EnumKind:
+			value = string(field.Enum().Values().Get(0).Name())
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			if !field.IsMap() {
+				value = grpcTemplate(field.Message(), depth+1)
+			}
+		default:
+			value = 0
+		}
+		switch {
+		case field.IsMap():
+			value = map[string]interface{}{}
+		case field.IsList():
+			value = []interface{}{value}
+		}
+		template[field.JSONName()] = value
+	}
+	return template
+}
+
+// grpcOptions fills the options a gRPC call uses from the engine
+func (e *RequestEngine) grpcOptions(opts RequestOptions) RequestOptions {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if opts.UnixSocket == "" {
+		opts.UnixSocket = e.unixSocket
+	}
+	opts.Resolve = mergeResolve(e.resolve, opts.Resolve)
+	return opts
+}
+
+// grpcMetadata converts request headers to metadata, decoding the base64
+// values of binary headers
+func grpcMetadata(headers HeaderList) metadata.MD {
+	md := metadata.MD{}
+	for _, field := range headers {
+		name := strings.ToLower(field.Name)
+		switch name {
+		case "content-type", "te", "host", "connection", "user-agent":
+			continue
+		}
+		value := field.Value
+		if strings.HasSuffix(name, "-bin") {
+			if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+				value = string(decoded)
+			}
+		}
+		md.Append(name, value)
+	}
+	return md
+}
+
+// metadataList converts received metadata to a header list, base64 encoding
+// binary values
+func metadataList(md metadata.MD) HeaderList {
+	names := make([]string, 0, len(md))
+	for name := range md {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var list HeaderList
+	for _, name := range names {
+		for _, value := range md[name] {
+			if strings.HasSuffix(name, "-bin") {
+				value = base64.StdEncoding.EncodeToString([]byte(value))
+			}
+			list = append(list, HeaderField{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+// grpcHTTPStatus maps a gRPC code to the HTTP status conventionally used for
+// it, so history, status assertions and monitors treat calls like requests
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// grpcCall makes the gRPC call of a request for Execute. The messages sent
+// and received are logged in Messages; Body holds the response message, or
+// a JSON array of them for server streaming calls. A request timeout bounds
+// the whole call.
+func (e *RequestEngine) grpcCall(ctx context.Context, request APIRequest, opts RequestOptions) APIResponse {
+	start := time.Now()
+	failed := func(err error) APIResponse {
+		return APIResponse{Error: err.Error(), ResponseTime: time.Since(start)}
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := e.dialGRPC(ctx, request, opts)
+	if err != nil {
+		return failed(err)
+	}
+	defer conn.Close()
+
+	ctx = metadata.NewOutgoingContext(ctx, grpcMetadata(request.HeaderFields()))
+	files, err := grpcFiles(ctx, conn, request.GRPC, e.localAccess.Load())
+	if err != nil {
+		return failed(err)
+	}
+	method, err := findGRPCMethod(files, request.GRPC.Method)
+	if err != nil {
+		return failed(err)
+	}
+
+	types := dynamicpb.NewTypes(files)
+	unmarshal := protojson.UnmarshalOptions{Resolver: types}
+	marshal := protojson.MarshalOptions{Resolver: types}
+
+	sources := request.GRPC.Messages
+	if len(sources) == 0 {
+		body := strings.TrimSpace(request.Body)
+		if body == "" {
+			body = "{}"
+		}
+		sources = []json.RawMessage{json.RawMessage(body)}
+	}
+	if !method.IsStreamingClient() && len(sources) != 1 {
+		return failed(fmt.Errorf("%s takes one request message, got %d", method.FullName(), len(sources)))
+	}
+	messages := make([]proto.Message, len(sources))
+	for i, source := range sources {
+		message := dynamicpb.NewMessage(method.Input())
+		if err := unmarshal.Unmarshal(source, message); err != nil {
+			return failed(fmt.Errorf("request message %d is not a valid %s: %v", i+1, method.Input().FullName(), err))
+		}
+		messages[i] = message
+	}
+
+	// The call counts against the rate limit of the server
+	address, _, socket, _ := grpcTarget(request.URL)
+	if socket != "" {
+		address = unixURLPrefix + socket
+	}
+	queued, release, err := e.limiter.acquire(ctx, opts.RateLimitScope, address)
+	if err != nil {
+		return APIResponse{
+			Error:        "Waiting for rate limit: " + err.Error(),
+			Timing:       &ResponseTiming{Queued: queued},
+			ResponseTime: time.Since(start),
+		}
+	}
+	defer release()
+	start = time.Now()
+
+	response := APIResponse{Protocol: "HTTP/2", ContentType: "application/json", Timing: &ResponseTiming{Queued: queued}}
+	record := func(direction string, message proto.Message) {
+		data, _ := marshal.Marshal(message)
+		response.Messages = append(response.Messages, WebSocketLogEntry{Direction: direction, Type: WebSocketJSON, Data: string(data), Time: time.Now()})
+	}
+
+	path := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+	stream, callErr := conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(method.Name()),
+		ClientStreams: method.IsStreamingClient(),
+		ServerStreams: method.IsStreamingServer(),
+	}, path)
+
+	var received []json.RawMessage
+	if callErr == nil {
+		for _, message := range messages {
+			// A failed send is explained by the status RecvMsg returns
+			if stream.SendMsg(message) != nil {
+				break
+			}
+			record("sent", message)
+		}
+		stream.CloseSend()
+
+		for {
+			message := dynamicpb.NewMessage(method.Output())
+			if err := stream.RecvMsg(message); err != nil {
+				if err != io.EOF {
+					callErr = err
+				}
+				break
+			}
+			record("received", message)
+			data, _ := marshal.Marshal(message)
+			received = append(received, data)
+			if !method.IsStreamingServer() {
+				break
+			}
+		}
+
+		if header, err := stream.Header(); err == nil {
+			response.RawHeaders = metadataList(header)
+		}
+		response.Trailers = metadataList(stream.Trailer())
+	}
+
+	st := status.Convert(callErr)
+	response.StatusCode = grpcHTTPStatus(st.Code())
+	response.Status = st.Code().String()
+	response.GRPCStatus = &GRPCStatus{Code: int(st.Code()), Name: st.Code().String(), Message: st.Message()}
+	for _, detail := range st.Proto().GetDetails() {
+		data, err := marshal.Marshal(detail)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{"@type": detail.GetTypeUrl()})
+		}
+		response.GRPCStatus.Details = append(response.GRPCStatus.Details, data)
+	}
+	if callErr != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && st.Code() == codes.DeadlineExceeded {
+		response.Error = fmt.Sprintf("gRPC call timed out after %v", timeout)
+	}
+
+	response.Headers = make(map[string]string)
+	for _, field := range response.RawHeaders {
+		response.Headers[field.Name] = field.Value
+	}
+	switch {
+	case method.IsStreamingServer():
+		body, _ := json.Marshal(received)
+		if received == nil {
+			body = []byte("[]")
+		}
+		response.Body = string(body)
+	case len(received) == 1:
+		response.Body = string(received[0])
+	}
+	response.BodySize = int64(len(response.Body))
+	response.ResponseTime = time.Since(start)
+	return response
+}
+
+// grpcProperty looks up a value of a gRPC call for an assertion. Property
+// is "status" (the default) for the code name such as NotFound, "code" for
+// its number, "message", "details.<index>.<path>" or "trailer.<name>".
+func grpcProperty(response *APIResponse, property string) (interface{}, error) {
+	if response.GRPCStatus == nil {
+		return nil, fmt.Errorf("not a gRPC response")
+	}
+	switch {
+	case property == "" || property == "status":
+		return response.GRPCStatus.Name, nil
+	case property == "code":
+		return response.GRPCStatus.Code, nil
+	case property == "message":
+		return response.GRPCStatus.Message, nil
+	case strings.HasPrefix(property, "trailer."):
+		name := strings.TrimPrefix(property, "trailer.")
+		if !response.Trailers.Has(name) {
+			return nil, nil
+		}
+		return response.Trailers.Get(name), nil
+	case property == "details" || strings.HasPrefix(property, "details."):
+		var details interface{}
+		if data, err := json.Marshal(response.GRPCStatus.Details); err == nil {
+			json.Unmarshal(data, &details)
+		}
+		if property == "details" {
+			return len(response.GRPCStatus.Details), nil
+		}
+		return jsonValue(details, strings.TrimPrefix(property, "details."))
+	default:
+		return nil, fmt.Errorf("unknown gRPC property %q", property)
+	}
+}
@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// healthProto describes the standard health service, as a client would
+// upload it
+const healthProto = `syntax = "proto3";
+
+package grpc.health.v1;
+
+message HealthCheckRequest {
+  string service = 1;
+}
+
+message HealthCheckResponse {
+  enum ServingStatus {
+    UNKNOWN = 0;
+    SERVING = 1;
+    NOT_SERVING = 2;
+    SERVICE_UNKNOWN = 3;
+  }
+  ServingStatus status = 1;
+}
+
+service Health {
+  rpc Check(HealthCheckRequest) returns (HealthCheckResponse);
+  rpc Watch(HealthCheckRequest) returns (stream HealthCheckResponse);
+}
+`
+
+// startGRPCServer runs a health service with reflection and returns its URL
+func startGRPCServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("orders", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return "grpc://" + listener.Addr().String()
+}
+
+func TestGRPCCall(t *testing.T) {
+	url := startGRPCServer(t)
+	protoFile := filepath.Join(t.TempDir(), "health.proto")
+	if err := os.WriteFile(protoFile, []byte(healthProto), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		grpc        GRPCRequest
+		body        string
+		localAccess bool
+		wantStatus  string
+		wantBody    string
+		wantErr     string
+	}{
+		{
+			name:       "reflection",
+			grpc:       GRPCRequest{Method: "grpc.health.v1.Health/Check"},
+			wantStatus: "OK",
+			wantBody:   `"SERVING"`,
+		},
+		{
+			name:       "reflection with message",
+			grpc:       GRPCRequest{Method: "grpc.health.v1.Health/Check"},
+			body:       `{"service": "orders"}`,
+			wantStatus: "OK",
+			wantBody:   `"NOT_SERVING"`,
+		},
+		{
+			name:       "error status",
+			grpc:       GRPCRequest{Method: "grpc.health.v1.Health/Check"},
+			body:       `{"service": "missing"}`,
+			wantStatus: "NotFound",
+		},
+		{
+			name:    "unknown method",
+			grpc:    GRPCRequest{Method: "grpc.health.v1.Health/Nope"},
+			wantErr: "Nope",
+		},
+		{
+			name:    "invalid message",
+			grpc:    GRPCRequest{Method: "grpc.health.v1.Health/Check"},
+			body:    `{"nope": 1}`,
+			wantErr: "not a valid grpc.health.v1.HealthCheckRequest",
+		},
+		{
+			name: "proto sources",
+			grpc: GRPCRequest{
+				Method:       "grpc.health.v1.Health/Check",
+				ProtoFiles:   []string{"health.proto"},
+				ProtoSources: map[string]string{"health.proto": healthProto},
+			},
+			wantStatus: "OK",
+			wantBody:   `"SERVING"`,
+		},
+		{
+			name:        "proto file",
+			grpc:        GRPCRequest{Method: "grpc.health.v1.Health/Check", ProtoFiles: []string{protoFile}},
+			localAccess: true,
+			wantStatus:  "OK",
+			wantBody:    `"SERVING"`,
+		},
+		{
+			name:    "proto file without local access",
+			grpc:    GRPCRequest{Method: "grpc.health.v1.Health/Check", ProtoFiles: []string{protoFile}},
+			wantErr: "files cannot be read here",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := NewRequestEngine()
+			engine.SetLocalAccess(test.localAccess)
+			grpcRequest := test.grpc
+			response := engine.Execute(context.Background(), APIRequest{
+				Method: "GRPC",
+				URL:    url,
+				Body:   test.body,
+				GRPC:   &grpcRequest,
+			})
+			if test.wantErr != "" {
+				if !strings.Contains(response.Error, test.wantErr) {
+					t.Fatalf("error = %q, want it to contain %q", response.Error, test.wantErr)
+				}
+				return
+			}
+			if response.GRPCStatus == nil {
+				t.Fatalf("no gRPC status, error %q", response.Error)
+			}
+			if response.GRPCStatus.Name != test.wantStatus {
+				t.Fatalf("status = %s (%s), want %s", response.GRPCStatus.Name, response.GRPCStatus.Message, test.wantStatus)
+			}
+			if !strings.Contains(response.Body, test.wantBody) {
+				t.Fatalf("body = %q, want it to contain %q", response.Body, test.wantBody)
+			}
+		})
+	}
+}
+
+func TestGRPCServices(t *testing.T) {
+	url := startGRPCServer(t)
+
+	tests := []struct {
+		name string
+		grpc *GRPCRequest
+	}{
+		{name: "reflection"},
+		{name: "proto sources", grpc: &GRPCRequest{
+			ProtoFiles:   []string{"health.proto"},
+			ProtoSources: map[string]string{"health.proto": healthProto},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			services, err := NewRequestEngine().GRPCServices(context.Background(), APIRequest{URL: url, GRPC: test.grpc})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var health *GRPCService
+			for i := range services {
+				if services[i].Name == "grpc.health.v1.Health" {
+					health = &services[i]
+				}
+			}
+			if health == nil {
+				t.Fatalf("health service not listed: %+v", services)
+			}
+			methods := make(map[string]GRPCMethod)
+			for _, method := range health.Methods {
+				methods[method.Name] = method
+			}
+			if check := methods["Check"]; check.FullName != "grpc.health.v1.Health/Check" || check.ServerStreaming {
+				t.Fatalf("Check = %+v", check)
+			}
+			if watch := methods["Watch"]; !watch.ServerStreaming || watch.ClientStreaming {
+				t.Fatalf("Watch = %+v", watch)
+			}
+		})
+	}
+}
@@ -6,18 +6,26 @@ import (
 
 // HandleHeadRequest sends a HEAD request to the specified URL and prints the response
 func HandleHeadRequest(url string) {
-	response := MakeHTTPRequest("HEAD", url, "", map[string]string{})
-	
+	response := makeCLIRequest("HEAD", url, "", map[string]string{})
+	printAttempts(response.Attempts)
+	printRedirects(response.Redirects)
+
 	if response.Error != "" {
 		fmt.Printf("Error: %s\n", response.Error)
 		return
 	}
 
 	fmt.Printf("Status: %s\n", response.Status)
+	fmt.Printf("Protocol: %s\n", response.Protocol)
+	if response.CacheStatus != "" {
+		fmt.Printf("Cache: %s\n", response.CacheStatus)
+	}
 	fmt.Printf("Response Time: %v\n", response.ResponseTime)
+	printTiming(response.Timing)
+	printTLS(response.TLS)
 	fmt.Println("Headers:")
-	for key, value := range response.Headers {
-		fmt.Printf("%s: %s\n", key, value)
+	for _, field := range response.RawHeaders {
+		fmt.Printf("%s: %s\n", field.Name, field.Value)
 	}
 }
 
@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of HMAC signing
+const (
+	DefaultHMACTemplate        = "{method}\n{path}\n{query}\n{timestamp}\n{nonce}\n{bodyHash}"
+	DefaultHMACValue           = "HMAC {keyId}:{signature}"
+	DefaultHMACTimestampHeader = "X-Timestamp"
+	DefaultHMACNonceHeader     = "X-Nonce"
+)
+
+// HMACAuth signs every request with an HMAC of a canonical string. Template
+// builds the string from placeholders:
+//
+//	{method}       upper case method
+//	{path}         escaped path, / when empty
+//	{query}        query string as sent, without the ?
+//	{url}          full URL
+//	{host}         host and port as sent
+//	{timestamp}    time of signing, in TimestampFormat
+//	{nonce}        random value, new for every request
+//	{bodyHash}     hex hash of the body with Algorithm
+//	{contentType}  Content-Type header
+//	{keyId}        KeyID
+//	{header:Name}  any request header, repeated values joined by commas
+//
+// The signature is sent in Header, formatted by Value, which can use the
+// same placeholders and {signature}. The timestamp and nonce are sent in
+// their own headers, so that the server can rebuild the string.
+type HMACAuth struct {
+	KeyID           string `json:"keyId,omitempty"`
+	Secret          string `json:"secret"`
+	Algorithm       string `json:"algorithm,omitempty"`       // sha256 (default), sha1 or sha512
+	Encoding        string `json:"encoding,omitempty"`        // hex (default) or base64
+	Template        string `json:"template,omitempty"`        // DefaultHMACTemplate when empty
+	Header          string `json:"header,omitempty"`          // Authorization when empty
+	Value           string `json:"value,omitempty"`           // DefaultHMACValue when empty
+	TimestampHeader string `json:"timestampHeader,omitempty"` // DefaultHMACTimestampHeader when empty, "-" sends none
+	TimestampFormat string `json:"timestampFormat,omitempty"` // unix (default), unix_ms or rfc3339
+	NonceHeader     string `json:"nonceHeader,omitempty"`     // DefaultHMACNonceHeader when empty, "-" sends none
+}
+
+func (h *HMACAuth) substitute(replace func(string) string) *HMACAuth {
+	if h == nil {
+		return nil
+	}
+	copied := *h
+	copied.KeyID = replace(h.KeyID)
+	copied.Secret = replace(h.Secret)
+	copied.Template = replace(h.Template)
+	copied.Value = replace(h.Value)
+	return &copied
+}
+
+func (h *HMACAuth) header() string {
+	if h.Header == "" {
+		return "Authorization"
+	}
+	return h.Header
+}
+
+func (h *HMACAuth) hash() (func() hash.Hash, error) {
+	switch strings.ToLower(strings.ReplaceAll(h.Algorithm, "-", "")) {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unknown HMAC algorithm %q, use sha256, sha1 or sha512", h.Algorithm)
+}
+
+func (h *HMACAuth) timestamp(now time.Time) (string, error) {
+	switch strings.ToLower(h.TimestampFormat) {
+	case "", "unix":
+		return strconv.FormatInt(now.Unix(), 10), nil
+	case "unix_ms":
+		return strconv.FormatInt(now.UnixMilli(), 10), nil
+	case "rfc3339":
+		return now.UTC().Format(time.RFC3339), nil
+	}
+	return "", fmt.Errorf("unknown HMAC timestamp format %q, use unix, unix_ms or rfc3339", h.TimestampFormat)
+}
+
+// optionalHeader returns the header name set, its default when empty, or
+// nothing for "-"
+func optionalHeader(name, fallback string) string {
+	switch name {
+	case "":
+		return fallback
+	case "-":
+		return ""
+	}
+	return name
+}
+
+var hmacPlaceholder = regexp.MustCompile(`\{([^{}\n]+)\}`)
+
+// expandHMACTemplate replaces the placeholders of a template with values
+func expandHMACTemplate(template string, values map[string]string, req *http.Request) (string, error) {
+	var err error
+	expanded := hmacPlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[1 : len(match)-1]
+		if header, found := strings.CutPrefix(name, "header:"); found {
+			return strings.Join(req.Header.Values(strings.TrimSpace(header)), ",")
+		}
+		value, found := values[name]
+		if !found && err == nil {
+			err = fmt.Errorf("unknown placeholder %s in HMAC template", match)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// signHMACRequest signs a request about to be sent. The body is read to
+// hash it.
+func signHMACRequest(req *http.Request, body *requestBody, auth *HMACAuth, now time.Time) error {
+	if auth.Secret == "" {
+		return fmt.Errorf("HMAC auth has no secret")
+	}
+	newHash, err := auth.hash()
+	if err != nil {
+		return err
+	}
+	timestamp, err := auth.timestamp(now)
+	if err != nil {
+		return err
+	}
+
+	bodyHash := newHash()
+	if body != nil {
+		reader, err := body.open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(bodyHash, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	nonce := randomToken(16)
+	if name := optionalHeader(auth.TimestampHeader, DefaultHMACTimestampHeader); name != "" {
+		req.Header.Set(name, timestamp)
+	}
+	if name := optionalHeader(auth.NonceHeader, DefaultHMACNonceHeader); name != "" {
+		req.Header.Set(name, nonce)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	values := map[string]string{
+		"method":      req.Method,
+		"path":        path,
+		"query":       req.URL.RawQuery,
+		"url":         req.URL.String(),
+		"host":        host,
+		"timestamp":   timestamp,
+		"nonce":       nonce,
+		"bodyHash":    hex.EncodeToString(bodyHash.Sum(nil)),
+		"contentType": req.Header.Get("Content-Type"),
+		"keyId":       auth.KeyID,
+	}
+
+	template := auth.Template
+	if template == "" {
+		template = DefaultHMACTemplate
+	}
+	canonical, err := expandHMACTemplate(template, values, req)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(newHash, []byte(auth.Secret))
+	mac.Write([]byte(canonical))
+	switch strings.ToLower(auth.Encoding) {
+	case "", "hex":
+		values["signature"] = hex.EncodeToString(mac.Sum(nil))
+	case "base64":
+		values["signature"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	default:
+		return fmt.Errorf("unknown HMAC encoding %q, use hex or base64", auth.Encoding)
+	}
+
+	format := auth.Value
+	if format == "" {
+		format = DefaultHMACValue
+	}
+	value, err := expandHMACTemplate(format, values, req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(auth.header(), value)
+	return nil
+}
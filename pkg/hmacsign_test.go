@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hmacOf returns the HMAC of message with key "secret"
+func hmacOf(newHash func() hash.Hash, message string) []byte {
+	mac := hmac.New(newHash, []byte("secret"))
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func hashHex(newHash func() hash.Hash, data string) string {
+	h := newHash()
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestHMACAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    HMACAuth
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+
+		// want returns the header the signature should be sent in and its
+		// value, computed from the request the server received
+		want        func(r *http.Request, body string) (string, string)
+		wantAbsent  []string
+		wantError   string
+		checkHeader func(t *testing.T, r *http.Request)
+	}{
+		{
+			name:   "defaults",
+			auth:   HMACAuth{KeyID: "key", Secret: "secret"},
+			method: "POST",
+			path:   "/orders?page=2&sort=asc",
+			body:   `{"id":1}`,
+			want: func(r *http.Request, body string) (string, string) {
+				message := strings.Join([]string{"POST", "/orders", "page=2&sort=asc",
+					r.Header.Get("X-Timestamp"), r.Header.Get("X-Nonce"), hashHex(sha256.New, body)}, "\n")
+				return "Authorization", "HMAC key:" + hex.EncodeToString(hmacOf(sha256.New, message))
+			},
+			checkHeader: func(t *testing.T, r *http.Request) {
+				timestamp, err := strconv.ParseInt(r.Header.Get("X-Timestamp"), 10, 64)
+				if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+					t.Fatalf("X-Timestamp %q, want the current Unix time", r.Header.Get("X-Timestamp"))
+				}
+				if len(r.Header.Get("X-Nonce")) == 0 {
+					t.Fatal("no X-Nonce sent")
+				}
+			},
+		},
+		{
+			name:   "empty path and body",
+			auth:   HMACAuth{KeyID: "key", Secret: "secret"},
+			method: "GET",
+			want: func(r *http.Request, body string) (string, string) {
+				message := strings.Join([]string{"GET", "/", "",
+					r.Header.Get("X-Timestamp"), r.Header.Get("X-Nonce"), hashHex(sha256.New, "")}, "\n")
+				return "Authorization", "HMAC key:" + hex.EncodeToString(hmacOf(sha256.New, message))
+			},
+		},
+		{
+			name: "SHA-512 in base64 in another header",
+			auth: HMACAuth{
+				Secret:          "secret",
+				Algorithm:       "SHA-512",
+				Encoding:        "base64",
+				Template:        "{method} {host}{path} {header:X-Request-Id} {contentType}",
+				Header:          "X-Signature",
+				Value:           "{signature}",
+				TimestampHeader: "-",
+				NonceHeader:     "-",
+			},
+			method:  "PUT",
+			path:    "/items/7",
+			body:    "a=1",
+			headers: map[string]string{"X-Request-Id": "r-1", "Content-Type": "application/x-www-form-urlencoded"},
+			want: func(r *http.Request, body string) (string, string) {
+				message := "PUT " + r.Host + "/items/7 r-1 application/x-www-form-urlencoded"
+				return "X-Signature", base64.StdEncoding.EncodeToString(hmacOf(sha512.New, message))
+			},
+			wantAbsent: []string{"Authorization", "X-Timestamp", "X-Nonce"},
+		},
+		{
+			name:   "RFC 3339 timestamp in its own header",
+			auth:   HMACAuth{KeyID: "key", Secret: "secret", Template: "{timestamp}", TimestampHeader: "X-Date", TimestampFormat: "rfc3339"},
+			method: "GET",
+			path:   "/",
+			want: func(r *http.Request, body string) (string, string) {
+				return "Authorization", "HMAC key:" + hex.EncodeToString(hmacOf(sha256.New, r.Header.Get("X-Date")))
+			},
+			wantAbsent: []string{"X-Timestamp"},
+			checkHeader: func(t *testing.T, r *http.Request) {
+				if _, err := time.Parse(time.RFC3339, r.Header.Get("X-Date")); err != nil {
+					t.Fatalf("X-Date %q, want an RFC 3339 time", r.Header.Get("X-Date"))
+				}
+			},
+		},
+		{
+			name:      "unknown placeholder",
+			auth:      HMACAuth{Secret: "secret", Template: "{method}{date}"},
+			method:    "GET",
+			wantError: "unknown placeholder {date}",
+		},
+		{
+			name:      "unknown algorithm",
+			auth:      HMACAuth{Secret: "secret", Algorithm: "md5"},
+			method:    "GET",
+			wantError: "unknown HMAC algorithm",
+		},
+		{
+			name:      "no secret",
+			auth:      HMACAuth{KeyID: "key"},
+			method:    "GET",
+			wantError: "HMAC auth has no secret",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received *http.Request
+			var receivedBody string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received, receivedBody = r, string(body)
+			}))
+			defer server.Close()
+
+			auth := test.auth
+			response := NewRequestEngine().Execute(context.Background(), APIRequest{
+				Method:  test.method,
+				URL:     server.URL + test.path,
+				Headers: test.headers,
+				Body:    test.body,
+				Auth:    &RequestAuth{Type: AuthHMAC, HMAC: &auth},
+			})
+			if test.wantError != "" {
+				if !strings.Contains(response.Error, test.wantError) {
+					t.Fatalf("error %q, want it to contain %q", response.Error, test.wantError)
+				}
+				if received != nil {
+					t.Fatal("request sent without its signature")
+				}
+				return
+			}
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, error %q", response.StatusCode, response.Error)
+			}
+
+			header, want := test.want(received, receivedBody)
+			if got := received.Header.Get(header); got != want {
+				t.Fatalf("%s %q, want %q", header, got, want)
+			}
+			for _, name := range test.wantAbsent {
+				if value := received.Header.Get(name); value != "" {
+					t.Fatalf("%s %q sent, want none", name, value)
+				}
+			}
+			if test.checkHeader != nil {
+				test.checkHeader(t, received)
+			}
+		})
+	}
+}
+
+func TestHMACNonceChanges(t *testing.T) {
+	var nonces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, r.Header.Get("X-Nonce"))
+	}))
+	defer server.Close()
+
+	engine := NewRequestEngine()
+	request := APIRequest{Method: "GET", URL: server.URL, Auth: &RequestAuth{Type: AuthHMAC, HMAC: &HMACAuth{Secret: "secret"}}}
+	for i := 0; i < 2; i++ {
+		if response := engine.Execute(context.Background(), request); response.StatusCode != http.StatusOK {
+			t.Fatalf("status %d, error %q", response.StatusCode, response.Error)
+		}
+	}
+	if len(nonces) != 2 || nonces[0] == "" || nonces[0] == nonces[1] {
+		t.Fatalf("nonces %q, want a new one for every request", nonces)
+	}
+}
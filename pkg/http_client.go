@@ -1,66 +1,221 @@
 package pkg
 
 import (
-	"bytes"
-	"io/ioutil"
-	"net/http"
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
 	"time"
 )
 
 // MakeHTTPRequest sends an HTTP request with the specified method and returns structured response data
 func MakeHTTPRequest(method, url, body string, headers map[string]string) APIResponse {
-	start := time.Now()
-	
-	// Create request
-	var req *http.Request
-	var err error
-	
-	if body != "" {
-		req, err = http.NewRequest(method, url, bytes.NewBufferString(body))
-	} else {
-		req, err = http.NewRequest(method, url, nil)
+	return MakeHTTPRequestContext(context.Background(), method, url, body, headers)
+}
+
+// MakeHTTPRequestContext is like MakeHTTPRequest but aborts the request when ctx is cancelled
+func MakeHTTPRequestContext(ctx context.Context, method, url, body string, headers map[string]string) APIResponse {
+	return defaultEngine.Execute(ctx, APIRequest{
+		Method:  method,
+		URL:     url,
+		Headers: headers,
+		Body:    body,
+	})
+}
+
+// cliCookies keeps cookies between the requests of an interactive session
+var cliCookies = NewCookieJar()
+
+// makeCLIRequest sends a request for the interactive CLI. Bodies larger than
+// the in-memory limit are kept in a temporary file so nothing is lost.
+func makeCLIRequest(method, url, body string, headers map[string]string) APIResponse {
+	return defaultEngine.Execute(context.Background(), APIRequest{
+		Method:  method,
+		URL:     url,
+		Headers: headers,
+		Body:    body,
+		Options: RequestOptions{
+			SpillToFile: true,
+			Cookies:     cliCookies,
+		},
+	})
+}
+
+// HandleDownloadRequest streams the body of a GET request to path, showing progress
+func HandleDownloadRequest(url, path string) {
+	response := defaultEngine.Execute(context.Background(), APIRequest{
+		Method: "GET",
+		URL:    url,
+		Options: RequestOptions{
+			// Large downloads should not hit the default request timeout
+			Timeout:  24 * time.Hour,
+			SaveTo:   path,
+			Progress: printProgress,
+			Cookies:  cliCookies,
+		},
+	})
+	fmt.Println()
+
+	if response.Error != "" {
+		fmt.Printf("Error: %s\n", response.Error)
+		return
 	}
-	
-	if err != nil {
-		return APIResponse{
-			Error:        err.Error(),
-			ResponseTime: time.Since(start),
-		}
+
+	fmt.Printf("Status: %s\n", response.Status)
+	fmt.Printf("Response Time: %v\n", response.ResponseTime)
+	fmt.Printf("Saved %d bytes to %s\n", response.BodySize, response.BodyFile)
+}
+
+// HandleEventStreamRequest subscribes to a Server-Sent Events stream and
+// prints events as they arrive, reconnecting when the stream drops, until
+// Ctrl+C is pressed
+func HandleEventStreamRequest(url string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Println("Listening for events, press Ctrl+C to stop")
+	response := defaultEngine.Execute(ctx, APIRequest{
+		Method: "GET",
+		URL:    url,
+		Options: RequestOptions{
+			Cookies: cliCookies,
+			EventStream: &SSEOptions{
+				Reconnect: true,
+				OnEvent:   printEvent,
+			},
+		},
+	})
+	fmt.Println()
+
+	if response.Error != "" && response.StatusCode == 0 {
+		fmt.Printf("Error: %s\n", response.Error)
+		return
 	}
 
-	// Set headers
-	for key, value := range headers {
-		req.Header.Set(key, value)
+	fmt.Printf("Status: %s\n", response.Status)
+	if !isEventStream(response.ContentType) {
+		fmt.Printf("Not an event stream (Content-Type %q)\n", response.ContentType)
+		printBody(response)
+		return
 	}
+	fmt.Printf("Received %d events in %v\n", len(response.Events), response.ResponseTime)
+}
 
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return APIResponse{
-			Error:        err.Error(),
-			ResponseTime: time.Since(start),
+// HandleGRPCRequest calls a gRPC method with a JSON request message and
+// prints the status, metadata and response messages
+func HandleGRPCRequest(url, method, message string) {
+	response := defaultEngine.Execute(context.Background(), APIRequest{
+		Method: "GRPC",
+		URL:    url,
+		Body:   message,
+		GRPC:   &GRPCRequest{Method: method},
+	})
+
+	if response.GRPCStatus == nil {
+		fmt.Printf("Error: %s\n", response.Error)
+		return
+	}
+
+	fmt.Printf("Status: %s", response.GRPCStatus.Name)
+	if response.GRPCStatus.Message != "" {
+		fmt.Printf(" (%s)", response.GRPCStatus.Message)
+	}
+	fmt.Println()
+	fmt.Printf("Response Time: %v\n", response.ResponseTime)
+	for _, field := range response.RawHeaders {
+		fmt.Printf("Header %s: %s\n", field.Name, field.Value)
+	}
+	for _, field := range response.Trailers {
+		fmt.Printf("Trailer %s: %s\n", field.Name, field.Value)
+	}
+	for _, entry := range response.Messages {
+		if entry.Direction == "received" {
+			fmt.Println(entry.Data)
 		}
 	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	responseBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return APIResponse{
-			StatusCode:   resp.StatusCode,
-			Status:       resp.Status,
-			Headers:      convertHeaders(resp.Header),
-			Error:        "Error reading response body: " + err.Error(),
-			ResponseTime: time.Since(start),
+}
+
+// HandleWebSocketSession opens a WebSocket and sends each line typed as a
+// message, printing the messages of both sides as they happen. Lines
+// starting with /json or /binary send that type, /log prints the session so
+// far and /close or end of input closes the connection.
+func HandleWebSocketSession(url string, subprotocols []string) {
+	session, response := defaultEngine.OpenWebSocket(context.Background(), APIRequest{
+		Method: "GET",
+		URL:    url,
+		Options: RequestOptions{
+			Cookies: cliCookies,
+			WebSocket: &WebSocketOptions{
+				Subprotocols: subprotocols,
+				OnMessage:    printWebSocketEntry,
+			},
+		},
+	})
+	if session == nil {
+		fmt.Printf("Error: %s\n", response.Error)
+		if response.Body != "" {
+			fmt.Println(response.Body)
 		}
+		return
+	}
+
+	fmt.Printf("Connected (%s) in %v", response.Status, response.ResponseTime)
+	if protocol := session.Subprotocol(); protocol != "" {
+		fmt.Printf(", subprotocol %s", protocol)
 	}
+	fmt.Println()
+	fmt.Println("Type a message and press Enter; /json, /binary, /log and /close are commands")
 
-	return APIResponse{
-		StatusCode:   resp.StatusCode,
-		Status:       resp.Status,
-		Headers:      convertHeaders(resp.Header),
-		Body:         string(responseBody),
-		ResponseTime: time.Since(start),
+	// Stdin is read here rather than in a goroutine, which would stay blocked
+	// on it after the session and take the next line typed into the menu
+	finished := make(chan struct{})
+	closeSession := func() {
+		close(finished)
+		session.Close()
+		fmt.Println("Connection closed")
+	}
+	go func() {
+		select {
+		case <-session.Done():
+			fmt.Println("Connection closed by the server, press Enter to continue")
+		case <-finished:
+		}
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if !scanner.Scan() {
+			closeSession()
+			return
+		}
+		line := scanner.Text()
+
+		select {
+		case <-session.Done():
+			return
+		default:
+		}
+		if line == "/close" {
+			closeSession()
+			return
+		}
+		if line == "/log" {
+			for _, entry := range session.Log() {
+				printWebSocketEntry(entry)
+			}
+			continue
+		}
+
+		message := WebSocketMessage{Type: WebSocketText, Data: line}
+		for _, messageType := range []string{WebSocketJSON, WebSocketBinary} {
+			if rest, found := strings.CutPrefix(line, "/"+messageType+" "); found {
+				message = WebSocketMessage{Type: messageType, Data: rest}
+			}
+		}
+		if err := session.Send(message); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
 	}
-}
\ No newline at end of file
+}
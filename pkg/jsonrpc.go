@@ -0,0 +1,250 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONRPCCall is one JSON-RPC 2.0 call
+type JSONRPCCall struct {
+	Method       string          `json:"method"`
+	Params       json.RawMessage `json:"params,omitempty"`       // array or object
+	ID           json.RawMessage `json:"id,omitempty"`           // number or string, numbered from 1 when empty
+	Notification bool            `json:"notification,omitempty"` // sent without an id, the server does not answer
+}
+
+// JSONRPCRequest builds the body of a request from a JSON-RPC 2.0 call, or
+// from a batch of calls when Batch is set
+type JSONRPCRequest struct {
+	JSONRPCCall
+	Batch []JSONRPCCall `json:"batch,omitempty"`
+}
+
+// JSONRPCResponse is the answer to one call
+type JSONRPCResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *JSONRPCError   `json:"error,omitempty"`
+}
+
+// JSONRPCError is the error object of a failed call
+type JSONRPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e JSONRPCError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// substitute returns a copy with replace applied to the method and params
+// of every call, or nil for a nil request
+func (j *JSONRPCRequest) substitute(replace func(string) string) *JSONRPCRequest {
+	if j == nil {
+		return nil
+	}
+	substituteCall := func(call JSONRPCCall) JSONRPCCall {
+		call.Method = replace(call.Method)
+		if len(call.Params) > 0 {
+			call.Params = json.RawMessage(replace(string(call.Params)))
+		}
+		return call
+	}
+	copied := *j
+	copied.JSONRPCCall = substituteCall(j.JSONRPCCall)
+	if j.Batch != nil {
+		copied.Batch = make([]JSONRPCCall, len(j.Batch))
+		for i, call := range j.Batch {
+			copied.Batch[i] = substituteCall(call)
+		}
+	}
+	return &copied
+}
+
+// calls returns the calls to send with their ids filled in
+func (j *JSONRPCRequest) calls() []JSONRPCCall {
+	calls := []JSONRPCCall{j.JSONRPCCall}
+	if len(j.Batch) > 0 {
+		calls = append([]JSONRPCCall{}, j.Batch...)
+	}
+	for i := range calls {
+		if !calls[i].Notification && len(calls[i].ID) == 0 {
+			calls[i].ID = json.RawMessage(strconv.Itoa(i + 1))
+		}
+	}
+	return calls
+}
+
+// payload returns the JSON body for the calls
+func (j *JSONRPCRequest) payload(calls []JSONRPCCall) ([]byte, error) {
+	messages := make([]map[string]interface{}, len(calls))
+	for i, call := range calls {
+		if call.Method == "" {
+			return nil, fmt.Errorf("JSON-RPC call %d has no method", i+1)
+		}
+		message := map[string]interface{}{"jsonrpc": "2.0", "method": call.Method}
+		if len(call.Params) > 0 {
+			trimmed := bytes.TrimSpace(call.Params)
+			if !json.Valid(trimmed) || (trimmed[0] != '[' && trimmed[0] != '{') {
+				return nil, fmt.Errorf("params of JSON-RPC call %q must be an array or object", call.Method)
+			}
+			message["params"] = json.RawMessage(trimmed)
+		}
+		if !call.Notification {
+			message["id"] = call.ID
+		}
+		messages[i] = message
+	}
+
+	var body interface{} = messages[0]
+	if len(j.Batch) > 0 {
+		body = messages
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(body); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// expandJSONRPC turns a JSON-RPC request into the plain HTTP request sent
+// for it and returns the calls it makes
+func expandJSONRPC(request APIRequest) (APIRequest, []JSONRPCCall, error) {
+	jsonRPC := request.JSONRPC
+	request.JSONRPC = nil
+
+	calls := jsonRPC.calls()
+	body, err := jsonRPC.payload(calls)
+	if err != nil {
+		return request, nil, err
+	}
+	request.Method = "POST"
+	request.Body, request.BodyType, request.Form = string(body), BodyTypeRaw, nil
+	if !request.HeaderFields().Has("Content-Type") {
+		request.RawHeaders = append(append(HeaderList{}, request.RawHeaders...), HeaderField{Name: "Content-Type", Value: "application/json"})
+	}
+	if !request.HeaderFields().Has("Accept") {
+		request.RawHeaders = append(append(HeaderList{}, request.RawHeaders...), HeaderField{Name: "Accept", Value: "application/json"})
+	}
+	return request, calls, nil
+}
+
+// parseJSONRPCResponses parses a single or batch response body and orders
+// the answers like the calls. Answers whose id matches no call, such as
+// parse errors with a null id, come last.
+func parseJSONRPCResponses(body string, calls []JSONRPCCall) []JSONRPCResponse {
+	body = strings.TrimSpace(body)
+	var responses []JSONRPCResponse
+	if strings.HasPrefix(body, "[") {
+		if json.Unmarshal([]byte(body), &responses) != nil {
+			return nil
+		}
+	} else {
+		var response JSONRPCResponse
+		if json.Unmarshal([]byte(body), &response) != nil || (response.Result == nil && response.Error == nil) {
+			return nil
+		}
+		responses = []JSONRPCResponse{response}
+	}
+
+	byID := make(map[string]JSONRPCResponse)
+	var unmatched []JSONRPCResponse
+	for _, response := range responses {
+		key := compactJSON(response.ID)
+		if _, seen := byID[key]; seen || key == "" || key == "null" {
+			unmatched = append(unmatched, response)
+			continue
+		}
+		byID[key] = response
+	}
+
+	var ordered []JSONRPCResponse
+	for _, call := range calls {
+		if call.Notification {
+			continue
+		}
+		if response, found := byID[compactJSON(call.ID)]; found {
+			ordered = append(ordered, response)
+			delete(byID, compactJSON(call.ID))
+		}
+	}
+	for _, response := range responses {
+		if _, left := byID[compactJSON(response.ID)]; left {
+			ordered = append(ordered, response)
+			delete(byID, compactJSON(response.ID))
+		}
+	}
+	return append(ordered, unmatched...)
+}
+
+func compactJSON(data json.RawMessage) string {
+	var buffer bytes.Buffer
+	if json.Compact(&buffer, data) != nil {
+		return string(data)
+	}
+	return buffer.String()
+}
+
+// executeJSONRPC sends the calls of a JSON-RPC request and parses the answers
+func (e *RequestEngine) executeJSONRPC(ctx context.Context, request APIRequest) APIResponse {
+	start := time.Now()
+	expanded, calls, err := expandJSONRPC(request)
+	if err != nil {
+		return APIResponse{Error: err.Error(), ResponseTime: time.Since(start)}
+	}
+	response := e.Execute(ctx, expanded)
+	response.JSONRPC = parseJSONRPCResponses(response.Body, calls)
+	return response
+}
+
+// jsonRPCProperty looks up a value of the JSON-RPC answers for an assertion.
+// Property is "count", "errors" (the number of failed calls) or a path into
+// an answer such as "result.name", "error.code" or "id", prefixed with the
+// answer's index in a batch, e.g. "1.error.message". The error of a call
+// that succeeded is null.
+func jsonRPCProperty(responses []JSONRPCResponse, property string) (interface{}, error) {
+	switch property {
+	case "count":
+		return len(responses), nil
+	case "errors", "":
+		failed := 0
+		for _, response := range responses {
+			if response.Error != nil {
+				failed++
+			}
+		}
+		return failed, nil
+	}
+
+	index := 0
+	if first, rest, _ := strings.Cut(property, "."); first != "" && (first[0] == '-' || isDigits(first)) {
+		i, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON-RPC answer index %q", first)
+		}
+		index, property = i, rest
+	}
+	if index < 0 {
+		index += len(responses)
+	}
+	if index < 0 || index >= len(responses) {
+		return nil, fmt.Errorf("JSON-RPC answer %d not received, got %d answers", index, len(responses))
+	}
+
+	response := responses[index]
+	if response.Error == nil && (property == "error" || strings.HasPrefix(property, "error.")) {
+		return nil, nil
+	}
+	var value interface{}
+	data, _ := json.Marshal(response)
+	json.Unmarshal(data, &value)
+	return jsonValue(value, property)
+}
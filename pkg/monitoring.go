@@ -3,9 +3,7 @@ package pkg
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"sync"
 	"time"
 )
@@ -13,7 +11,8 @@ import (
 type MonitorService struct {
 	monitors map[uint]*MonitorInstance
 	mutex    sync.RWMutex
-	client   *http.Client
+	engine   *RequestEngine
+	tokens   *OAuth2TokenStore
 }
 
 type MonitorInstance struct {
@@ -74,9 +73,8 @@ type UptimeMetric struct {
 func NewMonitorService() *MonitorService {
 	return &MonitorService{
 		monitors: make(map[uint]*MonitorInstance),
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		engine:   DefaultEngine(),
+		tokens:   NewOAuth2TokenStore(),
 	}
 }
 
@@ -88,6 +86,17 @@ func (ms *MonitorService) CreateMonitor(workspaceID uint, userID uint, monitor A
 		return nil, fmt.Errorf("access denied to workspace")
 	}
 
+	if monitor.Auth != nil {
+		authType, authData, err := monitor.Auth.Columns()
+		if err != nil {
+			return nil, err
+		}
+		monitor.AuthType, monitor.AuthData, monitor.Auth = authType, authData, nil
+	}
+	if _, err := ParseRequestAuth(monitor.AuthType, monitor.AuthData); err != nil {
+		return nil, err
+	}
+
 	monitor.WorkspaceID = workspaceID
 	monitor.CreatedBy = userID
 	monitor.IsActive = true
@@ -167,36 +176,41 @@ func (ms *MonitorService) runMonitor(instance *MonitorInstance) {
 
 // performCheck executes a single monitor check
 func (ms *MonitorService) performCheck(monitor APIMonitor) {
-	startTime := time.Now()
-	
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.Timeout)*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, monitor.Method, monitor.URL, nil)
-	if err != nil {
-		ms.recordCheck(monitor.ID, 0, 0, false, err.Error())
-		return
+	request := APIRequest{
+		Method: monitor.Method,
+		URL:    monitor.URL,
+		Options: RequestOptions{
+			Timeout:        time.Duration(monitor.Timeout) * time.Second,
+			RateLimitScope: WorkspaceRateLimitScope(monitor.WorkspaceID),
+			OAuth2Tokens:   ms.tokens.Tokens(monitor.CreatedBy, monitor.WorkspaceID),
+		},
+	}
+	if monitor.Proxy != "" {
+		request.Options.Proxy = &ProxyOptions{URL: monitor.Proxy}
 	}
 
 	// Add headers if specified
 	if monitor.Headers != "" {
-		var headers map[string]string
-		if err := json.Unmarshal([]byte(monitor.Headers), &headers); err == nil {
-			for key, value := range headers {
-				req.Header.Set(key, value)
-			}
+		if headers, err := ParseHeaderList(monitor.Headers); err == nil {
+			request.RawHeaders = headers
 		}
 	}
 
-	resp, err := ms.client.Do(req)
-	responseTime := time.Since(startTime)
-
+	auth, err := ParseRequestAuth(monitor.AuthType, monitor.AuthData)
 	if err != nil {
-		ms.recordCheck(monitor.ID, 0, responseTime.Milliseconds(), false, err.Error())
-		ms.handleAlert(monitor, "downtime", fmt.Sprintf("Monitor check failed: %s", err.Error()))
+		ms.recordCheck(monitor.ID, 0, 0, false, err.Error())
+		return
+	}
+	request.Auth = auth
+
+	resp := ms.engine.Execute(context.Background(), request)
+	responseTime := resp.ResponseTime
+
+	if resp.StatusCode == 0 {
+		ms.recordCheck(monitor.ID, 0, responseTime.Milliseconds(), false, resp.Error)
+		ms.handleAlert(monitor, "downtime", fmt.Sprintf("Monitor check failed: %s", resp.Error))
 		return
 	}
-	defer resp.Body.Close()
 
 	success := resp.StatusCode >= 200 && resp.StatusCode < 400
 	errorMsg := ""
@@ -0,0 +1,591 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth 2.0 grant types
+const (
+	OAuth2ClientCredentials = "client_credentials"
+	OAuth2Password          = "password"
+	OAuth2AuthorizationCode = "authorization_code"
+	OAuth2RefreshToken      = "refresh_token"
+)
+
+const (
+	// DefaultOAuth2Variable is the variable holding the access token when
+	// OAuth2Auth.Variable is not set
+	DefaultOAuth2Variable = "oauth2_token"
+	// oauth2RefreshLeeway is how long before expiry a token is refreshed
+	oauth2RefreshLeeway = 30 * time.Second
+	// oauth2AuthorizeTimeout bounds the wait for the authorization redirect
+	oauth2AuthorizeTimeout = 5 * time.Minute
+)
+
+// OAuth2Auth obtains an access token from a token endpoint and sends it as a
+// bearer token. Tokens are cached per environment, in the cache of the
+// request's options, and refreshed before they expire or when the server
+// answers 401.
+type OAuth2Auth struct {
+	Grant        string            `json:"grant"` // client_credentials, password, authorization_code or refresh_token
+	TokenURL     string            `json:"tokenUrl"`
+	AuthURL      string            `json:"authUrl,omitempty"` // authorization endpoint, for the authorization_code grant
+	ClientID     string            `json:"clientId"`
+	ClientSecret string            `json:"clientSecret,omitempty"`
+	ClientAuth   string            `json:"clientAuth,omitempty"` // header (HTTP basic, default) or body
+	Scope        string            `json:"scope,omitempty"`      // space separated
+	Username     string            `json:"username,omitempty"`   // for the password grant
+	Password     string            `json:"password,omitempty"`
+	RefreshToken string            `json:"refreshToken,omitempty"` // for the refresh_token grant
+	RedirectURL  string            `json:"redirectUrl,omitempty"`  // loopback URL, http://127.0.0.1:<random port>/callback when empty
+	Params       map[string]string `json:"params,omitempty"`       // extra parameters, such as audience
+	Prefix       string            `json:"prefix,omitempty"`       // scheme before the token, Bearer when empty
+	Variable     string            `json:"variable,omitempty"`     // variable exposing the access token, DefaultOAuth2Variable when empty
+}
+
+// OAuth2Token is a token obtained from a token endpoint
+type OAuth2Token struct {
+	AccessToken  string    `json:"accessToken"`
+	TokenType    string    `json:"tokenType,omitempty"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt,omitempty"` // zero when the server sent no lifetime
+	refreshAt    time.Time
+}
+
+// valid reports whether the token can still be sent without refreshing it
+func (t *OAuth2Token) valid() bool {
+	return t != nil && t.AccessToken != "" && (t.refreshAt.IsZero() || time.Now().Before(t.refreshAt))
+}
+
+func (o *OAuth2Auth) substitute(replace func(string) string) *OAuth2Auth {
+	if o == nil {
+		return nil
+	}
+	copied := *o
+	copied.TokenURL = replace(o.TokenURL)
+	copied.AuthURL = replace(o.AuthURL)
+	copied.ClientID = replace(o.ClientID)
+	copied.ClientSecret = replace(o.ClientSecret)
+	copied.Scope = replace(o.Scope)
+	copied.Username = replace(o.Username)
+	copied.Password = replace(o.Password)
+	copied.RefreshToken = replace(o.RefreshToken)
+	copied.RedirectURL = replace(o.RedirectURL)
+	if o.Params != nil {
+		copied.Params = make(map[string]string, len(o.Params))
+		for name, value := range o.Params {
+			copied.Params[name] = replace(value)
+		}
+	}
+	return &copied
+}
+
+func (o *OAuth2Auth) variable() string {
+	if o.Variable != "" {
+		return o.Variable
+	}
+	return DefaultOAuth2Variable
+}
+
+func (o *OAuth2Auth) prefix() string {
+	if o.Prefix != "" {
+		return o.Prefix
+	}
+	return "Bearer"
+}
+
+// cacheKey identifies the tokens of a configuration. The secrets are part of
+// it as a hash, so a token obtained with one secret is never sent for
+// another.
+func (o *OAuth2Auth) cacheKey() string {
+	secrets := sha256.Sum256([]byte(strings.Join([]string{o.ClientSecret, o.Password, o.RefreshToken}, "\x00")))
+	return strings.Join([]string{o.Grant, o.TokenURL, o.ClientID, o.Scope, o.Username, hex.EncodeToString(secrets[:])}, "\x00")
+}
+
+// OAuth2TokenCache keeps the tokens obtained in each environment
+type OAuth2TokenCache struct {
+	mutex  sync.Mutex
+	tokens map[oauth2Scope]*oauth2Entry
+}
+
+type oauth2Scope struct {
+	environment string
+	key         string
+}
+
+type oauth2Entry struct {
+	fetching sync.Mutex // held while the token is obtained, so it is fetched once
+	token    *OAuth2Token
+	variable string
+}
+
+// NewOAuth2TokenCache creates an empty token cache
+func NewOAuth2TokenCache() *OAuth2TokenCache {
+	return &OAuth2TokenCache{tokens: make(map[oauth2Scope]*oauth2Entry)}
+}
+
+func (c *OAuth2TokenCache) entry(environment, key string) *oauth2Entry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	scope := oauth2Scope{environment: environment, key: key}
+	if c.tokens[scope] == nil {
+		c.tokens[scope] = &oauth2Entry{}
+	}
+	return c.tokens[scope]
+}
+
+// Variables returns the access tokens of an environment by the variable
+// that exposes them
+func (c *OAuth2TokenCache) Variables(environment string) map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	variables := make(map[string]string)
+	for scope, entry := range c.tokens {
+		if scope.environment == environment && entry.token != nil && entry.variable != "" {
+			variables[entry.variable] = entry.token.AccessToken
+		}
+	}
+	return variables
+}
+
+// Clear drops the tokens of an environment
+func (c *OAuth2TokenCache) Clear(environment string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for scope := range c.tokens {
+		if scope.environment == environment {
+			delete(c.tokens, scope)
+		}
+	}
+}
+
+// OAuth2TokenStore keeps one OAuth2 token cache per user and workspace
+type OAuth2TokenStore struct {
+	mutex  sync.Mutex
+	caches map[cacheOwner]*OAuth2TokenCache
+}
+
+// NewOAuth2TokenStore creates a new token store
+func NewOAuth2TokenStore() *OAuth2TokenStore {
+	return &OAuth2TokenStore{
+		caches: make(map[cacheOwner]*OAuth2TokenCache),
+	}
+}
+
+// Tokens returns the token cache of a user in a workspace
+func (s *OAuth2TokenStore) Tokens(userID, workspaceID uint) *OAuth2TokenCache {
+	owner := cacheOwner{userID: userID, workspaceID: workspaceID}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cache, exists := s.caches[owner]
+	if !exists {
+		cache = NewOAuth2TokenCache()
+		s.caches[owner] = cache
+	}
+	return cache
+}
+
+// OAuth2Tokens returns the engine's OAuth2 token cache
+func (e *RequestEngine) OAuth2Tokens() *OAuth2TokenCache {
+	return e.oauth2Tokens
+}
+
+// tokenCache returns the OAuth2 token cache of a request
+func (e *RequestEngine) tokenCache(opts RequestOptions) *OAuth2TokenCache {
+	if opts.OAuth2Tokens != nil {
+		return opts.OAuth2Tokens
+	}
+	return e.oauth2Tokens
+}
+
+// SetBrowser sets how the authorization URL of the authorization_code grant
+// is opened; by default the system browser is started
+func (e *RequestEngine) SetBrowser(open func(url string) error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.openBrowser = open
+}
+
+// OAuth2Token returns the token for the OAuth2 auth of a request, from the
+// cache of the request's environment unless it is due for a refresh or
+// refresh is set
+func (e *RequestEngine) OAuth2Token(ctx context.Context, request APIRequest, refresh bool) (*OAuth2Token, error) {
+	if request.Auth == nil || request.Auth.Type != AuthOAuth2 || request.Auth.OAuth2 == nil {
+		return nil, fmt.Errorf("request has no OAuth2 auth")
+	}
+	token, _, err := e.oauth2Token(ctx, request, refresh)
+	return token, err
+}
+
+// oauth2Token returns the token to send and whether it was just obtained
+func (e *RequestEngine) oauth2Token(ctx context.Context, request APIRequest, refresh bool) (*OAuth2Token, bool, error) {
+	config := request.Auth.OAuth2
+	tokens := e.tokenCache(request.Options)
+	entry := tokens.entry(request.Options.Environment, config.cacheKey())
+	entry.fetching.Lock()
+	defer entry.fetching.Unlock()
+
+	tokens.mutex.Lock()
+	cached := entry.token
+	tokens.mutex.Unlock()
+	if !refresh && cached.valid() {
+		return cached, false, nil
+	}
+
+	var token *OAuth2Token
+	var err error
+	if cached != nil && cached.RefreshToken != "" {
+		token, err = e.requestToken(ctx, request, url.Values{"grant_type": {OAuth2RefreshToken}, "refresh_token": {cached.RefreshToken}})
+		if token != nil && token.RefreshToken == "" {
+			// The server may keep the refresh token without sending it again
+			token.RefreshToken = cached.RefreshToken
+		}
+	}
+	if token == nil {
+		token, err = e.grantToken(ctx, request)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	tokens.mutex.Lock()
+	entry.token, entry.variable = token, config.variable()
+	tokens.mutex.Unlock()
+	return token, true, nil
+}
+
+// grantToken obtains a new token with the configured grant
+func (e *RequestEngine) grantToken(ctx context.Context, request APIRequest) (*OAuth2Token, error) {
+	config := request.Auth.OAuth2
+	switch config.Grant {
+	case OAuth2ClientCredentials:
+		return e.requestToken(ctx, request, url.Values{"grant_type": {OAuth2ClientCredentials}})
+	case OAuth2Password:
+		return e.requestToken(ctx, request, url.Values{
+			"grant_type": {OAuth2Password},
+			"username":   {config.Username},
+			"password":   {config.Password},
+		})
+	case OAuth2RefreshToken:
+		if config.RefreshToken == "" {
+			return nil, fmt.Errorf("OAuth2 refresh_token grant has no refresh token")
+		}
+		return e.requestToken(ctx, request, url.Values{"grant_type": {OAuth2RefreshToken}, "refresh_token": {config.RefreshToken}})
+	case OAuth2AuthorizationCode:
+		if !e.localAccess.Load() {
+			// It opens a browser and listens for the redirect on this machine
+			return nil, fmt.Errorf("OAuth2 authorization_code grant is only available from the CLI")
+		}
+		return e.authorizationCode(ctx, request)
+	default:
+		return nil, fmt.Errorf("unknown OAuth2 grant %q", config.Grant)
+	}
+}
+
+// requestToken posts a token request with the client's credentials and the
+// options of the request that needs the token
+func (e *RequestEngine) requestToken(ctx context.Context, request APIRequest, params url.Values) (*OAuth2Token, error) {
+	config := request.Auth.OAuth2
+	if config.TokenURL == "" {
+		return nil, fmt.Errorf("OAuth2 auth has no token URL")
+	}
+	if config.Scope != "" && params.Get("grant_type") != OAuth2AuthorizationCode {
+		params.Set("scope", config.Scope)
+	}
+	for name, value := range config.Params {
+		params.Set(name, value)
+	}
+
+	tokenRequest := APIRequest{
+		Method:   "POST",
+		URL:      config.TokenURL,
+		Headers:  map[string]string{"Accept": "application/json"},
+		BodyType: BodyTypeURLEncoded,
+		Options: RequestOptions{
+			Timeout:        request.Options.Timeout,
+			TLS:            request.Options.TLS,
+			Proxy:          request.Options.Proxy,
+			Resolve:        request.Options.Resolve,
+			RateLimitScope: request.Options.RateLimitScope,
+		},
+	}
+	// Client credentials go in a basic auth header unless the body is asked
+	// for; a public client without a secret only names itself
+	if config.ClientSecret != "" && !strings.EqualFold(config.ClientAuth, "body") {
+		tokenRequest.Auth = &RequestAuth{Type: AuthBasic, Basic: &BasicAuth{
+			Username: url.QueryEscape(config.ClientID),
+			Password: url.QueryEscape(config.ClientSecret),
+		}}
+	} else {
+		params.Set("client_id", config.ClientID)
+		if config.ClientSecret != "" {
+			params.Set("client_secret", config.ClientSecret)
+		}
+	}
+	for name, values := range params {
+		for _, value := range values {
+			tokenRequest.Form = append(tokenRequest.Form, FormField{Name: name, Value: value})
+		}
+	}
+
+	response := e.Execute(ctx, tokenRequest)
+	if response.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s", response.Error)
+	}
+	return parseOAuth2Token(response)
+}
+
+// parseOAuth2Token reads a token response, JSON or form encoded
+func parseOAuth2Token(response APIResponse) (*OAuth2Token, error) {
+	var fields struct {
+		AccessToken      string      `json:"access_token"`
+		TokenType        string      `json:"token_type"`
+		RefreshToken     string      `json:"refresh_token"`
+		Scope            string      `json:"scope"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	if err := json.Unmarshal([]byte(response.Body), &fields); err != nil {
+		// Some servers answer form encoded
+		values, formErr := url.ParseQuery(response.Body)
+		if formErr != nil || (values.Get("access_token") == "" && values.Get("error") == "") {
+			if response.StatusCode < 300 {
+				return nil, fmt.Errorf("invalid token response: %v", err)
+			}
+		}
+		fields.AccessToken, fields.TokenType = values.Get("access_token"), values.Get("token_type")
+		fields.RefreshToken, fields.Scope = values.Get("refresh_token"), values.Get("scope")
+		fields.ExpiresIn = json.Number(values.Get("expires_in"))
+		fields.Error, fields.ErrorDescription = values.Get("error"), values.Get("error_description")
+	}
+
+	if fields.Error != "" {
+		if fields.ErrorDescription != "" {
+			return nil, fmt.Errorf("token request failed: %s: %s", fields.Error, fields.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token request failed: %s", fields.Error)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, fmt.Errorf("token request failed with status %s", response.Status)
+	}
+	if fields.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access_token")
+	}
+
+	token := &OAuth2Token{
+		AccessToken:  fields.AccessToken,
+		TokenType:    fields.TokenType,
+		RefreshToken: fields.RefreshToken,
+		Scope:        fields.Scope,
+	}
+	if seconds, err := fields.ExpiresIn.Float64(); err == nil && seconds > 0 {
+		lifetime := time.Duration(seconds * float64(time.Second))
+		leeway := oauth2RefreshLeeway
+		if leeway > lifetime/10 {
+			leeway = lifetime / 10
+		}
+		token.ExpiresAt = time.Now().Add(lifetime)
+		token.refreshAt = token.ExpiresAt.Add(-leeway)
+	}
+	return token, nil
+}
+
+// authorizationCode runs the authorization code grant with PKCE: the
+// authorization URL is opened in a browser and the code is received on a
+// loopback redirect listener, then exchanged for a token
+func (e *RequestEngine) authorizationCode(ctx context.Context, request APIRequest) (*OAuth2Token, error) {
+	config := request.Auth.OAuth2
+	if config.AuthURL == "" {
+		return nil, fmt.Errorf("OAuth2 authorization_code grant has no authorization URL")
+	}
+
+	redirect, err := url.Parse(config.RedirectURL)
+	if config.RedirectURL == "" {
+		redirect, err = url.Parse("http://127.0.0.1:0/callback")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URL: %v", err)
+	}
+	switch redirect.Hostname() {
+	case "127.0.0.1", "localhost", "::1":
+	default:
+		return nil, fmt.Errorf("redirect URL must be a loopback address, got %q", redirect.Host)
+	}
+	if redirect.Scheme != "http" {
+		return nil, fmt.Errorf("redirect URL must use http, got %q", redirect.Scheme)
+	}
+	port := redirect.Port()
+	if port == "" {
+		port = "80"
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(redirect.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for the redirect: %v", err)
+	}
+	defer listener.Close()
+	if port == "0" {
+		redirect.Host = net.JoinHostPort(redirect.Hostname(), fmt.Sprint(listener.Addr().(*net.TCPAddr).Port))
+	}
+	if redirect.Path == "" {
+		redirect.Path = "/"
+	}
+
+	verifier, state := randomToken(32), randomToken(16)
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := url.Parse(config.AuthURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization URL: %v", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", config.ClientID)
+	query.Set("redirect_uri", redirect.String())
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	if config.Scope != "" {
+		query.Set("scope", config.Scope)
+	}
+	for name, value := range config.Params {
+		query.Set(name, value)
+	}
+	authURL.RawQuery = query.Encode()
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != redirect.Path {
+			http.NotFound(w, r)
+			return
+		}
+		values := r.URL.Query()
+		var received result
+		switch {
+		case values.Get("state") != state:
+			received.err = fmt.Errorf("authorization redirect has the wrong state")
+		case values.Get("error") != "":
+			received.err = fmt.Errorf("authorization failed: %s %s", values.Get("error"), values.Get("error_description"))
+		case values.Get("code") == "":
+			received.err = fmt.Errorf("authorization redirect has no code")
+		default:
+			received.code = values.Get("code")
+		}
+		if received.err != nil {
+			http.Error(w, received.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Authorization complete, you can close this window.")
+		}
+		select {
+		case results <- received:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	e.mutex.Lock()
+	open := e.openBrowser
+	e.mutex.Unlock()
+	if open == nil {
+		open = openBrowser
+	}
+	if err := open(authURL.String()); err != nil {
+		return nil, fmt.Errorf("cannot open the authorization URL: %v", err)
+	}
+
+	timer := time.NewTimer(oauth2AuthorizeTimeout)
+	defer timer.Stop()
+	var received result
+	select {
+	case received = <-results:
+	case <-timer.C:
+		return nil, fmt.Errorf("no authorization redirect within %s", oauth2AuthorizeTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if received.err != nil {
+		return nil, received.err
+	}
+
+	return e.requestToken(ctx, request, url.Values{
+		"grant_type":    {OAuth2AuthorizationCode},
+		"code":          {received.code},
+		"redirect_uri":  {redirect.String()},
+		"code_verifier": {verifier},
+	})
+}
+
+// randomToken returns n random bytes encoded for use in a URL
+func randomToken(n int) string {
+	data := make([]byte, n)
+	rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// openBrowser starts the system browser on a URL and prints it for when no
+// browser can be started
+func openBrowser(target string) error {
+	fmt.Fprintf(os.Stderr, "Open this URL to authorize:\n%s\n", target)
+	var command *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		command = exec.Command("open", target)
+	case "windows":
+		command = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		command = exec.Command("xdg-open", target)
+	}
+	// The URL is printed, a missing browser is not an error
+	command.Start()
+	return nil
+}
+
+// executeOAuth2 sends a request with a token from its OAuth2 auth. A cached
+// token the server rejects with 401 is refreshed and the request sent again.
+func (e *RequestEngine) executeOAuth2(ctx context.Context, request APIRequest) APIResponse {
+	start := time.Now()
+	config := request.Auth.OAuth2
+	if config == nil {
+		return APIResponse{Error: "OAuth2 auth has no settings"}
+	}
+	token, fresh, err := e.oauth2Token(ctx, request, false)
+	if err != nil {
+		return APIResponse{Error: err.Error(), ResponseTime: time.Since(start)}
+	}
+
+	send := func(token *OAuth2Token) APIResponse {
+		authorized := request
+		authorized.Auth = &RequestAuth{Type: AuthBearer, Bearer: &BearerAuth{Token: token.AccessToken, Prefix: config.prefix()}}
+		return e.Execute(ctx, authorized)
+	}
+	response := send(token)
+	if response.StatusCode == http.StatusUnauthorized && !fresh {
+		if token, _, err = e.oauth2Token(ctx, request, true); err == nil {
+			response = send(token)
+		}
+	}
+	return response
+}
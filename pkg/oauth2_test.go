@@ -0,0 +1,354 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer is an OAuth2 token endpoint for client "client" with secret
+// "secret" and user "user" with password "pass"
+type tokenServer struct {
+	*httptest.Server
+	refreshTokens bool // issue refresh tokens
+
+	mutex  sync.Mutex
+	grants []string // grant types requested, in order
+	issued int
+	valid  map[string]bool // refresh tokens that may be used
+}
+
+func newTokenServer(t *testing.T, refreshTokens bool) *tokenServer {
+	t.Helper()
+	server := &tokenServer{refreshTokens: refreshTokens, valid: make(map[string]bool)}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.token))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *tokenServer) token(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r.ParseForm()
+	grant := r.PostForm.Get("grant_type")
+	s.grants = append(s.grants, grant)
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	client, secret, ok := r.BasicAuth()
+	if !ok {
+		client, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if client != "client" || secret != "secret" {
+		fail("invalid_client")
+		return
+	}
+	switch grant {
+	case OAuth2ClientCredentials:
+	case OAuth2Password:
+		if r.PostForm.Get("username") != "user" || r.PostForm.Get("password") != "pass" {
+			fail("invalid_grant")
+			return
+		}
+	case OAuth2RefreshToken:
+		if !s.valid[r.PostForm.Get("refresh_token")] {
+			fail("invalid_grant")
+			return
+		}
+	default:
+		fail("unsupported_grant_type")
+		return
+	}
+
+	s.issued++
+	token := map[string]interface{}{
+		"access_token": fmt.Sprintf("token-%d", s.issued),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+	if s.refreshTokens {
+		refreshToken := fmt.Sprintf("refresh-%d", s.issued)
+		s.valid[refreshToken] = true
+		token["refresh_token"] = refreshToken
+	}
+	json.NewEncoder(w).Encode(token)
+}
+
+// requested returns the grant types requested so far
+func (s *tokenServer) requested() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.grants...)
+}
+
+// revokeRefreshTokens makes every refresh token issued so far invalid
+func (s *tokenServer) revokeRefreshTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.valid = make(map[string]bool)
+}
+
+// apiServer answers 200 to the bearer tokens accept allows and 401 otherwise
+func apiServer(t *testing.T, accept func(token string) bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !accept(token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(token))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func oauth2Request(url string, config OAuth2Auth) APIRequest {
+	return APIRequest{Method: "GET", URL: url, Auth: &RequestAuth{Type: AuthOAuth2, OAuth2: &config}}
+}
+
+func TestOAuth2TokenCaching(t *testing.T) {
+	clientCredentials := OAuth2Auth{Grant: OAuth2ClientCredentials, ClientID: "client", ClientSecret: "secret"}
+	password := OAuth2Auth{Grant: OAuth2Password, ClientID: "client", ClientSecret: "secret", Username: "user", Password: "pass"}
+	wrongPassword := password
+	wrongPassword.Password = "wrong"
+	otherScope := clientCredentials
+	otherScope.Scope = "admin"
+	sharedTokens, otherTokens := NewOAuth2TokenCache(), NewOAuth2TokenCache()
+
+	tests := []struct {
+		name                string
+		first, second       OAuth2Auth
+		firstOptions        RequestOptions
+		secondOptions       RequestOptions
+		wantTokenRequests   int
+		wantSecondError     string
+		wantSecondSameToken bool
+	}{
+		{
+			name:                "same configuration",
+			first:               clientCredentials,
+			second:              clientCredentials,
+			wantTokenRequests:   1,
+			wantSecondSameToken: true,
+		},
+		{
+			name:                "same configuration and cache",
+			first:               clientCredentials,
+			second:              clientCredentials,
+			firstOptions:        RequestOptions{OAuth2Tokens: sharedTokens},
+			secondOptions:       RequestOptions{OAuth2Tokens: sharedTokens},
+			wantTokenRequests:   1,
+			wantSecondSameToken: true,
+		},
+		{
+			name:              "other scope",
+			first:             clientCredentials,
+			second:            otherScope,
+			wantTokenRequests: 2,
+		},
+		{
+			name:              "other environment",
+			first:             clientCredentials,
+			second:            clientCredentials,
+			secondOptions:     RequestOptions{Environment: "staging"},
+			wantTokenRequests: 2,
+		},
+		{
+			name:              "other user",
+			first:             clientCredentials,
+			second:            clientCredentials,
+			firstOptions:      RequestOptions{OAuth2Tokens: NewOAuth2TokenCache()},
+			secondOptions:     RequestOptions{OAuth2Tokens: otherTokens},
+			wantTokenRequests: 2,
+		},
+		{
+			name:              "wrong password after a good one",
+			first:             password,
+			second:            wrongPassword,
+			wantTokenRequests: 2,
+			wantSecondError:   "invalid_grant",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens := newTokenServer(t, false)
+			api := apiServer(t, func(token string) bool { return token != "" })
+			engine := NewRequestEngine()
+
+			test.first.TokenURL, test.second.TokenURL = tokens.URL, tokens.URL
+			first := oauth2Request(api.URL, test.first)
+			first.Options = test.firstOptions
+			firstResponse := engine.Execute(context.Background(), first)
+			if firstResponse.StatusCode != http.StatusOK {
+				t.Fatalf("first request: status %d, error %q", firstResponse.StatusCode, firstResponse.Error)
+			}
+
+			second := oauth2Request(api.URL, test.second)
+			second.Options = test.secondOptions
+			secondResponse := engine.Execute(context.Background(), second)
+			if test.wantSecondError != "" {
+				if !strings.Contains(secondResponse.Error, test.wantSecondError) {
+					t.Fatalf("second request: error %q, want it to contain %q", secondResponse.Error, test.wantSecondError)
+				}
+			} else if secondResponse.StatusCode != http.StatusOK {
+				t.Fatalf("second request: status %d, error %q", secondResponse.StatusCode, secondResponse.Error)
+			} else if same := secondResponse.Body == firstResponse.Body; same != test.wantSecondSameToken {
+				t.Fatalf("second request sent %q after %q, want the same token: %v", secondResponse.Body, firstResponse.Body, test.wantSecondSameToken)
+			}
+
+			if got := len(tokens.requested()); got != test.wantTokenRequests {
+				t.Fatalf("%d token requests, want %d", got, test.wantTokenRequests)
+			}
+		})
+	}
+}
+
+func TestOAuth2Refresh(t *testing.T) {
+	tests := []struct {
+		name          string
+		refreshTokens bool
+		revoke        bool
+		wantGrants    []string
+	}{
+		{
+			name:       "without a refresh token",
+			wantGrants: []string{OAuth2ClientCredentials, OAuth2ClientCredentials},
+		},
+		{
+			name:          "with a refresh token",
+			refreshTokens: true,
+			wantGrants:    []string{OAuth2ClientCredentials, OAuth2RefreshToken},
+		},
+		{
+			name:          "refresh token rejected",
+			refreshTokens: true,
+			revoke:        true,
+			wantGrants:    []string{OAuth2ClientCredentials, OAuth2RefreshToken, OAuth2ClientCredentials},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens := newTokenServer(t, test.refreshTokens)
+			engine := NewRequestEngine()
+			config := OAuth2Auth{Grant: OAuth2ClientCredentials, TokenURL: tokens.URL, ClientID: "client", ClientSecret: "secret"}
+			request := oauth2Request("", config)
+
+			first, err := engine.OAuth2Token(context.Background(), request, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.ExpiresAt.IsZero() {
+				t.Fatal("token has no expiry")
+			}
+
+			// The token is due for a refresh
+			engine.OAuth2Tokens().entry("", config.cacheKey()).token.refreshAt = time.Now().Add(-time.Second)
+			if test.revoke {
+				tokens.revokeRefreshTokens()
+			}
+
+			second, err := engine.OAuth2Token(context.Background(), request, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second.AccessToken == first.AccessToken {
+				t.Fatalf("token %q was not refreshed", second.AccessToken)
+			}
+			if got := tokens.requested(); strings.Join(got, ",") != strings.Join(test.wantGrants, ",") {
+				t.Fatalf("grants %v, want %v", got, test.wantGrants)
+			}
+		})
+	}
+}
+
+func TestOAuth2RefreshOn401(t *testing.T) {
+	tests := []struct {
+		name              string
+		accept            func(token string) bool
+		wantStatus        int
+		wantBody          string
+		wantTokenRequests int
+	}{
+		{
+			name:              "cached token accepted",
+			accept:            func(token string) bool { return token != "" },
+			wantStatus:        http.StatusOK,
+			wantBody:          "token-1",
+			wantTokenRequests: 1,
+		},
+		{
+			name:              "cached token revoked",
+			accept:            func(token string) bool { return token == "token-2" },
+			wantStatus:        http.StatusOK,
+			wantBody:          "token-2",
+			wantTokenRequests: 2,
+		},
+		{
+			name:              "new token rejected",
+			accept:            func(token string) bool { return false },
+			wantStatus:        http.StatusUnauthorized,
+			wantTokenRequests: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens := newTokenServer(t, false)
+			api := apiServer(t, test.accept)
+			engine := NewRequestEngine()
+			request := oauth2Request(api.URL, OAuth2Auth{Grant: OAuth2ClientCredentials, TokenURL: tokens.URL, ClientID: "client", ClientSecret: "secret"})
+
+			// Obtain and cache a token first, then send with it
+			if _, err := engine.OAuth2Token(context.Background(), request, false); err != nil {
+				t.Fatal(err)
+			}
+			response := engine.Execute(context.Background(), request)
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status %d, want %d, error %q", response.StatusCode, test.wantStatus, response.Error)
+			}
+			if response.Body != test.wantBody {
+				t.Fatalf("body %q, want %q", response.Body, test.wantBody)
+			}
+			if got := len(tokens.requested()); got != test.wantTokenRequests {
+				t.Fatalf("%d token requests, want %d", got, test.wantTokenRequests)
+			}
+		})
+	}
+}
+
+func TestOAuth2AuthorizationCodeLocalAccess(t *testing.T) {
+	engine := NewRequestEngine()
+	opened := false
+	engine.SetBrowser(func(string) error {
+		opened = true
+		return fmt.Errorf("no browser in tests")
+	})
+	request := oauth2Request("", OAuth2Auth{
+		Grant:    OAuth2AuthorizationCode,
+		TokenURL: "http://127.0.0.1/token",
+		AuthURL:  "http://127.0.0.1/authorize",
+		ClientID: "client",
+	})
+
+	if _, err := engine.OAuth2Token(context.Background(), request, false); err == nil || !strings.Contains(err.Error(), "only available from the CLI") {
+		t.Fatalf("error %v, want the grant refused", err)
+	}
+	if opened {
+		t.Fatal("browser opened without local access")
+	}
+
+	engine.SetLocalAccess(true)
+	if _, err := engine.OAuth2Token(context.Background(), request, false); err == nil || !strings.Contains(err.Error(), "no browser in tests") {
+		t.Fatalf("error %v, want the browser to be opened", err)
+	}
+}
@@ -2,7 +2,7 @@ package pkg
 
 // HandlePatchRequest sends a PATCH request to the specified URL and prints the response
 func HandlePatchRequest(url string) {
-	response := MakeHTTPRequest("PATCH", url, "", map[string]string{})
+	response := makeCLIRequest("PATCH", url, "", map[string]string{})
 	printResponse(response)
 }
 
@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+// Protocols for RequestOptions.Protocol
+const (
+	ProtocolAuto  = ""      // HTTP/2 when the server offers it over TLS, otherwise HTTP/1.1
+	ProtocolHTTP1 = "http1" // HTTP/1.1 only
+	ProtocolHTTP2 = "http2" // HTTP/2 negotiated with ALPN, failing when the server declines
+	ProtocolH2C   = "h2c"   // cleartext HTTP/2 with prior knowledge
+)
+
+// checkProtocolTarget reports protocol and URL scheme combinations that cannot work
+func checkProtocolTarget(protocol, scheme string) error {
+	switch protocol {
+	case ProtocolAuto, ProtocolHTTP1:
+		return nil
+	case ProtocolHTTP2:
+		if scheme != "https" {
+			return fmt.Errorf("HTTP/2 is negotiated over TLS, use an https:// URL or the h2c protocol")
+		}
+		return nil
+	case ProtocolH2C:
+		if scheme != "http" {
+			return fmt.Errorf("h2c is cleartext HTTP/2, use an http:// URL or the http2 protocol")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown protocol %q, expected http1, http2 or h2c", protocol)
+	}
+}
+
+// checkNegotiated returns an error when the response did not use the protocol
+// that was required. Connections that require HTTP/2 already fail to open
+// without it, except TLS through a proxy to a server that ignores ALPN.
+func checkNegotiated(protocol string, resp *http.Response) error {
+	if (protocol == ProtocolHTTP2 || protocol == ProtocolH2C) && resp.ProtoMajor != 2 {
+		return fmt.Errorf("server did not negotiate HTTP/2, the response used %s", resp.Proto)
+	}
+	return nil
+}
+
+// newH2CTransport creates a transport that speaks HTTP/2 over plain TCP
+// without an upgrade, as gRPC gateways and other h2c backends expect
+func newH2CTransport(dial func(context.Context, string, string) (net.Conn, error)) *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+		// Bodies are decoded by readResponseBody, as with the HTTP/1.1 transport
+		DisableCompression: true,
+	}
+}
+
+// requireHTTP2 makes a transport offer only h2 in the TLS handshake, so a
+// server without HTTP/2 fails it instead of receiving the request over
+// HTTP/1.1, and refuses connections that negotiated nothing
+func requireHTTP2(transport *http.Transport) error {
+	if _, err := http2.ConfigureTransports(transport); err != nil {
+		return err
+	}
+	transport.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS}
+
+	dialTLS := transport.DialTLSContext
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialTLS(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if state, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok &&
+			state.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+			conn.Close()
+			return nil, fmt.Errorf("server %s did not negotiate HTTP/2", addr)
+		}
+		return conn, nil
+	}
+	return nil
+}
+
+// disableHTTP2 keeps a transport on HTTP/1.1 even when the server offers HTTP/2
+func disableHTTP2(transport *http.Transport) {
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+}
+
+// protocolName returns the protocol of a response as HTTP/1.0, HTTP/1.1 or HTTP/2
+func protocolName(resp *http.Response) string {
+	if resp.ProtoMajor == 2 {
+		return "HTTP/2"
+	}
+	return resp.Proto
+}
@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyOptions routes requests through an HTTP, HTTPS (CONNECT) or SOCKS5
+// proxy. The URL scheme selects the kind: http://, https://, socks5:// or
+// socks5h:// (the proxy resolves host names).
+type ProxyOptions struct {
+	URL      string `json:"url,omitempty"`
+	Username string `json:"username,omitempty"` // overrides credentials in URL
+	Password string `json:"password,omitempty"`
+	NoProxy  string `json:"noProxy,omitempty"`  // comma separated hosts, domains, IPs or CIDRs
+	Disabled bool   `json:"disabled,omitempty"` // connect directly, ignoring outer settings
+}
+
+// proxyFunc returns the http.Transport Proxy function for the options.
+// A nil value falls back to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables.
+func proxyFunc(opts *ProxyOptions) (func(*http.Request) (*url.URL, error), error) {
+	if opts == nil {
+		return http.ProxyFromEnvironment, nil
+	}
+	if opts.Disabled || opts.URL == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+
+	if opts.Username != "" {
+		proxyURL.User = url.UserPassword(opts.Username, opts.Password)
+	}
+
+	bypass := parseNoProxy(opts.NoProxy)
+
+	return func(req *http.Request) (*url.URL, error) {
+		if bypass.matches(req.URL) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// noProxyList is a parsed NO_PROXY style bypass list
+type noProxyList struct {
+	all      bool
+	hosts    []string // exact host or domain suffix, optionally with :port
+	networks []*net.IPNet
+}
+
+func parseNoProxy(value string) noProxyList {
+	var list noProxyList
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			list.all = true
+		default:
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				list.networks = append(list.networks, network)
+				continue
+			}
+			list.hosts = append(list.hosts, strings.TrimPrefix(entry, "*"))
+		}
+	}
+	return list
+}
+
+// matches reports whether requests to target should bypass the proxy
+func (l noProxyList) matches(target *url.URL) bool {
+	if l.all {
+		return true
+	}
+
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if port == "" {
+		if target.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range l.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	for _, entry := range l.hosts {
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+
+		// ".example.com" and "example.com" both match the domain and its subdomains
+		domain := strings.TrimPrefix(entryHost, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,7 @@ import (
 
 // HandlePutRequest sends a PUT request to the specified URL and prints the response
 func HandlePutRequest(url string) {
-	response := MakeHTTPRequest("PUT", url, "", map[string]string{})
+	response := makeCLIRequest("PUT", url, "", map[string]string{})
 	printResponse(response)
 }
 
@@ -21,13 +21,23 @@ func MakePutRequest(url, body string, headers map[string]string) APIResponse {
 }
 
 func printResponse(response APIResponse) {
+	printAttempts(response.Attempts)
+	printRedirects(response.Redirects)
+
 	if response.Error != "" {
 		fmt.Printf("Error: %s\n", response.Error)
 		return
 	}
 
 	fmt.Printf("Status: %s\n", response.Status)
+	fmt.Printf("Protocol: %s\n", response.Protocol)
+	if response.CacheStatus != "" {
+		fmt.Printf("Cache: %s\n", response.CacheStatus)
+	}
 	fmt.Printf("Response Time: %v\n", response.ResponseTime)
+	printSize(response)
+	printTiming(response.Timing)
+	printTLS(response.TLS)
 	fmt.Println("Response Body:")
-	fmt.Println(response.Body)
+	printBody(response)
 }
\ No newline at end of file
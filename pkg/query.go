@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"net/url"
+	"strings"
+)
+
+// QueryParam is one query string parameter. Names and values are stored
+// unescaped and encoded when the request is sent.
+type QueryParam struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// FullURL returns the URL with the enabled QueryParams appended, in order,
+// after any query already present in URL
+func (r APIRequest) FullURL() string {
+	return mergeQueryParams(r.URL, r.QueryParams)
+}
+
+// mergeQueryParams appends the enabled params to rawURL, keeping its fragment last
+func mergeQueryParams(rawURL string, params []QueryParam) string {
+	encoded := encodeQueryParams(params)
+	if encoded == "" {
+		return rawURL
+	}
+
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?" + encoded
+	case strings.HasSuffix(base, "?"), strings.HasSuffix(base, "&"):
+		base += encoded
+	default:
+		base += "&" + encoded
+	}
+
+	if hasFragment {
+		return base + "#" + fragment
+	}
+	return base
+}
+
+// encodeQueryParams encodes the enabled params as a query string
+func encodeQueryParams(params []QueryParam) string {
+	var pairs []string
+	for _, param := range params {
+		if param.Disabled || param.Name == "" {
+			continue
+		}
+		pairs = append(pairs, url.QueryEscape(param.Name)+"="+url.QueryEscape(param.Value))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// ParseQueryParams splits a pasted URL into the URL without its query and
+// the query parameters, decoded and in their original order. A fragment
+// stays on the returned URL.
+func ParseQueryParams(rawURL string) (string, []QueryParam) {
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	base, query, hasQuery := strings.Cut(base, "?")
+	if hasFragment {
+		base += "#" + fragment
+	}
+	if !hasQuery {
+		return base, nil
+	}
+
+	var params []QueryParam
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		params = append(params, QueryParam{
+			Name:  unescapeQuery(name),
+			Value: unescapeQuery(value),
+		})
+	}
+	return base, params
+}
+
+// unescapeQuery decodes a query component, keeping it as is when malformed
+func unescapeQuery(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
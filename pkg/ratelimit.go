@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit throttles requests to each host. RequestsPerSecond refills a
+// token bucket holding up to Burst tokens; MaxInFlight caps the requests
+// open to a host at once. Zero values leave that limit off.
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"` // defaults to 1
+	MaxInFlight       int     `json:"maxInFlight"`
+}
+
+// enabled reports whether the limit restricts anything
+func (l RateLimit) enabled() bool {
+	return l.RequestsPerSecond > 0 || l.MaxInFlight > 0
+}
+
+// WorkspaceRateLimitScope is the rate limit scope of a workspace, see
+// RequestOptions.RateLimitScope
+func WorkspaceRateLimitScope(workspaceID uint) string {
+	return fmt.Sprintf("workspace:%d", workspaceID)
+}
+
+// RateLimiter keeps a token bucket and in-flight counter per scope and host.
+// A scope without a limit of its own uses the global limit.
+type RateLimiter struct {
+	mutex    sync.Mutex
+	global   RateLimit
+	scoped   map[string]RateLimit
+	limiters map[limiterKey]*hostLimiter
+}
+
+type limiterKey struct {
+	scope string
+	host  string
+}
+
+// NewRateLimiter creates a rate limiter with no limits set
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		scoped:   make(map[string]RateLimit),
+		limiters: make(map[limiterKey]*hostLimiter),
+	}
+}
+
+// SetLimit sets the limit of a scope; the empty scope is the global limit.
+// A nil limit removes the scope's own limit.
+func (rl *RateLimiter) SetLimit(scope string, limit *RateLimit) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	switch {
+	case scope == "" && limit == nil:
+		rl.global = RateLimit{}
+	case scope == "":
+		rl.global = *limit
+	case limit == nil:
+		delete(rl.scoped, scope)
+	default:
+		rl.scoped[scope] = *limit
+	}
+
+	// Start over with fresh buckets; requests in flight release into the old ones
+	for key := range rl.limiters {
+		if scope == "" || key.scope == scope {
+			delete(rl.limiters, key)
+		}
+	}
+}
+
+// Limit returns the limit that applies to a scope
+func (rl *RateLimiter) Limit(scope string) RateLimit {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if limit, exists := rl.scoped[scope]; exists {
+		return limit
+	}
+	return rl.global
+}
+
+// acquire waits until a request to host may start. It returns how long it
+// waited and a function that must be called when the request is done.
+func (rl *RateLimiter) acquire(ctx context.Context, scope, host string) (time.Duration, func(), error) {
+	limiter := rl.limiterFor(scope, strings.ToLower(host))
+	if limiter == nil {
+		return 0, func() {}, nil
+	}
+
+	start := time.Now()
+	if err := limiter.take(ctx); err != nil {
+		return time.Since(start), nil, err
+	}
+	if limiter.slots != nil {
+		select {
+		case limiter.slots <- struct{}{}:
+		case <-ctx.Done():
+			return time.Since(start), nil, ctx.Err()
+		}
+	}
+
+	release := func() {
+		if limiter.slots != nil {
+			<-limiter.slots
+		}
+	}
+	return time.Since(start), release, nil
+}
+
+func (rl *RateLimiter) limiterFor(scope, host string) *hostLimiter {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	limit, exists := rl.scoped[scope]
+	if !exists {
+		limit, scope = rl.global, ""
+	}
+	if !limit.enabled() {
+		return nil
+	}
+
+	key := limiterKey{scope: scope, host: host}
+	if limiter, exists := rl.limiters[key]; exists {
+		return limiter
+	}
+
+	limiter := &hostLimiter{rate: limit.RequestsPerSecond}
+	if limit.RequestsPerSecond > 0 {
+		limiter.burst = float64(limit.Burst)
+		if limiter.burst < 1 {
+			limiter.burst = 1
+		}
+		limiter.tokens = limiter.burst
+		limiter.last = time.Now()
+	}
+	if limit.MaxInFlight > 0 {
+		limiter.slots = make(chan struct{}, limit.MaxInFlight)
+	}
+	rl.limiters[key] = limiter
+	return limiter
+}
+
+// hostLimiter is the token bucket and in-flight slots of one host
+type hostLimiter struct {
+	mutex  sync.Mutex
+	rate   float64 // tokens per second, 0 for no rate limit
+	burst  float64
+	tokens float64
+	last   time.Time
+	slots  chan struct{}
+}
+
+// take removes a token from the bucket, waiting for it to refill if needed
+func (h *hostLimiter) take(ctx context.Context) error {
+	if h.rate <= 0 {
+		return nil
+	}
+
+	// Reserve the token now so callers are served in the order they arrived
+	h.mutex.Lock()
+	now := time.Now()
+	h.tokens += now.Sub(h.last).Seconds() * h.rate
+	if h.tokens > h.burst {
+		h.tokens = h.burst
+	}
+	h.last = now
+	h.tokens--
+	wait := time.Duration(-h.tokens / h.rate * float64(time.Second))
+	h.mutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the reservation back
+		h.mutex.Lock()
+		h.tokens++
+		h.mutex.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+)
+
+// Redirect modes
+const (
+	RedirectFollow = "follow"
+	RedirectNone   = "none"
+)
+
+// RedirectPolicy decides whether and how far redirects are followed.
+// 307 and 308 always keep the method and body. 301, 302 and 303 switch to
+// GET without a body unless KeepMethod is set. Credentials, the
+// Authorization, Proxy-Authorization and Cookie headers and any header set by
+// the request's auth, are dropped when a redirect leaves the original scheme,
+// host and port unless KeepAuth is set.
+type RedirectPolicy struct {
+	Mode       string `json:"mode"` // follow (default), none
+	MaxHops    int    `json:"maxHops"`
+	KeepMethod bool   `json:"keepMethod,omitempty"`
+	KeepAuth   bool   `json:"keepAuth,omitempty"`
+}
+
+// RedirectHop is one redirect response that was followed
+type RedirectHop struct {
+	Method     string          `json:"method"`
+	URL        string          `json:"url"`
+	StatusCode int             `json:"statusCode"`
+	Status     string          `json:"status"`
+	Location   string          `json:"location"`
+	Headers    HeaderList      `json:"headers"`
+	Timing     *ResponseTiming `json:"timing,omitempty"`
+}
+
+// credentialHeaders are not forwarded to a different origin
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Cookie2", "WWW-Authenticate"}
+
+func isRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// follow sends req, following redirects by hand so every hop can be
+// recorded. The client must not follow redirects itself. It returns the
+// final response with the tracer of its hop, and the hops before it. When
+// the hop limit is reached the last redirect response is returned together
+// with an error. authHeaders are dropped along with the credentialHeaders.
+func (p RedirectPolicy) follow(ctx context.Context, client *http.Client, req *http.Request, body *requestBody, authHeaders []string) (*http.Response, *timingTracer, []RedirectHop, error) {
+	maxHops := p.MaxHops
+	if maxHops <= 0 {
+		maxHops = DefaultMaxRedirects
+	}
+
+	// The client adds jar cookies to each request it sends; only the
+	// cookies set by the caller are carried from hop to hop
+	userCookies := req.Header.Values("Cookie")
+
+	var hops []RedirectHop
+	for {
+		tracer := newTimingTracer()
+		req = req.WithContext(httptrace.WithClientTrace(ctx, tracer.clientTrace()))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, tracer, hops, err
+		}
+
+		location := resp.Header.Get("Location")
+		if p.Mode == RedirectNone || !isRedirectStatus(resp.StatusCode) || location == "" {
+			return resp, tracer, hops, nil
+		}
+		if len(hops) >= maxHops {
+			return resp, tracer, hops, fmt.Errorf("stopped after %d redirects", maxHops)
+		}
+
+		next, err := p.nextRequest(ctx, req, resp, location, body, authHeaders)
+
+		// Drain a little so the connection can be reused for the next hop
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+
+		hops = append(hops, RedirectHop{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Location:   location,
+			Headers:    tracer.headers(resp.Header),
+			Timing:     tracer.finish(),
+		})
+
+		if err != nil {
+			return nil, tracer, hops, err
+		}
+		if client.Jar != nil && next.Header.Get("Cookie") != "" {
+			next.Header.Del("Cookie")
+			for _, cookie := range userCookies {
+				next.Header.Add("Cookie", cookie)
+			}
+		}
+		req = next
+	}
+}
+
+// nextRequest builds the request for the Location of a redirect response
+func (p RedirectPolicy) nextRequest(ctx context.Context, req *http.Request, resp *http.Response, location string, body *requestBody, authHeaders []string) (*http.Request, error) {
+	target, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %q: %w", location, err)
+	}
+
+	method := req.Method
+	// A body dropped on an earlier hop is not brought back
+	keepBody := req.GetBody != nil
+	if !p.KeepMethod {
+		switch resp.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound:
+			if method != "GET" && method != "HEAD" {
+				method, keepBody = "GET", false
+			}
+		case http.StatusSeeOther:
+			if method != "HEAD" {
+				method = "GET"
+			}
+			keepBody = false
+		}
+	}
+
+	next, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	next.Header = req.Header.Clone()
+
+	// An explicit Host header only applies to the host it was sent to
+	if target.Host == req.URL.Host {
+		next.Host = req.Host
+	}
+
+	if !p.KeepAuth && !sameOrigin(req.URL, target) {
+		for _, name := range credentialHeaders {
+			next.Header.Del(name)
+		}
+		for _, name := range authHeaders {
+			next.Header.Del(name)
+		}
+	}
+
+	if keepBody {
+		if err := attachBody(next, body); err != nil {
+			return nil, err
+		}
+	} else {
+		next.Header.Del("Content-Type")
+		next.Header.Del("Content-Length")
+		next.Header.Del("Content-Encoding")
+	}
+	return next, nil
+}
+
+// sameOrigin reports whether a and b share scheme, host and port
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		portOf(a) == portOf(b)
+}
+
+func portOf(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// printRedirects prints the redirect chain of a response for the CLI
+func printRedirects(hops []RedirectHop) {
+	if len(hops) == 0 {
+		return
+	}
+
+	fmt.Println("Redirects:")
+	for i, hop := range hops {
+		fmt.Printf("  %d. %s %s -> %s (%s)\n", i+1, hop.Method, hop.URL, hop.Status, hop.Location)
+	}
+}
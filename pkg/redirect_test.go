@@ -0,0 +1,254 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// credentialNames are the headers the redirect tests look for
+var credentialNames = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "X-Signature", "X-Trace"}
+
+// headerEcho answers with the credentialNames it received, one per line
+func headerEcho(w http.ResponseWriter, r *http.Request) {
+	for _, name := range credentialNames {
+		if r.Header.Get(name) != "" {
+			w.Write([]byte(name + "\n"))
+		}
+	}
+}
+
+func TestRedirectDropsCredentials(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(headerEcho))
+	defer other.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", headerEcho)
+	mux.HandleFunc("/same", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusFound)
+	})
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/echo", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		auth     *RequestAuth
+		keepAuth bool
+		want     []string
+	}{
+		{
+			name: "bearer to another origin",
+			path: "/other",
+			auth: &RequestAuth{Type: AuthBearer, Bearer: &BearerAuth{Token: "secret"}},
+			want: []string{"X-Trace"},
+		},
+		{
+			name: "API key header to another origin",
+			path: "/other",
+			auth: &RequestAuth{Type: AuthAPIKey, APIKey: &APIKeyAuth{Name: "X-Api-Key", Value: "secret"}},
+			want: []string{"X-Trace"},
+		},
+		{
+			name: "HMAC signature header to another origin",
+			path: "/other",
+			auth: &RequestAuth{Type: AuthHMAC, HMAC: &HMACAuth{KeyID: "key", Secret: "secret", Header: "X-Signature"}},
+			want: []string{"X-Trace"},
+		},
+		{
+			name: "proxy authorization to another origin",
+			path: "/other",
+			want: []string{"X-Trace"},
+		},
+		{
+			name: "API key header to the same origin",
+			path: "/same",
+			auth: &RequestAuth{Type: AuthAPIKey, APIKey: &APIKeyAuth{Name: "X-Api-Key", Value: "secret"}},
+			want: []string{"Proxy-Authorization", "X-Api-Key", "X-Trace"},
+		},
+		{
+			name:     "API key header kept on request",
+			path:     "/other",
+			auth:     &RequestAuth{Type: AuthAPIKey, APIKey: &APIKeyAuth{Name: "X-Api-Key", Value: "secret"}},
+			keepAuth: true,
+			want:     []string{"Proxy-Authorization", "X-Api-Key", "X-Trace"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := NewRequestEngine().Execute(context.Background(), APIRequest{
+				Method: "GET",
+				URL:    server.URL + test.path,
+				RawHeaders: HeaderList{
+					{Name: "Proxy-Authorization", Value: "Basic cHJveHk6c2VjcmV0"},
+					{Name: "X-Trace", Value: "1"},
+				},
+				Auth:    test.auth,
+				Options: RequestOptions{Redirects: RedirectPolicy{KeepAuth: test.keepAuth}},
+			})
+			if response.Error != "" {
+				t.Fatal(response.Error)
+			}
+			if len(response.Redirects) != 1 {
+				t.Fatalf("%d redirects, want 1", len(response.Redirects))
+			}
+			if got := strings.Fields(response.Body); strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Fatalf("headers after the redirect %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	// /hop/N redirects N times before reaching /echo
+	mux.HandleFunc("/hop/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if n == 0 {
+			http.Redirect(w, r, "/echo", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+	})
+	// /status/N redirects to /echo with status N
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/status/"))
+		http.Redirect(w, r, "/echo", code)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %q", r.Method, body)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		policy RedirectPolicy
+
+		wantStatus int
+		wantBody   string
+		wantHops   []string // method, path and status of each hop
+		wantError  string
+	}{
+		{
+			name:       "chain followed",
+			method:     "GET",
+			path:       "/hop/2",
+			wantStatus: http.StatusOK,
+			wantBody:   `GET ""`,
+			wantHops:   []string{"GET /hop/2 302", "GET /hop/1 302", "GET /hop/0 302"},
+		},
+		{
+			name:       "hop limit reached",
+			method:     "GET",
+			path:       "/hop/2",
+			policy:     RedirectPolicy{MaxHops: 2},
+			wantStatus: http.StatusFound,
+			wantHops:   []string{"GET /hop/2 302", "GET /hop/1 302"},
+			wantError:  "stopped after 2 redirects",
+		},
+		{
+			name:       "not followed",
+			method:     "GET",
+			path:       "/hop/2",
+			policy:     RedirectPolicy{Mode: RedirectNone},
+			wantStatus: http.StatusFound,
+		},
+		{
+			name:       "303 switches to GET",
+			method:     "POST",
+			path:       "/status/303",
+			body:       "data",
+			wantStatus: http.StatusOK,
+			wantBody:   `GET ""`,
+			wantHops:   []string{"POST /status/303 303"},
+		},
+		{
+			name:       "303 keeping the method",
+			method:     "POST",
+			path:       "/status/303",
+			body:       "data",
+			policy:     RedirectPolicy{KeepMethod: true},
+			wantStatus: http.StatusOK,
+			wantBody:   `POST "data"`,
+			wantHops:   []string{"POST /status/303 303"},
+		},
+		{
+			name:       "302 switches POST to GET",
+			method:     "POST",
+			path:       "/status/302",
+			body:       "data",
+			wantStatus: http.StatusOK,
+			wantBody:   `GET ""`,
+			wantHops:   []string{"POST /status/302 302"},
+		},
+		{
+			name:       "302 switches PUT to GET",
+			method:     "PUT",
+			path:       "/status/302",
+			body:       "data",
+			wantStatus: http.StatusOK,
+			wantBody:   `GET ""`,
+			wantHops:   []string{"PUT /status/302 302"},
+		},
+		{
+			name:       "307 keeps the method and body",
+			method:     "POST",
+			path:       "/status/307",
+			body:       "data",
+			wantStatus: http.StatusOK,
+			wantBody:   `POST "data"`,
+			wantHops:   []string{"POST /status/307 307"},
+		},
+		{
+			name:       "308 keeps the method and body",
+			method:     "PUT",
+			path:       "/status/308",
+			body:       "data",
+			wantStatus: http.StatusOK,
+			wantBody:   `PUT "data"`,
+			wantHops:   []string{"PUT /status/308 308"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := NewRequestEngine().Execute(context.Background(), APIRequest{
+				Method:  test.method,
+				URL:     server.URL + test.path,
+				Body:    test.body,
+				Options: RequestOptions{Redirects: test.policy},
+			})
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status %d, want %d, error %q", response.StatusCode, test.wantStatus, response.Error)
+			}
+			if test.wantError == "" && response.Error != "" || !strings.Contains(response.Error, test.wantError) {
+				t.Fatalf("error %q, want %q", response.Error, test.wantError)
+			}
+			if test.wantStatus == http.StatusOK && response.Body != test.wantBody {
+				t.Fatalf("body %s, want %s", response.Body, test.wantBody)
+			}
+
+			var hops []string
+			for _, hop := range response.Redirects {
+				hops = append(hops, fmt.Sprintf("%s %s %d", hop.Method, strings.TrimPrefix(hop.URL, server.URL), hop.StatusCode))
+				if hop.Location == "" || hop.Timing == nil {
+					t.Fatalf("hop %+v without its location and timing", hop)
+				}
+			}
+			if strings.Join(hops, ",") != strings.Join(test.wantHops, ",") {
+				t.Fatalf("hops %v, want %v", hops, test.wantHops)
+			}
+		})
+	}
+}
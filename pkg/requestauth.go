@@ -0,0 +1,460 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Auth types of a request, collection or folder
+const (
+	AuthInherit  = "inherit" // use the auth of the parent folder or collection
+	AuthNone     = "none"
+	AuthBasic    = "basic"
+	AuthBearer   = "bearer"
+	AuthAPIKey   = "apikey"
+	AuthOAuth2   = "oauth2"
+	AuthAWSSigV4 = "awsv4"
+	AuthDigest   = "digest"
+	AuthHMAC     = "hmac"
+)
+
+// Places an API key is sent
+const (
+	APIKeyInHeader = "header"
+	APIKeyInQuery  = "query"
+)
+
+// maskedSecret replaces secret values in history
+const maskedSecret = "****"
+
+// RequestAuth is how a request authenticates. A nil RequestAuth, an empty
+// Type and AuthInherit all take the auth of the parent folder or collection;
+// only the settings matching Type are used.
+type RequestAuth struct {
+	Type   string        `json:"type"`
+	Basic  *BasicAuth    `json:"basic,omitempty"`
+	Bearer *BearerAuth   `json:"bearer,omitempty"`
+	APIKey *APIKeyAuth   `json:"apiKey,omitempty"`
+	OAuth2 *OAuth2Auth   `json:"oauth2,omitempty"`
+	AWS    *AWSSigV4Auth `json:"aws,omitempty"`
+	Digest *DigestAuth   `json:"digest,omitempty"`
+	HMAC   *HMACAuth     `json:"hmac,omitempty"`
+}
+
+// BasicAuth sends a username and password in the Authorization header
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// BearerAuth sends a token in the Authorization header
+type BearerAuth struct {
+	Token  string `json:"token"`
+	Prefix string `json:"prefix,omitempty"` // scheme before the token, Bearer when empty
+}
+
+// APIKeyAuth sends a key as a header or query param
+type APIKeyAuth struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	In    string `json:"in,omitempty"` // header (default) or query
+}
+
+// ParseRequestAuth reads auth from the AuthType and AuthData columns of a
+// saved request, folder or collection. AuthData holds the JSON settings of
+// the type, such as {"username": "...", "password": "..."} for basic auth.
+func ParseRequestAuth(authType, authData string) (*RequestAuth, error) {
+	auth := &RequestAuth{Type: strings.ToLower(strings.TrimSpace(authType))}
+	if auth.inherits() {
+		return nil, nil
+	}
+
+	var settings interface{}
+	switch auth.Type {
+	case AuthNone:
+		return auth, nil
+	case AuthBasic:
+		auth.Basic = &BasicAuth{}
+		settings = auth.Basic
+	case AuthBearer:
+		auth.Bearer = &BearerAuth{}
+		settings = auth.Bearer
+	case AuthAPIKey:
+		auth.APIKey = &APIKeyAuth{}
+		settings = auth.APIKey
+	case AuthOAuth2:
+		auth.OAuth2 = &OAuth2Auth{}
+		settings = auth.OAuth2
+	case AuthAWSSigV4:
+		auth.AWS = &AWSSigV4Auth{}
+		settings = auth.AWS
+	case AuthDigest:
+		auth.Digest = &DigestAuth{}
+		settings = auth.Digest
+	case AuthHMAC:
+		auth.HMAC = &HMACAuth{}
+		settings = auth.HMAC
+	default:
+		return nil, fmt.Errorf("unknown auth type %q", authType)
+	}
+	if strings.TrimSpace(authData) != "" {
+		if err := json.Unmarshal([]byte(authData), settings); err != nil {
+			return nil, fmt.Errorf("invalid %s auth data: %v", auth.Type, err)
+		}
+	}
+	return auth, nil
+}
+
+// Columns returns the AuthType and AuthData columns that store the auth
+func (a *RequestAuth) Columns() (authType, authData string, err error) {
+	if a.inherits() {
+		return AuthInherit, "", nil
+	}
+
+	var settings interface{}
+	switch a.Type {
+	case AuthBasic:
+		settings = a.Basic
+	case AuthBearer:
+		settings = a.Bearer
+	case AuthAPIKey:
+		settings = a.APIKey
+	case AuthOAuth2:
+		settings = a.OAuth2
+	case AuthAWSSigV4:
+		settings = a.AWS
+	case AuthDigest:
+		settings = a.Digest
+	case AuthHMAC:
+		settings = a.HMAC
+	}
+	if settings == nil {
+		return a.Type, "", nil
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", "", err
+	}
+	return a.Type, string(data), nil
+}
+
+// headerNames returns the headers the auth sets on a request
+func (a *RequestAuth) headerNames() []string {
+	if a.inherits() {
+		return nil
+	}
+	switch a.Type {
+	case AuthNone:
+		return nil
+	case AuthAPIKey:
+		if a.APIKey == nil || !strings.EqualFold(a.APIKey.In, APIKeyInHeader) && a.APIKey.In != "" {
+			return nil
+		}
+		return []string{a.APIKey.Name}
+	case AuthAWSSigV4:
+		return []string{"Authorization", "X-Amz-Security-Token"}
+	case AuthHMAC:
+		if a.HMAC == nil {
+			return nil
+		}
+		return []string{a.HMAC.header()}
+	default:
+		return []string{"Authorization"}
+	}
+}
+
+func (a *RequestAuth) inherits() bool {
+	return a == nil || a.Type == "" || a.Type == AuthInherit
+}
+
+// substitute returns a copy with replace applied to every setting, or nil
+// for a nil auth
+func (a *RequestAuth) substitute(replace func(string) string) *RequestAuth {
+	if a == nil {
+		return nil
+	}
+	copied := *a
+	if a.Basic != nil {
+		copied.Basic = &BasicAuth{Username: replace(a.Basic.Username), Password: replace(a.Basic.Password)}
+	}
+	if a.Bearer != nil {
+		copied.Bearer = &BearerAuth{Token: replace(a.Bearer.Token), Prefix: replace(a.Bearer.Prefix)}
+	}
+	if a.APIKey != nil {
+		copied.APIKey = &APIKeyAuth{Name: replace(a.APIKey.Name), Value: replace(a.APIKey.Value), In: a.APIKey.In}
+	}
+	copied.OAuth2 = a.OAuth2.substitute(replace)
+	copied.AWS = a.AWS.substitute(replace)
+	copied.Digest = a.Digest.substitute(replace)
+	copied.HMAC = a.HMAC.substitute(replace)
+	return &copied
+}
+
+// secrets returns the settings of the auth that must not be shown
+func (a *RequestAuth) secrets() []*string {
+	var secrets []*string
+	if a.Basic != nil {
+		secrets = append(secrets, &a.Basic.Password)
+	}
+	if a.Bearer != nil {
+		secrets = append(secrets, &a.Bearer.Token)
+	}
+	if a.APIKey != nil {
+		secrets = append(secrets, &a.APIKey.Value)
+	}
+	if a.OAuth2 != nil {
+		secrets = append(secrets, &a.OAuth2.ClientSecret, &a.OAuth2.Password, &a.OAuth2.RefreshToken)
+	}
+	if a.AWS != nil {
+		secrets = append(secrets, &a.AWS.SecretKey, &a.AWS.SessionToken)
+	}
+	if a.Digest != nil {
+		secrets = append(secrets, &a.Digest.Password)
+	}
+	if a.HMAC != nil {
+		secrets = append(secrets, &a.HMAC.Secret)
+	}
+	return secrets
+}
+
+// MaskAuth returns a copy of the auth with its secrets masked, for showing
+// stored auth to the browser
+func MaskAuth(auth *RequestAuth) *RequestAuth {
+	masked := auth.substitute(func(value string) string { return value })
+	if masked == nil {
+		return nil
+	}
+	for _, secret := range masked.secrets() {
+		if *secret != "" {
+			*secret = maskedSecret
+		}
+	}
+	return masked
+}
+
+// KeepMaskedSecrets puts back the secrets of previous into auth where auth
+// holds them masked, as when the browser saves auth it was shown by MaskAuth
+func KeepMaskedSecrets(auth, previous *RequestAuth) {
+	if auth == nil || previous == nil || auth.Type != previous.Type {
+		return
+	}
+	secrets, previousSecrets := auth.secrets(), previous.secrets()
+	if len(secrets) != len(previousSecrets) {
+		return
+	}
+	for i, secret := range secrets {
+		if *secret == maskedSecret {
+			*secret = *previousSecrets[i]
+		}
+	}
+}
+
+// InheritAuth returns the auth that applies to a request given its own auth
+// followed by that of its parents, nearest first. It is the first that does
+// not inherit, or nil when every level inherits.
+func InheritAuth(levels ...*RequestAuth) *RequestAuth {
+	for _, auth := range levels {
+		if !auth.inherits() {
+			return auth
+		}
+	}
+	return nil
+}
+
+// applyAuth returns the request with its auth turned into the header or query
+// param it sends. Auth replaces a header of the same name set by hand. Auth
+// still inheriting when the request is sent has no parent left and sends
+// nothing. OAuth2 needs a token first, see RequestEngine.executeOAuth2, Digest
+// a challenge, see RequestEngine.executeDigest, and AWS and HMAC signatures
+// are made as the request is sent, see signRequest.
+func applyAuth(request APIRequest) (APIRequest, error) {
+	return authorize(request, false)
+}
+
+func authorize(request APIRequest, mask bool) (APIRequest, error) {
+	auth := request.Auth
+	request.Auth = nil
+	if auth.inherits() {
+		return request, nil
+	}
+
+	secret := func(value string) string {
+		if mask {
+			return maskedSecret
+		}
+		return value
+	}
+
+	switch auth.Type {
+	case AuthNone:
+		return request, nil
+	case AuthBasic:
+		if auth.Basic == nil {
+			return request, fmt.Errorf("basic auth has no credentials")
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(auth.Basic.Username + ":" + auth.Basic.Password))
+		return setHeader(request, "Authorization", "Basic "+secret(credentials)), nil
+	case AuthBearer:
+		if auth.Bearer == nil || auth.Bearer.Token == "" {
+			return request, fmt.Errorf("bearer auth has no token")
+		}
+		prefix := auth.Bearer.Prefix
+		if prefix == "" {
+			prefix = "Bearer"
+		}
+		return setHeader(request, "Authorization", prefix+" "+secret(auth.Bearer.Token)), nil
+	case AuthAPIKey:
+		if auth.APIKey == nil || auth.APIKey.Name == "" {
+			return request, fmt.Errorf("API key auth has no name")
+		}
+		switch strings.ToLower(auth.APIKey.In) {
+		case "", APIKeyInHeader:
+			return setHeader(request, auth.APIKey.Name, secret(auth.APIKey.Value)), nil
+		case APIKeyInQuery:
+			params := make([]QueryParam, 0, len(request.QueryParams)+1)
+			for _, param := range request.QueryParams {
+				if param.Name != auth.APIKey.Name {
+					params = append(params, param)
+				}
+			}
+			request.QueryParams = append(params, QueryParam{Name: auth.APIKey.Name, Value: secret(auth.APIKey.Value)})
+			return request, nil
+		default:
+			return request, fmt.Errorf("API key cannot be sent in %q, use header or query", auth.APIKey.In)
+		}
+	case AuthOAuth2:
+		if !mask || auth.OAuth2 == nil {
+			return request, fmt.Errorf("OAuth2 auth is sent with a token from the request engine")
+		}
+		return setHeader(request, "Authorization", auth.OAuth2.prefix()+" "+maskedSecret), nil
+	case AuthAWSSigV4:
+		if !mask || auth.AWS == nil {
+			return request, fmt.Errorf("AWS SigV4 auth is signed as the request is sent")
+		}
+		return setHeader(request, "Authorization", awsAlgorithm+" "+maskedSecret), nil
+	case AuthDigest:
+		if !mask || auth.Digest == nil {
+			return request, fmt.Errorf("digest auth answers the challenge of the server as the request is sent")
+		}
+		return setHeader(request, "Authorization", "Digest "+maskedSecret), nil
+	case AuthHMAC:
+		if !mask || auth.HMAC == nil {
+			return request, fmt.Errorf("HMAC auth is signed as the request is sent")
+		}
+		return setHeader(request, auth.HMAC.header(), maskedSecret), nil
+	default:
+		return request, fmt.Errorf("unknown auth type %q", auth.Type)
+	}
+}
+
+// signRequest signs a request about to be sent when its auth is a signature
+// over what is sent, which is final once its body is attached. AWS
+// credentials may come from the process environment when processEnv is set.
+func signRequest(req *http.Request, body *requestBody, auth *RequestAuth, now time.Time, processEnv bool) error {
+	switch {
+	case auth == nil:
+		return nil
+	case auth.Type == AuthAWSSigV4 && auth.AWS != nil:
+		return signAWSRequest(req, body, auth.AWS, now, processEnv)
+	case auth.Type == AuthHMAC && auth.HMAC != nil:
+		return signHMACRequest(req, body, auth.HMAC, now)
+	}
+	return nil
+}
+
+// setHeader replaces every header named name, in RawHeaders and Headers, with
+// a single field
+func setHeader(request APIRequest, name, value string) APIRequest {
+	headers := make(map[string]string, len(request.Headers))
+	for key, existing := range request.Headers {
+		if !strings.EqualFold(key, name) {
+			headers[key] = existing
+		}
+	}
+	request.Headers = headers
+	request.RawHeaders = append(removeHeader(request.RawHeaders, name), HeaderField{Name: name, Value: value})
+	return request
+}
+
+// secretHeaders are masked in history whatever auth set them
+var secretHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+// MaskSecrets returns the request as it is sent with its auth applied and the
+// secrets masked, for keeping in history. The scheme of an Authorization
+// header stays readable, e.g. "Bearer ****".
+func MaskSecrets(request APIRequest) APIRequest {
+	auth := request.Auth
+	masked, _ := authorize(request, true)
+
+	var names []string
+	if !auth.inherits() && auth.Type == AuthAPIKey && auth.APIKey != nil && !strings.EqualFold(auth.APIKey.In, APIKeyInQuery) {
+		names = append(names, auth.APIKey.Name)
+	}
+	names = append(names, secretHeaders...)
+
+	maskValue := func(value string) string {
+		if scheme, _, found := strings.Cut(value, " "); found {
+			return scheme + " " + maskedSecret
+		}
+		return maskedSecret
+	}
+	isSecret := func(name string) bool {
+		for _, secret := range names {
+			if strings.EqualFold(name, secret) {
+				return true
+			}
+		}
+		return false
+	}
+
+	rawHeaders := make(HeaderList, len(masked.RawHeaders))
+	for i, field := range masked.RawHeaders {
+		if isSecret(field.Name) && field.Value != maskedSecret {
+			field.Value = maskValue(field.Value)
+		}
+		rawHeaders[i] = field
+	}
+	masked.RawHeaders = rawHeaders
+
+	headers := make(map[string]string, len(masked.Headers))
+	for key, value := range masked.Headers {
+		if isSecret(key) {
+			value = maskValue(value)
+		}
+		headers[key] = value
+	}
+	masked.Headers = headers
+	return masked
+}
+
+// SavedRequestAuth returns the auth that applies to a request saved in the
+// database, walking up its folders to its collection
+func SavedRequestAuth(request DBRequest) (*RequestAuth, error) {
+	auth, err := ParseRequestAuth(request.AuthType, request.AuthData)
+	if err != nil || !auth.inherits() {
+		return auth, err
+	}
+
+	seen := make(map[uint]bool)
+	for folderID := request.FolderID; folderID != nil && !seen[*folderID]; {
+		seen[*folderID] = true
+		var folder DBFolder
+		if err := DB.First(&folder, *folderID).Error; err != nil {
+			return nil, fmt.Errorf("folder %d: %v", *folderID, err)
+		}
+		if auth, err = ParseRequestAuth(folder.AuthType, folder.AuthData); err != nil || !auth.inherits() {
+			return auth, err
+		}
+		folderID = folder.ParentID
+	}
+
+	var collection DBCollection
+	if err := DB.First(&collection, request.CollectionID).Error; err != nil {
+		return nil, fmt.Errorf("collection %d: %v", request.CollectionID, err)
+	}
+	return ParseRequestAuth(collection.AuthType, collection.AuthData)
+}
@@ -0,0 +1,276 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// BodyEncodingBase64 marks an APIResponse.Body that holds base64 encoded binary data
+const BodyEncodingBase64 = "base64"
+
+// hexDumpLimit is the number of bytes of a binary body shown by the CLI
+const hexDumpLimit = 512
+
+// ProgressFunc is called while a body is saved to disk. total is -1 when the
+// server did not send a Content-Length.
+type ProgressFunc func(written, total int64)
+
+// BodyBytes returns the raw response body, decoding base64 transport encoding
+func (r APIResponse) BodyBytes() ([]byte, error) {
+	if r.BodyEncoding == BodyEncodingBase64 {
+		return base64.StdEncoding.DecodeString(r.Body)
+	}
+	return []byte(r.Body), nil
+}
+
+// readResponseBody fills the body fields of response, decoding any content
+// coding first. Only the first MaxBodySize decoded bytes are kept in Body;
+// with SpillToFile the whole of a larger body is written to a temporary file.
+// With SaveTo set the body is streamed straight to that file instead.
+func readResponseBody(resp *http.Response, opts RequestOptions, response *APIResponse) error {
+	response.ContentType = resp.Header.Get("Content-Type")
+
+	wire := &countingReader{r: resp.Body}
+	defer func() { response.WireSize = wire.n }()
+
+	var body io.Reader = wire
+	total := resp.ContentLength
+	// A body with a coding we do not know is returned as received
+	codings := contentCodings(resp.Header.Get("Content-Encoding"))
+	if !opts.DisableDecompression && len(codings) > 0 && canDecode(codings) {
+		decoded, closeDecoders, err := decodeBody(wire, codings)
+		if err != nil {
+			return err
+		}
+		defer closeDecoders()
+		body = decoded
+		response.ContentEncoding = strings.Join(codings, ", ")
+		// Content-Length counts the encoded bytes
+		total = -1
+	}
+
+	if opts.SaveTo != "" {
+		written, err := saveBody(body, opts.SaveTo, total, opts.Progress)
+		response.BodyFile = opts.SaveTo
+		response.BodySize = written
+		return err
+	}
+
+	limit := opts.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+
+	if opts.sse != nil && isEventStream(response.ContentType) {
+		return readEventStream(resp.Request.Context(), body, opts.sse, limit, response)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	response.BodySize = int64(len(data))
+	if err == nil && int64(len(data)) > limit {
+		if opts.SpillToFile {
+			var file string
+			var size int64
+			file, size, err = spillBody(data, body)
+			response.BodyFile = file
+			response.BodySize = size
+		}
+		if !opts.SpillToFile {
+			// Closing drops the connection instead of downloading the rest.
+			// The size is then only exact when the server sent it.
+			resp.Body.Close()
+			if total > response.BodySize {
+				response.BodySize = total
+			}
+		}
+		data = data[:limit]
+		response.BodyTruncated = true
+	}
+
+	// A body left encoded is binary whatever its Content-Type says
+	stillEncoded := len(codings) > 0 && response.ContentEncoding == ""
+	if stillEncoded || isBinaryBody(response.ContentType, data) {
+		response.Body = base64.StdEncoding.EncodeToString(data)
+		response.BodyEncoding = BodyEncodingBase64
+		response.IsBinary = true
+	} else {
+		response.Body = string(data)
+	}
+	return err
+}
+
+// spilledBodies are the temporary files written by spillBody, removed by
+// RemoveSpilledBodies
+var spilledBodies struct {
+	mutex sync.Mutex
+	files []string
+}
+
+// spillBody writes the part already read and the rest of r to a temporary file
+func spillBody(head []byte, r io.Reader) (string, int64, error) {
+	file, err := os.CreateTemp("", "resterx-body-*")
+	if err != nil {
+		return "", int64(len(head)), err
+	}
+	defer file.Close()
+
+	size, err := io.Copy(file, io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", size, err
+	}
+
+	spilledBodies.mutex.Lock()
+	spilledBodies.files = append(spilledBodies.files, file.Name())
+	spilledBodies.mutex.Unlock()
+	return file.Name(), size, nil
+}
+
+// RemoveSpilledBodies deletes the temporary files holding large response
+// bodies. The CLI calls it before exiting.
+func RemoveSpilledBodies() {
+	spilledBodies.mutex.Lock()
+	defer spilledBodies.mutex.Unlock()
+	for _, file := range spilledBodies.files {
+		os.Remove(file)
+	}
+	spilledBodies.files = nil
+}
+
+// saveBody streams r to path, reporting progress as it goes
+func saveBody(r io.Reader, path string, total int64, progress ProgressFunc) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := &progressWriter{w: file, total: total, progress: progress}
+	return io.Copy(writer, r)
+}
+
+// progressWriter reports the bytes written so far after every write
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil {
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
+
+// isBinaryBody decides whether a body must not be treated as text, using the
+// Content-Type when it is conclusive and sniffing the data otherwise
+func isBinaryBody(contentType string, data []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" {
+		mediaType = http.DetectContentType(data)
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.Contains(mediaType, "json"),
+		strings.Contains(mediaType, "xml"),
+		strings.Contains(mediaType, "javascript"),
+		mediaType == "application/x-www-form-urlencoded":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "font/"),
+		strings.Contains(mediaType, "protobuf"),
+		strings.HasPrefix(mediaType, "application/grpc"),
+		mediaType == "application/pdf",
+		mediaType == "application/zip",
+		mediaType == "application/gzip":
+		return true
+	}
+
+	return !looksLikeText(data)
+}
+
+// looksLikeText reports whether data is valid UTF-8 without control bytes
+func looksLikeText(data []byte) bool {
+	// A truncated body may end in the middle of a multi-byte character
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+	if !utf8.Valid(data) {
+		return false
+	}
+
+	for _, b := range data {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' {
+			return false
+		}
+	}
+	return true
+}
+
+// printBody prints the response body for the CLI, as a hex dump when binary
+func printBody(response APIResponse) {
+	if response.BodyFile != "" && (response.BodyTruncated || response.Body == "") {
+		fmt.Printf("Body saved to %s (%d bytes)\n", response.BodyFile, response.BodySize)
+		if response.Body == "" {
+			return
+		}
+	}
+
+	if !response.IsBinary {
+		fmt.Println(response.Body)
+		return
+	}
+
+	data, err := response.BodyBytes()
+	if err != nil {
+		fmt.Printf("Error decoding body: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Binary body (%s, %d bytes)\n", response.ContentType, response.BodySize)
+	if len(data) > hexDumpLimit {
+		fmt.Print(hex.Dump(data[:hexDumpLimit]))
+		fmt.Printf("... %d more bytes\n", response.BodySize-hexDumpLimit)
+		return
+	}
+	fmt.Print(hex.Dump(data))
+}
+
+// printSize prints the body size, and the size on the wire when it was compressed
+func printSize(response APIResponse) {
+	if response.ContentEncoding != "" {
+		fmt.Printf("Size: %d bytes (%s, %d bytes on the wire)\n",
+			response.BodySize, response.ContentEncoding, response.WireSize)
+		return
+	}
+	fmt.Printf("Size: %d bytes\n", response.BodySize)
+}
+
+// printProgress draws a single line download progress indicator
+func printProgress(written, total int64) {
+	if total > 0 {
+		fmt.Printf("\rDownloaded %d / %d bytes (%.0f%%)", written, total, float64(written)/float64(total)*100)
+	} else {
+		fmt.Printf("\rDownloaded %d bytes", written)
+	}
+}
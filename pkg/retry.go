@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry defaults used when the policy leaves them unset
+const (
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// defaultRetryStatusCodes are retried when the policy lists none
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy retries requests that failed to connect or got one of
+// StatusCodes back. Only idempotent methods are retried, unless the request
+// carries an Idempotency-Key header. The wait between attempts grows
+// exponentially with jitter; a Retry-After header from the server is used
+// instead when present, and retrying stops if it asks for longer than
+// MaxBackoff.
+type RetryPolicy struct {
+	MaxRetries     int           `json:"maxRetries"` // 0 disables retries
+	StatusCodes    []int         `json:"statusCodes,omitempty"`
+	InitialBackoff time.Duration `json:"initialBackoff,omitempty"` // milliseconds or a duration such as "1s" in JSON
+	MaxBackoff     time.Duration `json:"maxBackoff,omitempty"`     // as InitialBackoff
+}
+
+// UnmarshalJSON reads the backoffs as milliseconds or duration strings, like
+// RequestOptions.Timeout
+func (p *RetryPolicy) UnmarshalJSON(data []byte) error {
+	type plain RetryPolicy
+	decoded := struct {
+		*plain
+		InitialBackoff json.RawMessage `json:"initialBackoff"`
+		MaxBackoff     json.RawMessage `json:"maxBackoff"`
+	}{plain: (*plain)(p)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	backoffs := []struct {
+		name  string
+		value json.RawMessage
+		into  *time.Duration
+	}{
+		{"initialBackoff", decoded.InitialBackoff, &p.InitialBackoff},
+		{"maxBackoff", decoded.MaxBackoff, &p.MaxBackoff},
+	}
+	for _, backoff := range backoffs {
+		if backoff.value == nil {
+			continue
+		}
+		duration, err := parseJSONDuration(backoff.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", backoff.name, err)
+		}
+		*backoff.into = duration
+	}
+	return nil
+}
+
+// MarshalJSON writes the backoffs in milliseconds, as UnmarshalJSON reads them
+func (p RetryPolicy) MarshalJSON() ([]byte, error) {
+	type plain RetryPolicy
+	return json.Marshal(struct {
+		plain
+		InitialBackoff float64 `json:"initialBackoff,omitempty"`
+		MaxBackoff     float64 `json:"maxBackoff,omitempty"`
+	}{
+		plain(p),
+		float64(p.InitialBackoff) / float64(time.Millisecond),
+		float64(p.MaxBackoff) / float64(time.Millisecond),
+	})
+}
+
+// RetryAttempt records one attempt of a retried request
+type RetryAttempt struct {
+	Attempt    int           `json:"attempt"`
+	StatusCode int           `json:"statusCode"`
+	Status     string        `json:"status,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Wait       time.Duration `json:"wait,omitempty"` // pause before the next attempt
+}
+
+// idempotentMethods can be repeated without changing the result, RFC 9110 9.2.2
+var idempotentMethods = map[string]bool{
+	"GET": true, "HEAD": true, "OPTIONS": true, "TRACE": true, "PUT": true, "DELETE": true,
+}
+
+// allows reports whether the request may be sent more than once
+func (p RetryPolicy) allows(request APIRequest) bool {
+	if p.MaxRetries <= 0 {
+		return false
+	}
+	method := strings.ToUpper(request.Method)
+	return method == "" || idempotentMethods[method] || request.HeaderFields().Has("Idempotency-Key")
+}
+
+// next decides whether to retry after the given attempt, numbered from 1,
+// and how long to wait first. failed is set when no response was received.
+func (p RetryPolicy) next(attempt int, response APIResponse, failed bool) (time.Duration, bool) {
+	if attempt > p.MaxRetries {
+		return 0, false
+	}
+	if !failed && !p.retriesStatus(response.StatusCode) {
+		return 0, false
+	}
+
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxRetryBackoff
+	}
+
+	if wait, ok := parseRetryAfter(response.RawHeaders.Get("Retry-After"), time.Now()); ok {
+		if wait > maxBackoff {
+			return 0, false
+		}
+		return wait, true
+	}
+
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultRetryBackoff
+	}
+	backoff := maxBackoff
+	if shift := attempt - 1; shift < 32 && initial<<shift < maxBackoff {
+		backoff = initial << shift
+	}
+
+	// Equal jitter: half fixed, half random, so clients spread out but still back off
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+func (p RetryPolicy) retriesStatus(code int) bool {
+	codes := p.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	for _, retryCode := range codes {
+		if code == retryCode {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// printAttempts prints the attempts of a retried request for the CLI
+func printAttempts(attempts []RetryAttempt) {
+	if len(attempts) < 2 {
+		return
+	}
+
+	fmt.Println("Attempts:")
+	for _, attempt := range attempts {
+		outcome := attempt.Status
+		if attempt.Error != "" {
+			outcome = attempt.Error
+		}
+		if attempt.Wait > 0 {
+			fmt.Printf("  %d. %s in %v, retried after %v\n", attempt.Attempt, outcome, attempt.Duration, attempt.Wait)
+		} else {
+			fmt.Printf("  %d. %s in %v\n", attempt.Attempt, outcome, attempt.Duration)
+		}
+	}
+}
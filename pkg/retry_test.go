@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		json        string
+		wantInitial time.Duration
+		wantMax     time.Duration
+		wantTimeout time.Duration
+		wantErr     string
+	}{
+		{
+			name:        "milliseconds",
+			json:        `{"timeout": 2000, "retry": {"maxRetries": 3, "initialBackoff": 500, "maxBackoff": 10000}}`,
+			wantInitial: 500 * time.Millisecond,
+			wantMax:     10 * time.Second,
+			wantTimeout: 2 * time.Second,
+		},
+		{
+			name:        "duration strings",
+			json:        `{"timeout": "1m", "retry": {"maxRetries": 3, "initialBackoff": "1s", "maxBackoff": "1m30s"}}`,
+			wantInitial: time.Second,
+			wantMax:     90 * time.Second,
+			wantTimeout: time.Minute,
+		},
+		{
+			name:        "milliseconds as strings",
+			json:        `{"retry": {"initialBackoff": "250", "maxBackoff": "1.5"}}`,
+			wantInitial: 250 * time.Millisecond,
+			wantMax:     1500 * time.Microsecond,
+		},
+		{
+			name: "unset",
+			json: `{"retry": {"maxRetries": 2, "initialBackoff": null}}`,
+		},
+		{
+			name:    "invalid",
+			json:    `{"retry": {"initialBackoff": "soon"}}`,
+			wantErr: "invalid initialBackoff",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var options RequestOptions
+			err := json.Unmarshal([]byte(test.json), &options)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error %v, want it to contain %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if options.Retry.InitialBackoff != test.wantInitial || options.Retry.MaxBackoff != test.wantMax {
+				t.Fatalf("backoffs %v and %v, want %v and %v", options.Retry.InitialBackoff, options.Retry.MaxBackoff, test.wantInitial, test.wantMax)
+			}
+			if options.Timeout != test.wantTimeout {
+				t.Fatalf("timeout %v, want %v", options.Timeout, test.wantTimeout)
+			}
+
+			// What is written reads back the same
+			data, err := json.Marshal(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded RequestOptions
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Retry.InitialBackoff != options.Retry.InitialBackoff || decoded.Retry.MaxBackoff != options.Retry.MaxBackoff {
+				t.Fatalf("%s read back as %+v", data, decoded.Retry)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LoadSavedRequest returns a request saved in the database, ready to send
+// with the auth it inherits from its folders and collection. The request
+// must belong to a collection of a workspace the user can access.
+func LoadSavedRequest(id, workspaceID, userID uint) (APIRequest, error) {
+	if !NewWorkspaceService().HasWorkspaceAccess(userID, workspaceID) {
+		return APIRequest{}, fmt.Errorf("access denied to workspace")
+	}
+
+	var saved DBRequest
+	if err := DB.Preload("Collection").First(&saved, id).Error; err != nil {
+		return APIRequest{}, fmt.Errorf("request %d: %v", id, err)
+	}
+	if saved.Collection.WorkspaceID != workspaceID {
+		return APIRequest{}, fmt.Errorf("request %d is not in this workspace", id)
+	}
+
+	request := APIRequest{
+		Method:   saved.Method,
+		URL:      saved.URL,
+		Body:     saved.Body,
+		BodyType: saved.BodyType,
+	}
+	columns := []struct {
+		name  string
+		value string
+		into  interface{}
+	}{
+		{"queryParams", saved.QueryParams, &request.QueryParams},
+		{"headers", saved.Headers, &request.RawHeaders},
+		{"form", saved.Form, &request.Form},
+		{"graphql", saved.GraphQL, &request.GraphQL},
+		{"grpc", saved.GRPC, &request.GRPC},
+		{"jsonrpc", saved.JSONRPC, &request.JSONRPC},
+		{"soap", saved.SOAP, &request.SOAP},
+		{"webSocket", saved.WebSocket, &request.Options.WebSocket},
+	}
+	for _, column := range columns {
+		if strings.TrimSpace(column.value) == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(column.value), column.into); err != nil {
+			return APIRequest{}, fmt.Errorf("request %d has invalid %s: %v", id, column.name, err)
+		}
+	}
+
+	auth, err := SavedRequestAuth(saved)
+	if err != nil {
+		return APIRequest{}, err
+	}
+	request.Auth = auth
+	return request, nil
+}
+
+// SaveRequest stores a request in a collection of a workspace the user can
+// access, in the folder folderID unless it is nil, and returns the saved row.
+// Its auth is stored as set on the request, nil inherits.
+func SaveRequest(request APIRequest, name string, collectionID uint, folderID *uint, workspaceID, userID uint) (*DBRequest, error) {
+	if !NewWorkspaceService().HasWorkspaceAccess(userID, workspaceID) {
+		return nil, fmt.Errorf("access denied to workspace")
+	}
+
+	var collection DBCollection
+	if err := DB.First(&collection, collectionID).Error; err != nil || collection.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("collection %d is not in this workspace", collectionID)
+	}
+	if folderID != nil {
+		var folder DBFolder
+		if err := DB.First(&folder, *folderID).Error; err != nil || folder.CollectionID != collectionID {
+			return nil, fmt.Errorf("folder %d is not in collection %d", *folderID, collectionID)
+		}
+	}
+
+	saved := DBRequest{
+		CollectionID: collectionID,
+		FolderID:     folderID,
+		Name:         name,
+		Method:       request.Method,
+		URL:          request.URL,
+		Body:         request.Body,
+		BodyType:     request.BodyType,
+		CreatedBy:    userID,
+	}
+	columns := []struct {
+		name  string
+		into  *string
+		value interface{}
+		empty bool
+	}{
+		{"queryParams", &saved.QueryParams, request.QueryParams, len(request.QueryParams) == 0},
+		{"headers", &saved.Headers, request.HeaderFields(), len(request.HeaderFields()) == 0},
+		{"form", &saved.Form, request.Form, len(request.Form) == 0},
+		{"graphql", &saved.GraphQL, request.GraphQL, request.GraphQL == nil},
+		{"grpc", &saved.GRPC, request.GRPC, request.GRPC == nil},
+		{"jsonrpc", &saved.JSONRPC, request.JSONRPC, request.JSONRPC == nil},
+		{"soap", &saved.SOAP, request.SOAP, request.SOAP == nil},
+		{"webSocket", &saved.WebSocket, request.Options.WebSocket, request.Options.WebSocket == nil},
+	}
+	for _, column := range columns {
+		if column.empty {
+			continue
+		}
+		data, err := json.Marshal(column.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", column.name, err)
+		}
+		*column.into = string(data)
+	}
+
+	authType, authData, err := request.Auth.Columns()
+	if err != nil {
+		return nil, err
+	}
+	saved.AuthType, saved.AuthData = authType, authData
+
+	if err := DB.Create(&saved).Error; err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// initTestDatabase points DB at a new database for the test
+func initTestDatabase(t *testing.T) {
+	t.Helper()
+	previous := DB
+	if err := InitDatabase(filepath.Join(t.TempDir(), "restcli.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB = previous })
+}
+
+func TestSavedRequestRoundTrip(t *testing.T) {
+	initTestDatabase(t)
+	DB.Create(&UserWorkspace{UserID: 1, WorkspaceID: 1})
+	DB.Create(&UserWorkspace{UserID: 2, WorkspaceID: 2})
+	collection := DBCollection{Name: "api", WorkspaceID: 1, AuthType: AuthBearer, AuthData: `{"token":"collection-token"}`}
+	DB.Create(&collection)
+	folder := DBFolder{Name: "sockets", CollectionID: collection.ID}
+	DB.Create(&folder)
+
+	tests := []struct {
+		name     string
+		request  APIRequest
+		folderID *uint
+		wantAuth *RequestAuth
+	}{
+		{
+			name: "websocket session",
+			request: APIRequest{
+				Method: "GET",
+				URL:    "wss://example.com/chat",
+				Options: RequestOptions{WebSocket: &WebSocketOptions{
+					Subprotocols: []string{"chat.v2", "json"},
+					Messages: []WebSocketMessage{
+						{Type: "json", Data: `{"join": "lobby"}`},
+						{Data: "hello", Await: 1},
+					},
+					MaxMessages: 3,
+					IdleTimeout: 2 * time.Second,
+				}},
+			},
+			folderID: &folder.ID,
+			wantAuth: &RequestAuth{Type: AuthBearer, Bearer: &BearerAuth{Token: "collection-token"}},
+		},
+		{
+			name: "http request with its own auth",
+			request: APIRequest{
+				Method:      "POST",
+				URL:         "https://example.com/orders",
+				QueryParams: []QueryParam{{Name: "dry run", Value: "a&b"}},
+				RawHeaders:  HeaderList{{Name: "Accept", Value: "a"}, {Name: "Accept", Value: "b"}},
+				Body:        `{"id": 1}`,
+				GraphQL:     &GraphQLRequest{Query: "{ orders { id } }"},
+				Auth:        &RequestAuth{Type: AuthBasic, Basic: &BasicAuth{Username: "ada", Password: "secret"}},
+			},
+			wantAuth: &RequestAuth{Type: AuthBasic, Basic: &BasicAuth{Username: "ada", Password: "secret"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved, err := SaveRequest(test.request, test.name, collection.ID, test.folderID, 1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadSavedRequest(saved.ID, 2, 2); err == nil {
+				t.Fatal("loaded a request of another workspace")
+			}
+
+			loaded, err := LoadSavedRequest(saved.ID, 1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(loaded.Auth, test.wantAuth) {
+				t.Fatalf("auth %+v, want %+v", loaded.Auth, test.wantAuth)
+			}
+			want := test.request
+			want.Auth, loaded.Auth = nil, nil
+			if !reflect.DeepEqual(loaded.Options.WebSocket, want.Options.WebSocket) {
+				t.Fatalf("webSocket %+v, want %+v", loaded.Options.WebSocket, want.Options.WebSocket)
+			}
+			if loaded.Method != want.Method || loaded.URL != want.URL || loaded.Body != want.Body {
+				t.Fatalf("loaded %s %s %q, want %s %s %q", loaded.Method, loaded.URL, loaded.Body, want.Method, want.URL, want.Body)
+			}
+			if !reflect.DeepEqual(loaded.HeaderFields(), want.HeaderFields()) {
+				t.Fatalf("headers %v, want %v", loaded.HeaderFields(), want.HeaderFields())
+			}
+			if !reflect.DeepEqual(loaded.QueryParams, want.QueryParams) {
+				t.Fatalf("query params %v, want %v", loaded.QueryParams, want.QueryParams)
+			}
+			if !reflect.DeepEqual(loaded.GraphQL, want.GraphQL) {
+				t.Fatalf("graphql %+v, want %+v", loaded.GraphQL, want.GraphQL)
+			}
+		})
+	}
+
+	if _, err := SaveRequest(APIRequest{Method: "GET", URL: "https://example.com"}, "intruder", collection.ID, nil, 2, 2); err == nil {
+		t.Fatal("saved into a collection of another workspace")
+	}
+}
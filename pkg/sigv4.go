@@ -0,0 +1,347 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload modes of AWS Signature Version 4
+const (
+	AWSPayloadSigned   = "signed"   // the body's SHA-256 is signed (default)
+	AWSPayloadUnsigned = "unsigned" // UNSIGNED-PAYLOAD, for S3 over TLS
+	AWSPayloadChunked  = "chunked"  // aws-chunked, each chunk of the body is signed
+)
+
+const (
+	awsAlgorithm       = "AWS4-HMAC-SHA256"
+	awsTimeFormat      = "20060102T150405Z"
+	awsUnsignedPayload = "UNSIGNED-PAYLOAD"
+	awsStreamingSHA256 = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	awsChunkSize       = 64 << 10
+)
+
+// AWSSigV4Auth signs requests with AWS Signature Version 4. Credentials and
+// region left empty are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN and AWS_REGION (or AWS_DEFAULT_REGION) variables of the
+// active environment, and from the CLI also from the process environment.
+type AWSSigV4Auth struct {
+	AccessKey    string `json:"accessKey,omitempty"`
+	SecretKey    string `json:"secretKey,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Service      string `json:"service"`           // such as execute-api or s3
+	Payload      string `json:"payload,omitempty"` // signed (default), unsigned or chunked
+}
+
+func (a *AWSSigV4Auth) substitute(replace func(string) string) *AWSSigV4Auth {
+	if a == nil {
+		return nil
+	}
+	return &AWSSigV4Auth{
+		AccessKey:    replace(a.AccessKey),
+		SecretKey:    replace(a.SecretKey),
+		SessionToken: replace(a.SessionToken),
+		Region:       replace(a.Region),
+		Service:      replace(a.Service),
+		Payload:      a.Payload,
+	}
+}
+
+// fill sets the settings left empty from the AWS_* variables that lookup
+// returns by name
+func (a *AWSSigV4Auth) fill(lookup func(name string) string) {
+	set := func(value *string, names ...string) {
+		for _, name := range names {
+			if *value == "" {
+				*value = lookup(name)
+			}
+		}
+	}
+	// A session token only belongs to the key it was issued with
+	sessionToken := a.AccessKey == ""
+	set(&a.AccessKey, "AWS_ACCESS_KEY_ID")
+	set(&a.SecretKey, "AWS_SECRET_ACCESS_KEY")
+	if sessionToken {
+		set(&a.SessionToken, "AWS_SESSION_TOKEN")
+	}
+	set(&a.Region, "AWS_REGION", "AWS_DEFAULT_REGION")
+}
+
+// credentials returns the settings, filled in from the process environment
+// when processEnv is set
+func (a *AWSSigV4Auth) credentials(processEnv bool) (AWSSigV4Auth, error) {
+	filled := *a
+	if processEnv {
+		filled.fill(os.Getenv)
+	}
+
+	switch {
+	case filled.AccessKey == "" || filled.SecretKey == "":
+		return filled, fmt.Errorf("AWS SigV4 auth has no access key and secret key")
+	case filled.Region == "":
+		return filled, fmt.Errorf("AWS SigV4 auth has no region")
+	case filled.Service == "":
+		return filled, fmt.Errorf("AWS SigV4 auth has no service")
+	}
+	switch strings.ToLower(filled.Payload) {
+	case "", AWSPayloadSigned, AWSPayloadUnsigned, AWSPayloadChunked:
+		filled.Payload = strings.ToLower(filled.Payload)
+	default:
+		return filled, fmt.Errorf("unknown AWS payload mode %q, use signed, unsigned or chunked", filled.Payload)
+	}
+	return filled, nil
+}
+
+// scope returns the credential scope of a signature made on date
+func (a AWSSigV4Auth) scope(date time.Time) string {
+	return date.Format("20060102") + "/" + a.Region + "/" + a.Service + "/aws4_request"
+}
+
+// signingKey derives the key of the credential scope
+func (a AWSSigV4Auth) signingKey(date time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+a.SecretKey), date.Format("20060102"))
+	key = hmacSHA256(key, a.Region)
+	key = hmacSHA256(key, a.Service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// signAWSRequest signs a request about to be sent. The body is read to hash
+// it, or replaced by its aws-chunked encoding in chunked mode.
+func signAWSRequest(req *http.Request, body *requestBody, auth *AWSSigV4Auth, now time.Time, processEnv bool) error {
+	signer, err := auth.credentials(processEnv)
+	if err != nil {
+		return err
+	}
+	now = now.UTC()
+	amzDate := now.Format(awsTimeFormat)
+
+	var payload []byte
+	if body != nil && signer.Payload != AWSPayloadUnsigned {
+		reader, err := body.open()
+		if err != nil {
+			return err
+		}
+		payload, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	payloadHash := sha256Hex(payload)
+	switch signer.Payload {
+	case AWSPayloadUnsigned:
+		payloadHash = awsUnsignedPayload
+	case AWSPayloadChunked:
+		payloadHash = awsStreamingSHA256
+		req.Header.Set("Content-Encoding", joinEncoding("aws-chunked", req.Header.Get("Content-Encoding")))
+		req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(len(payload)))
+		req.ContentLength = awsChunkedLength(len(payload))
+	}
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if signer.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", signer.SessionToken)
+	}
+	// S3 wants the payload hash as a header, other services accept it
+	if signer.Service == "s3" || signer.Payload != "" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders, canonicalRequest := awsCanonicalRequest(req, signer.Service, payloadHash)
+	scope := signer.scope(now)
+	stringToSign := awsStringToSign(amzDate, scope, canonicalRequest)
+	key := signer.signingKey(now)
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, signer.AccessKey, scope, signedHeaders, signature))
+
+	if signer.Payload == AWSPayloadChunked {
+		encoded := awsChunkedBody(payload, key, amzDate, scope, signature)
+		open := func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(encoded)), nil
+		}
+		// The body read for the chunks is no longer sent
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		req.Body, _ = open()
+		req.GetBody = open
+	}
+	return nil
+}
+
+// awsCanonicalRequest returns the signed header names and the canonical
+// request of a request with the headers it is signed with
+func awsCanonicalRequest(req *http.Request, service, payloadHash string) (signedHeaders, canonicalRequest string) {
+	signedHeaders, canonicalHeaders := awsCanonicalHeaders(req)
+	return signedHeaders, strings.Join([]string{
+		req.Method,
+		awsCanonicalPath(req.URL, service),
+		awsCanonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+}
+
+// awsStringToSign returns the string whose HMAC is the request's signature
+func awsStringToSign(amzDate, scope, canonicalRequest string) string {
+	return strings.Join([]string{awsAlgorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+}
+
+// awsCanonicalHeaders returns the signed header names and the canonical
+// header block. Headers that proxies and the transport may change are left
+// out, like the AWS SDKs do.
+func awsCanonicalHeaders(req *http.Request) (signed, canonical string) {
+	values := map[string][]string{}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values["host"] = []string{host}
+	for name, list := range req.Header {
+		lower := strings.ToLower(name)
+		switch lower {
+		case "authorization", "user-agent", "x-amzn-trace-id", "expect", "connection", "host":
+			continue
+		}
+		values[lower] = append(values[lower], list...)
+	}
+	if req.ContentLength > 0 {
+		values["content-length"] = []string{strconv.FormatInt(req.ContentLength, 10)}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var block strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, len(values[name]))
+		for i, value := range values[name] {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		block.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	return strings.Join(names, ";"), block.String()
+}
+
+// awsCanonicalPath encodes each segment of the path. S3 encodes the path
+// once, every other service encodes the escaped path a second time.
+func awsCanonicalPath(u *url.URL, service string) string {
+	path := u.EscapedPath()
+	if service == "s3" {
+		path = u.Path
+	}
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsCanonicalQuery sorts the query parameters and encodes them the AWS way
+func awsCanonicalQuery(u *url.URL) string {
+	values, _ := url.ParseQuery(u.RawQuery)
+	pairs := make([]string, 0, len(values))
+	for name, list := range values {
+		for _, value := range list {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything but the RFC 3986 unreserved characters
+func awsEscape(s string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+// awsChunkedBody encodes the payload as aws-chunked. Every chunk, and the
+// empty chunk that ends the body, carries a signature chained from the
+// request's signature.
+func awsChunkedBody(payload, key []byte, amzDate, scope, signature string) []byte {
+	var encoded bytes.Buffer
+	emptyHash := sha256Hex(nil)
+	previous := signature
+	for offset := 0; ; {
+		end := offset + awsChunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk := payload[offset:end]
+		stringToSign := strings.Join([]string{awsAlgorithm + "-PAYLOAD", amzDate, scope, previous, emptyHash, sha256Hex(chunk)}, "\n")
+		previous = hex.EncodeToString(hmacSHA256(key, stringToSign))
+		fmt.Fprintf(&encoded, "%x;chunk-signature=%s\r\n", len(chunk), previous)
+		encoded.Write(chunk)
+		encoded.WriteString("\r\n")
+		if len(chunk) == 0 {
+			return encoded.Bytes()
+		}
+		offset = end
+	}
+}
+
+// awsChunkedLength is the length of the aws-chunked encoding of n bytes
+func awsChunkedLength(n int) int64 {
+	chunkLength := func(size int) int64 {
+		// hex size, ";chunk-signature=", 64 hex digits, CRLF, data, CRLF
+		return int64(len(strconv.FormatInt(int64(size), 16)) + 17 + 64 + 2 + size + 2)
+	}
+	length := chunkLength(0)
+	for ; n > awsChunkSize; n -= awsChunkSize {
+		length += chunkLength(awsChunkSize)
+	}
+	if n > 0 {
+		length += chunkLength(n)
+	}
+	return length
+}
+
+// joinEncoding puts coding in front of the codings already listed
+func joinEncoding(coding, existing string) string {
+	if existing == "" {
+		return coding
+	}
+	return coding + "," + existing
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
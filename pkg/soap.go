@@ -0,0 +1,653 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// SOAPRequest builds the body of a request as a SOAP envelope around an
+// operation. The operation element comes from Body when set and is built
+// from Params otherwise. With WSDL set, the action, namespace and endpoint
+// of the operation are looked up there when the request leaves them empty.
+type SOAPRequest struct {
+	Version   string      `json:"version,omitempty"` // 1.1 (default) or 1.2
+	Operation string      `json:"operation,omitempty"`
+	Namespace string      `json:"namespace,omitempty"` // of the operation element
+	Action    string      `json:"action,omitempty"`    // SOAPAction
+	Params    []SOAPParam `json:"params,omitempty"`    // child elements of the operation element, in order
+	Body      string      `json:"body,omitempty"`      // XML placed in the SOAP body as is
+	Header    string      `json:"header,omitempty"`    // XML placed in the SOAP header
+	WSDL      string      `json:"wsdl,omitempty"`      // URL or file of the service's WSDL
+}
+
+// SOAPParam is a child element of the operation element with a text value
+type SOAPParam struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SOAPFault is the fault a SOAP response reports, in either SOAP version
+type SOAPFault struct {
+	Code    string `json:"code"`              // faultcode, or Code/Value in SOAP 1.2
+	Subcode string `json:"subcode,omitempty"` // SOAP 1.2 only
+	String  string `json:"string"`            // faultstring, or the first Reason/Text
+	Actor   string `json:"actor,omitempty"`   // faultactor, or Role
+	Detail  string `json:"detail,omitempty"`  // XML of the detail element
+}
+
+// SOAPService is a port of a service described by a WSDL
+type SOAPService struct {
+	Name       string          `json:"name"`
+	Port       string          `json:"port"`
+	Endpoint   string          `json:"endpoint"`
+	Version    string          `json:"version"`
+	Operations []SOAPOperation `json:"operations"`
+}
+
+// SOAPOperation describes how to call an operation
+type SOAPOperation struct {
+	Name          string   `json:"name"`
+	Action        string   `json:"action"`
+	Style         string   `json:"style"`     // document or rpc
+	Namespace     string   `json:"namespace"` // of the operation element
+	Element       string   `json:"element"`   // name of the operation element
+	Qualified     bool     `json:"qualified"` // whether parameters are in Namespace
+	Parameters    []string `json:"parameters"`
+	Body          string   `json:"body"` // the operation element with ? for each value, for SOAPRequest.Body
+	Documentation string   `json:"documentation,omitempty"`
+}
+
+// substitute returns a copy with replace applied to the texts of the
+// envelope, or nil for a nil request
+func (s *SOAPRequest) substitute(replace func(string) string) *SOAPRequest {
+	if s == nil {
+		return nil
+	}
+	copied := *s
+	copied.Action = replace(s.Action)
+	copied.Body = replace(s.Body)
+	copied.Header = replace(s.Header)
+	copied.WSDL = replace(s.WSDL)
+	copied.Params = make([]SOAPParam, len(s.Params))
+	for i, param := range s.Params {
+		copied.Params[i] = SOAPParam{Name: param.Name, Value: replace(param.Value)}
+	}
+	return &copied
+}
+
+// operation describes the operation of the request from its own fields
+func (s *SOAPRequest) operation() SOAPOperation {
+	return SOAPOperation{
+		Name:      s.Operation,
+		Action:    s.Action,
+		Namespace: s.Namespace,
+		Element:   s.Operation,
+		Qualified: true,
+	}
+}
+
+// envelope returns the SOAP envelope of the request
+func (s *SOAPRequest) envelope(operation SOAPOperation) (string, error) {
+	namespace := soap11Namespace
+	if s.Version == "1.2" {
+		namespace = soap12Namespace
+	}
+
+	var envelope strings.Builder
+	envelope.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	envelope.WriteString(fmt.Sprintf(`<soap:Envelope xmlns:soap="%s">`+"\n", namespace))
+	if s.Header != "" {
+		if err := checkXML(s.Header); err != nil {
+			return "", fmt.Errorf("SOAP header: %v", err)
+		}
+		envelope.WriteString("  <soap:Header>" + s.Header + "</soap:Header>\n")
+	}
+	envelope.WriteString("  <soap:Body>\n")
+
+	if s.Body != "" {
+		if err := checkXML(s.Body); err != nil {
+			return "", fmt.Errorf("SOAP body: %v", err)
+		}
+		envelope.WriteString(indentLines(strings.TrimSpace(s.Body), "    ") + "\n")
+	} else {
+		if operation.Element == "" {
+			return "", fmt.Errorf("SOAP request needs an operation or a body")
+		}
+		prefix, declaration := "", ""
+		if operation.Namespace != "" {
+			prefix = "m:"
+			declaration = fmt.Sprintf(` xmlns:m="%s"`, xmlEscape(operation.Namespace))
+		}
+		paramPrefix := prefix
+		if !operation.Qualified {
+			paramPrefix = ""
+		}
+		envelope.WriteString(fmt.Sprintf("    <%s%s%s>\n", prefix, operation.Element, declaration))
+		for _, param := range s.Params {
+			envelope.WriteString(fmt.Sprintf("      <%s%s>%s</%s%s>\n", paramPrefix, param.Name, xmlEscape(param.Value), paramPrefix, param.Name))
+		}
+		envelope.WriteString(fmt.Sprintf("    </%s%s>\n", prefix, operation.Element))
+	}
+
+	envelope.WriteString("  </soap:Body>\n")
+	envelope.WriteString("</soap:Envelope>")
+	return envelope.String(), nil
+}
+
+// checkXML reports whether a fragment of XML is well formed
+func checkXML(fragment string) error {
+	decoder := xml.NewDecoder(strings.NewReader("<fragment>" + fragment + "</fragment>"))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func xmlEscape(s string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(s))
+	return buffer.String()
+}
+
+func indentLines(text, indent string) string {
+	return indent + strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+// expandSOAP turns a SOAP request into the plain HTTP request sent for it
+func expandSOAP(request APIRequest, operation SOAPOperation) (APIRequest, error) {
+	soap := request.SOAP
+	request.SOAP = nil
+
+	envelope, err := soap.envelope(operation)
+	if err != nil {
+		return request, err
+	}
+	request.Method = "POST"
+	request.Body, request.BodyType, request.Form = envelope, BodyTypeRaw, nil
+
+	headers := append(HeaderList{}, request.RawHeaders...)
+	if soap.Version == "1.2" {
+		if !request.HeaderFields().Has("Content-Type") {
+			contentType := "application/soap+xml; charset=utf-8"
+			if operation.Action != "" {
+				contentType += fmt.Sprintf(`; action="%s"`, operation.Action)
+			}
+			headers = append(headers, HeaderField{Name: "Content-Type", Value: contentType})
+		}
+	} else {
+		if !request.HeaderFields().Has("Content-Type") {
+			headers = append(headers, HeaderField{Name: "Content-Type", Value: "text/xml; charset=utf-8"})
+		}
+		if !request.HeaderFields().Has("SOAPAction") {
+			headers = append(headers, HeaderField{Name: "SOAPAction", Value: fmt.Sprintf(`"%s"`, operation.Action)})
+		}
+	}
+	request.RawHeaders = headers
+	return request, nil
+}
+
+// parseSOAPFault returns the fault of a SOAP response body, or nil
+func parseSOAPFault(body string) *SOAPFault {
+	type innerXML struct {
+		XML string `xml:",innerxml"`
+	}
+	var envelope struct {
+		Body struct {
+			Fault *struct {
+				FaultCode   string    `xml:"faultcode"`
+				FaultString string    `xml:"faultstring"`
+				FaultActor  string    `xml:"faultactor"`
+				Detail      *innerXML `xml:"detail"`
+				Code        struct {
+					Value   string `xml:"Value"`
+					Subcode struct {
+						Value string `xml:"Value"`
+					} `xml:"Subcode"`
+				} `xml:"Code"`
+				Reason struct {
+					Text []string `xml:"Text"`
+				} `xml:"Reason"`
+				Role     string    `xml:"Role"`
+				Detail12 *innerXML `xml:"Detail"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+	if xml.Unmarshal([]byte(body), &envelope) != nil || envelope.Body.Fault == nil {
+		return nil
+	}
+
+	fault := envelope.Body.Fault
+	result := &SOAPFault{
+		Code:   strings.TrimSpace(fault.FaultCode),
+		String: strings.TrimSpace(fault.FaultString),
+		Actor:  strings.TrimSpace(fault.FaultActor),
+	}
+	if fault.Detail != nil {
+		result.Detail = strings.TrimSpace(fault.Detail.XML)
+	}
+	if result.Code == "" {
+		// SOAP 1.2
+		result.Code = strings.TrimSpace(fault.Code.Value)
+		result.Subcode = strings.TrimSpace(fault.Code.Subcode.Value)
+		if len(fault.Reason.Text) > 0 {
+			result.String = strings.TrimSpace(fault.Reason.Text[0])
+		}
+		result.Actor = strings.TrimSpace(fault.Role)
+		if fault.Detail12 != nil {
+			result.Detail = strings.TrimSpace(fault.Detail12.XML)
+		}
+	}
+	return result
+}
+
+// executeSOAP completes the operation from the WSDL if needed, sends the
+// envelope and parses any fault
+func (e *RequestEngine) executeSOAP(ctx context.Context, request APIRequest) APIResponse {
+	start := time.Now()
+	failed := func(err error) APIResponse {
+		return APIResponse{Error: err.Error(), ResponseTime: time.Since(start)}
+	}
+
+	soap := *request.SOAP
+	operation := soap.operation()
+	if soap.WSDL != "" && soap.Operation != "" && (soap.Action == "" || soap.Namespace == "" || request.URL == "") {
+		services, err := e.ImportWSDL(ctx, APIRequest{URL: soap.WSDL, RawHeaders: request.RawHeaders, Headers: request.Headers, Options: request.Options})
+		if err != nil {
+			return failed(err)
+		}
+		service, found := findSOAPOperation(services, soap.Operation, soap.Version)
+		if !found {
+			return failed(fmt.Errorf("operation %q not found in %s", soap.Operation, soap.WSDL))
+		}
+		described := service.Operations[0]
+		if soap.Action != "" {
+			described.Action = soap.Action
+		}
+		if soap.Namespace != "" {
+			described.Namespace = soap.Namespace
+		}
+		if request.URL == "" {
+			request.URL = service.Endpoint
+		}
+		if soap.Version == "" {
+			soap.Version = service.Version
+		}
+		operation = described
+	}
+	request.SOAP = &soap
+
+	expanded, err := expandSOAP(request, operation)
+	if err != nil {
+		return failed(err)
+	}
+	response := e.Execute(ctx, expanded)
+	response.SOAPFault = parseSOAPFault(response.Body)
+	return response
+}
+
+// findSOAPOperation returns the service port with the named operation as its
+// only operation, preferring the port of the SOAP version asked for
+func findSOAPOperation(services []SOAPService, name, version string) (SOAPService, bool) {
+	var match SOAPService
+	found := false
+	for _, service := range services {
+		for _, operation := range service.Operations {
+			if operation.Name != name {
+				continue
+			}
+			if !found || (version != "" && service.Version == version && match.Version != version) || (version == "" && service.Version == "1.1" && match.Version != "1.1") {
+				match = service
+				match.Operations = []SOAPOperation{operation}
+				found = true
+			}
+		}
+	}
+	return match, found
+}
+
+// ImportWSDL reads the WSDL at request.URL, an http(s) URL fetched with the
+// request's headers and options or, where the engine allows local access, a
+// local file, and lists the operations of each port. Schemas imported from
+// other documents are not followed.
+func (e *RequestEngine) ImportWSDL(ctx context.Context, request APIRequest) ([]SOAPService, error) {
+	var data []byte
+	lower := strings.ToLower(request.URL)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		request.Method = "GET"
+		request.SOAP = nil
+		response := e.Execute(ctx, request)
+		if response.Error != "" {
+			return nil, fmt.Errorf("fetching WSDL: %s", response.Error)
+		}
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
+			return nil, fmt.Errorf("fetching WSDL: status %s", response.Status)
+		}
+		data = []byte(response.Body)
+	} else {
+		if !e.localAccess.Load() {
+			return nil, fmt.Errorf("WSDL URL must use http or https, files cannot be read here")
+		}
+		var err error
+		if data, err = os.ReadFile(strings.TrimPrefix(request.URL, "file://")); err != nil {
+			return nil, err
+		}
+	}
+	return parseWSDL(data)
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	ComplexType *xsdComplexType `xml:"complexType"`
+}
+
+type xsdComplexType struct {
+	Name     string       `xml:"name,attr"`
+	Sequence []xsdElement `xml:"sequence>element"`
+	All      []xsdElement `xml:"all>element"`
+}
+
+type xsdSchema struct {
+	TargetNamespace    string           `xml:"targetNamespace,attr"`
+	ElementFormDefault string           `xml:"elementFormDefault,attr"`
+	Elements           []xsdElement     `xml:"element"`
+	ComplexTypes       []xsdComplexType `xml:"complexType"`
+}
+
+type wsdlDefinitions struct {
+	TargetNamespace string      `xml:"targetNamespace,attr"`
+	Schemas         []xsdSchema `xml:"types>schema"`
+	Messages        []struct {
+		Name  string `xml:"name,attr"`
+		Parts []struct {
+			Name    string `xml:"name,attr"`
+			Element string `xml:"element,attr"`
+			Type    string `xml:"type,attr"`
+		} `xml:"part"`
+	} `xml:"message"`
+	PortTypes []struct {
+		Name       string `xml:"name,attr"`
+		Operations []struct {
+			Name          string `xml:"name,attr"`
+			Documentation string `xml:"documentation"`
+			Input         struct {
+				Message string `xml:"message,attr"`
+			} `xml:"input"`
+		} `xml:"operation"`
+	} `xml:"portType"`
+	Bindings []struct {
+		Name    string `xml:"name,attr"`
+		Type    string `xml:"type,attr"`
+		Binding struct {
+			XMLName xml.Name
+			Style   string `xml:"style,attr"`
+		} `xml:"binding"`
+		Operations []struct {
+			Name      string `xml:"name,attr"`
+			Operation struct {
+				Action string `xml:"soapAction,attr"`
+				Style  string `xml:"style,attr"`
+			} `xml:"operation"`
+			Input struct {
+				Body struct {
+					Namespace string `xml:"namespace,attr"`
+				} `xml:"body"`
+			} `xml:"input"`
+		} `xml:"operation"`
+	} `xml:"binding"`
+	Services []struct {
+		Name  string `xml:"name,attr"`
+		Ports []struct {
+			Name    string `xml:"name,attr"`
+			Binding string `xml:"binding,attr"`
+			Address struct {
+				Location string `xml:"location,attr"`
+			} `xml:"address"`
+		} `xml:"port"`
+	} `xml:"service"`
+}
+
+// localName strips the namespace prefix of a qualified name
+func localName(qualified string) string {
+	if i := strings.LastIndex(qualified, ":"); i >= 0 {
+		return qualified[i+1:]
+	}
+	return qualified
+}
+
+// parseWSDL lists the SOAP operations of each port of a WSDL 1.1 document
+func parseWSDL(data []byte) ([]SOAPService, error) {
+	var definitions wsdlDefinitions
+	if err := xml.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("invalid WSDL: %v", err)
+	}
+
+	elements := make(map[string]xsdElement)
+	elementSchemas := make(map[string]xsdSchema)
+	complexTypes := make(map[string]xsdComplexType)
+	for _, schema := range definitions.Schemas {
+		for _, element := range schema.Elements {
+			elements[element.Name] = element
+			elementSchemas[element.Name] = schema
+		}
+		for _, complexType := range schema.ComplexTypes {
+			complexTypes[complexType.Name] = complexType
+		}
+	}
+
+	// children returns the child elements of an element or complex type
+	children := func(element xsdElement) []xsdElement {
+		complexType := element.ComplexType
+		if complexType == nil {
+			if named, found := complexTypes[localName(element.Type)]; found {
+				complexType = &named
+			}
+		}
+		if complexType == nil {
+			return nil
+		}
+		return append(append([]xsdElement{}, complexType.Sequence...), complexType.All...)
+	}
+
+	var services []SOAPService
+	for _, service := range definitions.Services {
+		for _, port := range service.Ports {
+			for _, binding := range definitions.Bindings {
+				if binding.Name != localName(port.Binding) {
+					continue
+				}
+				version := "1.1"
+				if binding.Binding.XMLName.Space == "http://schemas.xmlsoap.org/wsdl/soap12/" {
+					version = "1.2"
+				} else if binding.Binding.XMLName.Space != "http://schemas.xmlsoap.org/wsdl/soap/" {
+					continue // an HTTP or other non-SOAP binding
+				}
+
+				result := SOAPService{Name: service.Name, Port: port.Name, Endpoint: port.Address.Location, Version: version}
+				for _, bound := range binding.Operations {
+					operation := SOAPOperation{
+						Name:      bound.Name,
+						Action:    bound.Operation.Action,
+						Style:     bound.Operation.Style,
+						Namespace: bound.Input.Body.Namespace,
+						Element:   bound.Name,
+					}
+					if operation.Style == "" {
+						operation.Style = binding.Binding.Style
+					}
+					if operation.Style == "" {
+						operation.Style = "document"
+					}
+
+					// The input message gives the parameters
+					var parts []xsdElement
+					for _, portType := range definitions.PortTypes {
+						if portType.Name != localName(binding.Type) {
+							continue
+						}
+						for _, declared := range portType.Operations {
+							if declared.Name != bound.Name {
+								continue
+							}
+							operation.Documentation = strings.TrimSpace(declared.Documentation)
+							for _, message := range definitions.Messages {
+								if message.Name != localName(declared.Input.Message) {
+									continue
+								}
+								for _, part := range message.Parts {
+									if operation.Style == "document" && part.Element != "" {
+										// The part's element is the operation element
+										element := elements[localName(part.Element)]
+										operation.Element = localName(part.Element)
+										if schema, found := elementSchemas[operation.Element]; found {
+											operation.Namespace = schema.TargetNamespace
+											operation.Qualified = schema.ElementFormDefault == "qualified"
+										}
+										parts = append(parts, children(element)...)
+									} else {
+										parts = append(parts, xsdElement{Name: part.Name, Type: part.Type})
+									}
+								}
+							}
+						}
+					}
+					if operation.Namespace == "" {
+						operation.Namespace = definitions.TargetNamespace
+					}
+					for _, part := range parts {
+						name := part.Name
+						if name == "" {
+							name = localName(part.Ref)
+						}
+						operation.Parameters = append(operation.Parameters, name)
+					}
+					operation.Body = soapTemplate(operation, parts, children)
+					result.Operations = append(result.Operations, operation)
+				}
+				services = append(services, result)
+			}
+		}
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("WSDL describes no SOAP services")
+	}
+	return services, nil
+}
+
+// soapTemplate returns the operation element with ? for every value, nesting
+// complex parameters a few levels deep
+func soapTemplate(operation SOAPOperation, parts []xsdElement, children func(xsdElement) []xsdElement) string {
+	prefix, declaration := "", ""
+	if operation.Namespace != "" {
+		prefix = "m:"
+		declaration = fmt.Sprintf(` xmlns:m="%s"`, xmlEscape(operation.Namespace))
+	}
+	paramPrefix := prefix
+	if !operation.Qualified {
+		paramPrefix = ""
+	}
+
+	var template strings.Builder
+	var write func(elements []xsdElement, indent string, depth int)
+	write = func(elements []xsdElement, indent string, depth int) {
+		for _, element := range elements {
+			name := element.Name
+			if name == "" {
+				name = localName(element.Ref)
+			}
+			nested := children(element)
+			if len(nested) == 0 || depth >= 3 {
+				template.WriteString(fmt.Sprintf("%s<%s%s>?</%s%s>\n", indent, paramPrefix, name, paramPrefix, name))
+				continue
+			}
+			template.WriteString(fmt.Sprintf("%s<%s%s>\n", indent, paramPrefix, name))
+			write(nested, indent+"  ", depth+1)
+			template.WriteString(fmt.Sprintf("%s</%s%s>\n", indent, paramPrefix, name))
+		}
+	}
+
+	template.WriteString(fmt.Sprintf("<%s%s%s>\n", prefix, operation.Element, declaration))
+	write(parts, "  ", 0)
+	template.WriteString(fmt.Sprintf("</%s%s>", prefix, operation.Element))
+	return template.String()
+}
+
+// xpathProperty evaluates an XPath expression against an XML response for
+// an assertion. Prefixes declared anywhere in the document can be used, as
+// can soap and soap12 for the envelope namespaces. A node set gives the text
+// of its first node, or nil when empty.
+func xpathProperty(body, expression string) (interface{}, error) {
+	document, err := xmlquery.Parse(strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("response is not XML: %v", err)
+	}
+
+	namespaces := map[string]string{"soap": soap11Namespace, "soap12": soap12Namespace}
+	var collect func(node *xmlquery.Node)
+	collect = func(node *xmlquery.Node) {
+		for _, attr := range node.Attr {
+			if attr.Name.Space == "xmlns" {
+				namespaces[attr.Name.Local] = attr.Value
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(document)
+
+	compiled, err := xpath.CompileWithNS(expression, namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XPath %q: %v", expression, err)
+	}
+	switch result := compiled.Evaluate(xmlquery.CreateXPathNavigator(document)).(type) {
+	case *xpath.NodeIterator:
+		if !result.MoveNext() {
+			return nil, nil
+		}
+		return result.Current().Value(), nil
+	default:
+		return result, nil
+	}
+}
+
+// soapFaultProperty looks up a field of the SOAP fault for an assertion:
+// code (the default), subcode, string, actor or detail. Without a fault
+// every field is nil.
+func soapFaultProperty(fault *SOAPFault, property string) (interface{}, error) {
+	if fault == nil {
+		return nil, nil
+	}
+	switch property {
+	case "", "code":
+		return fault.Code, nil
+	case "subcode":
+		return fault.Subcode, nil
+	case "string", "reason":
+		return fault.String, nil
+	case "actor", "role":
+		return fault.Actor, nil
+	case "detail":
+		return fault.Detail, nil
+	default:
+		return nil, fmt.Errorf("unknown SOAP fault property %q", property)
+	}
+}
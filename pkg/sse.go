@@ -0,0 +1,294 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSSERetry is the reconnection delay used until the server sends a retry field
+const DefaultSSERetry = 3 * time.Second
+
+// SSEEvent is one event received from a text/event-stream response
+type SSEEvent struct {
+	ID         string    `json:"id,omitempty"` // last event ID when the event was dispatched
+	Event      string    `json:"event"`        // event type, "message" unless set
+	Data       string    `json:"data"`
+	Retry      int64     `json:"retry,omitempty"` // reconnection time in milliseconds, when sent with the event
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// SSEOptions turns a request into a Server-Sent Events subscription. Events
+// are parsed as they arrive and collected in APIResponse.Events.
+type SSEOptions struct {
+	MaxEvents     int    `json:"maxEvents,omitempty"`     // stop after this many events, 0 for no limit
+	Reconnect     bool   `json:"reconnect,omitempty"`     // reconnect when the stream ends, sending Last-Event-ID
+	MaxReconnects int    `json:"maxReconnects,omitempty"` // 0 reconnects until MaxEvents or cancellation
+	LastEventID   string `json:"lastEventId,omitempty"`   // sent on the first connection
+
+	OnEvent func(SSEEvent) `json:"-"` // called for each event as it arrives
+}
+
+// sseState is what a stream keeps across reconnections
+type sseState struct {
+	mutex       sync.Mutex
+	options     *SSEOptions
+	lastEventID string
+	retry       time.Duration
+	events      []SSEEvent
+}
+
+// full reports whether MaxEvents events have been received
+func (s *sseState) full() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.options.MaxEvents > 0 && len(s.events) >= s.options.MaxEvents
+}
+
+// stream subscribes to an event stream, reconnecting as the options allow
+func (e *RequestEngine) stream(ctx context.Context, request APIRequest, opts RequestOptions) APIResponse {
+	start := time.Now()
+	state := &sseState{
+		options:     opts.EventStream,
+		lastEventID: opts.EventStream.LastEventID,
+		retry:       DefaultSSERetry,
+	}
+	opts.sse = state
+
+	headers := removeHeader(request.RawHeaders, "Last-Event-ID")
+	if !request.HeaderFields().Has("Accept") {
+		headers = append(headers, HeaderField{Name: "Accept", Value: "text/event-stream"})
+	}
+
+	for reconnects := 0; ; reconnects++ {
+		request.RawHeaders = headers
+		if state.lastEventID != "" {
+			request.RawHeaders = append(append(HeaderList{}, headers...), HeaderField{Name: "Last-Event-ID", Value: state.lastEventID})
+		}
+		response, _ := e.send(ctx, request, opts)
+
+		// Only dropped connections are retried; an error status or a body
+		// that is not an event stream ends the subscription
+		dropped := response.StatusCode == 0 || (response.StatusCode == 200 && isEventStream(response.ContentType))
+		done := ctx.Err() != nil || state.full() || !opts.EventStream.Reconnect || !dropped ||
+			(opts.EventStream.MaxReconnects > 0 && reconnects >= opts.EventStream.MaxReconnects)
+
+		if !done {
+			timer := time.NewTimer(state.retry)
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+
+		response.Events = state.events
+		response.ResponseTime = time.Since(start)
+		return response
+	}
+}
+
+// isEventStream reports whether a Content-Type is text/event-stream
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// readEventStream parses events from body as they arrive, keeping the raw
+// stream in Body up to limit. It returns when the stream ends, MaxEvents is
+// reached or the request is cancelled, which is not an error.
+func readEventStream(ctx context.Context, body io.Reader, state *sseState, limit int64, response *APIResponse) error {
+	var raw bytes.Buffer
+	defer func() {
+		response.Body = raw.String()
+		response.BodySize = int64(raw.Len())
+		response.Events = state.events
+	}()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	scanner.Split(scanSSELines)
+
+	// The last event ID buffer carries over from event to event
+	state.mutex.Lock()
+	lastEventID := state.lastEventID
+	state.mutex.Unlock()
+
+	var eventType string
+	var data strings.Builder
+	var retry int64
+	first := true
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		if int64(raw.Len()+len(line)+1) <= limit {
+			raw.WriteString(line)
+			raw.WriteByte('\n')
+		} else {
+			response.BodyTruncated = true
+		}
+
+		if line == "" {
+			// A blank line dispatches the event, if it has any data
+			state.mutex.Lock()
+			state.lastEventID = lastEventID
+			state.mutex.Unlock()
+			if data.Len() > 0 {
+				state.mutex.Lock()
+				event := SSEEvent{
+					ID:         state.lastEventID,
+					Event:      eventType,
+					Data:       strings.TrimSuffix(data.String(), "\n"),
+					Retry:      retry,
+					ReceivedAt: time.Now(),
+				}
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				state.events = append(state.events, event)
+				full := state.options.MaxEvents > 0 && len(state.events) >= state.options.MaxEvents
+				state.mutex.Unlock()
+
+				if state.options.OnEvent != nil {
+					state.options.OnEvent(event)
+				}
+				if full {
+					return nil
+				}
+			}
+			eventType, retry = "", 0
+			data.Reset()
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue // comment, often used as a keep-alive
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastEventID = value
+			}
+		case "retry":
+			if milliseconds, err := strconv.ParseInt(value, 10, 64); err == nil && isDigits(value) {
+				retry = milliseconds
+				state.mutex.Lock()
+				state.retry = time.Duration(milliseconds) * time.Millisecond
+				state.mutex.Unlock()
+			}
+		}
+	}
+
+	// Ending the stream ourselves is how a subscription normally stops
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// scanSSELines splits a stream into lines ended by CRLF, LF or CR
+func scanSSELines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A CR may be followed by an LF that has not arrived yet
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		// A last line without an end of line never completes its event
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// eventProperty looks up a value of the received events for an assertion.
+// Property is "count" or "<index>.<field>" with field one of id, event, data
+// or retry; a negative index counts from the last event.
+func eventProperty(events []SSEEvent, property string) (interface{}, error) {
+	if property == "count" {
+		return len(events), nil
+	}
+
+	indexText, field, found := strings.Cut(property, ".")
+	if !found {
+		return nil, fmt.Errorf("invalid event property %q", property)
+	}
+	index, err := strconv.Atoi(indexText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event index %q", indexText)
+	}
+	if index < 0 {
+		index += len(events)
+	}
+	if index < 0 || index >= len(events) {
+		return nil, fmt.Errorf("event %s not received, got %d events", indexText, len(events))
+	}
+
+	event := events[index]
+	switch field {
+	case "id":
+		return event.ID, nil
+	case "event":
+		return event.Event, nil
+	case "data":
+		return event.Data, nil
+	case "retry":
+		return event.Retry, nil
+	default:
+		return nil, fmt.Errorf("unknown event field %q", field)
+	}
+}
+
+// printEvent prints an event as it arrives for the CLI
+func printEvent(event SSEEvent) {
+	fmt.Printf("[%s] event: %s", event.ReceivedAt.Format("15:04:05.000"), event.Event)
+	if event.ID != "" {
+		fmt.Printf("  id: %s", event.ID)
+	}
+	fmt.Println()
+	for _, line := range strings.Split(event.Data, "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+}
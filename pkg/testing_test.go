@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAssertionEquals(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {"user": {"id": 7, "name": "ada", "roles": ["admin", "dev"]}}}`))
+	}))
+	defer server.Close()
+
+	// Expected values come from JSON, as they do from the web UI
+	expect := func(value string) interface{} {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		return decoded
+	}
+
+	tests := []struct {
+		name     string
+		property string
+		operator string
+		value    interface{}
+		want     bool
+	}{
+		{name: "number", property: "data.user.id", operator: "equals", value: expect(`7`), want: true},
+		{name: "string", property: "data.user.name", operator: "equals", value: "ada", want: true},
+		{name: "object", property: "data.user", operator: "equals", value: expect(`{"name": "ada", "roles": ["admin", "dev"], "id": 7}`), want: true},
+		{name: "different object", property: "data.user", operator: "equals", value: expect(`{"id": 8}`), want: false},
+		{name: "object not equal", property: "data.user", operator: "not_equals", value: expect(`{"id": 8}`), want: true},
+		{name: "array", property: "data.user.roles", operator: "equals", value: expect(`["admin", "dev"]`), want: true},
+		{name: "array in another order", property: "data.user.roles", operator: "equals", value: expect(`["dev", "admin"]`), want: false},
+		{name: "array and string", property: "data.user.roles", operator: "equals", value: "admin,dev", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := NewTestRunner().RunTestCase(TestCase{
+				Name:    test.name,
+				Request: APIRequest{Method: "GET", URL: server.URL},
+				Assertions: []Assertion{{
+					Type:     "graphql",
+					Property: test.property,
+					Operator: test.operator,
+					Value:    test.value,
+					Enabled:  true,
+				}},
+			}, nil)
+			if len(result.Assertions) != 1 {
+				t.Fatalf("%d assertion results, error %q", len(result.Assertions), result.Error)
+			}
+			if got := result.Assertions[0]; got.Result != test.want {
+				t.Fatalf("result %v, want %v: actual %v, expected %v", got.Result, test.want, got.Actual, got.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ResponseTiming breaks the time spent on a request down into phases.
+// Phases that did not happen, such as DNS and TCP on a reused connection,
+// are zero.
+type ResponseTiming struct {
+	Queued           time.Duration `json:"queued"` // held back by the rate limit, not part of Total
+	DNSLookup        time.Duration `json:"dnsLookup"`
+	TCPConnect       time.Duration `json:"tcpConnect"`
+	TLSHandshake     time.Duration `json:"tlsHandshake"`
+	TimeToFirstByte  time.Duration `json:"timeToFirstByte"` // request written to first response byte
+	ContentTransfer  time.Duration `json:"contentTransfer"`
+	Total            time.Duration `json:"total"`
+	ConnectionReused bool          `json:"connectionReused"`
+}
+
+// Phase returns the duration of a phase by its JSON name, as used by test assertions
+func (t ResponseTiming) Phase(name string) (time.Duration, error) {
+	switch name {
+	case "queued":
+		return t.Queued, nil
+	case "dnsLookup":
+		return t.DNSLookup, nil
+	case "tcpConnect":
+		return t.TCPConnect, nil
+	case "tlsHandshake":
+		return t.TLSHandshake, nil
+	case "timeToFirstByte":
+		return t.TimeToFirstByte, nil
+	case "contentTransfer":
+		return t.ContentTransfer, nil
+	case "total":
+		return t.Total, nil
+	default:
+		return 0, fmt.Errorf("unknown timing phase %q", name)
+	}
+}
+
+// timingTracer collects httptrace events for one request, and the order
+// of its response headers. Each redirect hop gets a tracer of its own.
+type timingTracer struct {
+	mutex        sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	tlsDone      bool
+	timing       ResponseTiming
+	capture      *headCapture
+}
+
+func newTimingTracer() *timingTracer {
+	return &timingTracer{start: time.Now()}
+}
+
+// clientTrace returns the hooks to attach to the request context
+func (t *timingTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			// A new hop starts, forget the phases of the previous one
+			t.timing = ResponseTiming{}
+			t.wroteRequest = time.Time{}
+			t.firstByte = time.Time{}
+			t.tlsDone = false
+			t.capture = nil
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.timing.ConnectionReused = info.Reused
+			if recorder, ok := info.Conn.(headerRecorder); ok {
+				t.capture = recorder.startCapture()
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.timing.DNSLookup = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.timing.TCPConnect = time.Since(t.connectStart)
+		},
+		// The transport reports the handshake again after recordingDialTLS
+		// made it, only the first report is timed
+		TLSHandshakeStart: func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			if !t.tlsDone {
+				t.tlsStart = time.Now()
+			}
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			if !t.tlsDone {
+				t.timing.TLSHandshake = time.Since(t.tlsStart)
+				t.tlsDone = true
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.firstByte = time.Now()
+			if !t.wroteRequest.IsZero() {
+				t.timing.TimeToFirstByte = t.firstByte.Sub(t.wroteRequest)
+			}
+		},
+	}
+}
+
+// headers returns the headers of the response to the traced request in the
+// order they were received, see orderHeaders
+func (t *timingTracer) headers(header http.Header) HeaderList {
+	t.mutex.Lock()
+	capture := t.capture
+	t.mutex.Unlock()
+
+	var received []HeaderField
+	if capture != nil {
+		received = capture.fields()
+	}
+	return orderHeaders(header, received)
+}
+
+// finish records the end of the body transfer and returns the breakdown
+func (t *timingTracer) finish() *ResponseTiming {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if !t.firstByte.IsZero() {
+		t.timing.ContentTransfer = now.Sub(t.firstByte)
+	}
+	t.timing.Total = now.Sub(t.start)
+
+	timing := t.timing
+	return &timing
+}
+
+// printTiming prints the timing breakdown of a response for the CLI
+func printTiming(timing *ResponseTiming) {
+	if timing == nil {
+		return
+	}
+
+	fmt.Println("Timing:")
+	if timing.Queued > 0 {
+		fmt.Printf("  %-20s %v\n", "Queued:", timing.Queued)
+	}
+	fmt.Printf("  %-20s %v\n", "DNS Lookup:", timing.DNSLookup)
+	fmt.Printf("  %-20s %v\n", "TCP Connect:", timing.TCPConnect)
+	fmt.Printf("  %-20s %v\n", "TLS Handshake:", timing.TLSHandshake)
+	fmt.Printf("  %-20s %v\n", "Time To First Byte:", timing.TimeToFirstByte)
+	fmt.Printf("  %-20s %v\n", "Content Transfer:", timing.ContentTransfer)
+	fmt.Printf("  %-20s %t\n", "Connection Reused:", timing.ConnectionReused)
+}
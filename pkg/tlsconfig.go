@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSOptions configures the TLS client used for a request or environment.
+// Certificate, key and CA values hold either PEM data or, where the engine
+// allows local access, a path to a PEM file.
+type TLSOptions struct {
+	ClientCert         string `json:"clientCert,omitempty"`
+	ClientKey          string `json:"clientKey,omitempty"`
+	CACert             string `json:"caCert,omitempty"`     // added to the system roots
+	ServerName         string `json:"serverName,omitempty"` // SNI and verification name override
+	MinVersion         string `json:"minVersion,omitempty"` // 1.0, 1.1, 1.2, 1.3
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// TLSInfo describes the TLS connection a response was received on
+type TLSInfo struct {
+	Version            string            `json:"version"`
+	CipherSuite        string            `json:"cipherSuite"`
+	ServerName         string            `json:"serverName"`
+	NegotiatedProtocol string            `json:"negotiatedProtocol,omitempty"`
+	Certificates       []CertificateInfo `json:"certificates"`
+}
+
+// CertificateInfo summarises one certificate of the peer chain
+type CertificateInfo struct {
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	SerialNumber  string    `json:"serialNumber"`
+	DNSNames      []string  `json:"dnsNames,omitempty"`
+	NotBefore     time.Time `json:"notBefore"`
+	NotAfter      time.Time `json:"notAfter"`
+	ExpiresInDays int       `json:"expiresInDays"`
+	IsCA          bool      `json:"isCA"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// buildTLSConfig turns the options into a tls.Config. A nil options value
+// returns nil so the transport uses the Go defaults. PEM files are only read
+// with localFiles set.
+func buildTLSConfig(opts *TLSOptions, localFiles bool) (*tls.Config, error) {
+	if opts == nil {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.MinVersion != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(strings.ToUpper(opts.MinVersion), "TLS")]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %q", opts.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		certPEM, err := readPEM(opts.ClientCert, localFiles)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		keyPEM, err := readPEM(opts.ClientKey, localFiles)
+		if err != nil {
+			return nil, fmt.Errorf("client key: %w", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.CACert != "" {
+		caPEM, err := readPEM(opts.CACert, localFiles)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA bundle: no certificates found")
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// readPEM returns value itself when it holds PEM data, otherwise reads it as
+// a file path when localFiles is set
+func readPEM(value string, localFiles bool) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	if !localFiles {
+		return nil, fmt.Errorf("not PEM data, and files cannot be read here")
+	}
+	return os.ReadFile(value)
+}
+
+// newTLSInfo reports the negotiated parameters and peer chain of a connection
+func newTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		ServerName:         state.ServerName,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+	}
+
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, CertificateInfo{
+			Subject:       cert.Subject.String(),
+			Issuer:        cert.Issuer.String(),
+			SerialNumber:  cert.SerialNumber.String(),
+			DNSNames:      cert.DNSNames,
+			NotBefore:     cert.NotBefore,
+			NotAfter:      cert.NotAfter,
+			ExpiresInDays: int(time.Until(cert.NotAfter).Hours() / 24),
+			IsCA:          cert.IsCA,
+		})
+	}
+
+	return info
+}
+
+// printTLS prints the TLS details of a response for the CLI
+func printTLS(info *TLSInfo) {
+	if info == nil {
+		return
+	}
+
+	fmt.Printf("TLS: %s, %s\n", info.Version, info.CipherSuite)
+	for _, cert := range info.Certificates {
+		fmt.Printf("  %s (expires %s, in %d days)\n",
+			cert.Subject, cert.NotAfter.Format("2006-01-02"), cert.ExpiresInDays)
+	}
+}
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serverCAPEM returns the certificate of a test TLS server as PEM, to trust it
+func serverCAPEM(server *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+}
+
+// newClientCert creates a self-signed client certificate and key as PEM
+func newClientCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "restcli test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestTLSVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	caPEM := serverCAPEM(server)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte(caPEM), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		tls         *TLSOptions
+		localAccess bool
+		wantErr     string
+	}{
+		{name: "untrusted", tls: nil, wantErr: "certificate"},
+		{name: "inline CA", tls: &TLSOptions{CACert: caPEM}},
+		{name: "CA file", tls: &TLSOptions{CACert: caFile}, localAccess: true},
+		{name: "CA file without local access", tls: &TLSOptions{CACert: caFile}, wantErr: "files cannot be read"},
+		{name: "insecure", tls: &TLSOptions{InsecureSkipVerify: true}},
+		{name: "server name", tls: &TLSOptions{CACert: caPEM, ServerName: "example.com"}},
+		{name: "wrong server name", tls: &TLSOptions{CACert: caPEM, ServerName: "wrong.test"}, wantErr: "certificate"},
+		{name: "min version", tls: &TLSOptions{CACert: caPEM, MinVersion: "TLS1.3"}},
+		{name: "unknown version", tls: &TLSOptions{CACert: caPEM, MinVersion: "2.0"}, wantErr: "unsupported TLS version"},
+		{name: "bad CA", tls: &TLSOptions{CACert: "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----"}, wantErr: "no certificates"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := NewRequestEngine()
+			engine.SetLocalAccess(test.localAccess)
+			response := engine.Execute(context.Background(), APIRequest{
+				Method:  "GET",
+				URL:     server.URL,
+				Options: RequestOptions{TLS: test.tls},
+			})
+			if test.wantErr != "" {
+				if !strings.Contains(response.Error, test.wantErr) {
+					t.Fatalf("error = %q, want it to contain %q", response.Error, test.wantErr)
+				}
+				return
+			}
+			if response.Error != "" || response.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, error %q", response.StatusCode, response.Error)
+			}
+			if response.TLS == nil || len(response.TLS.Certificates) == 0 {
+				t.Fatalf("no TLS info: %+v", response.TLS)
+			}
+		})
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	caPEM := serverCAPEM(server)
+	certPEM, keyPEM := newClientCert(t)
+
+	tests := []struct {
+		name    string
+		tls     *TLSOptions
+		wantErr string
+	}{
+		{name: "no certificate", tls: &TLSOptions{CACert: caPEM}, wantErr: "certificate"},
+		{name: "certificate", tls: &TLSOptions{CACert: caPEM, ClientCert: certPEM, ClientKey: keyPEM}},
+		{name: "missing key", tls: &TLSOptions{CACert: caPEM, ClientCert: certPEM}, wantErr: "client key"},
+		{name: "key path", tls: &TLSOptions{CACert: caPEM, ClientCert: certPEM, ClientKey: "/etc/ssl/private/key.pem"}, wantErr: "files cannot be read"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := NewRequestEngine().Execute(context.Background(), APIRequest{
+				Method:  "GET",
+				URL:     server.URL,
+				Options: RequestOptions{TLS: test.tls},
+			})
+			if test.wantErr != "" {
+				if !strings.Contains(response.Error, test.wantErr) {
+					t.Fatalf("error = %q, want it to contain %q", response.Error, test.wantErr)
+				}
+				return
+			}
+			if response.Error != "" || response.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, error %q", response.StatusCode, response.Error)
+			}
+			if response.Body != "restcli test client" {
+				t.Fatalf("body = %q", response.Body)
+			}
+		})
+	}
+}
@@ -1,35 +1,285 @@
 package pkg
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
 	"time"
 )
 
 // APIResponse represents the structured response from an API call
 type APIResponse struct {
-	StatusCode   int               `json:"statusCode"`
-	Status       string            `json:"status"`
-	Headers      map[string]string `json:"headers"`
-	Body         string            `json:"body"`
-	ResponseTime time.Duration     `json:"responseTime"`
-	Error        string            `json:"error,omitempty"`
+	StatusCode      int                 `json:"statusCode"`
+	Status          string              `json:"status"`
+	Protocol        string              `json:"protocol,omitempty"` // HTTP/1.1 or HTTP/2
+	Headers         map[string]string   `json:"headers"`
+	RawHeaders      HeaderList          `json:"rawHeaders"`
+	Body            string              `json:"body"`
+	BodyEncoding    string              `json:"bodyEncoding,omitempty"` // base64 for binary bodies
+	ContentType     string              `json:"contentType,omitempty"`
+	IsBinary        bool                `json:"isBinary"`
+	BodySize        int64               `json:"bodySize"`                  // decoded size
+	WireSize        int64               `json:"wireSize"`                  // size as received, before decoding
+	ContentEncoding string              `json:"contentEncoding,omitempty"` // codings removed from the body
+	BodyTruncated   bool                `json:"bodyTruncated,omitempty"`   // Body holds only the first MaxBodySize bytes
+	BodyFile        string              `json:"bodyFile,omitempty"`        // file holding the complete body
+	ResponseTime    time.Duration       `json:"responseTime"`
+	Timing          *ResponseTiming     `json:"timing,omitempty"`
+	TLS             *TLSInfo            `json:"tls,omitempty"`
+	Redirects       []RedirectHop       `json:"redirects,omitempty"`     // hops followed before this response
+	Attempts        []RetryAttempt      `json:"attempts,omitempty"`      // set when a retry policy applied
+	CacheStatus     string              `json:"cacheStatus,omitempty"`   // hit, revalidated or miss when a cache mode is set
+	Events          []SSEEvent          `json:"events,omitempty"`        // received with RequestOptions.EventStream
+	Messages        []WebSocketLogEntry `json:"messages,omitempty"`      // log of a WebSocket session or gRPC call
+	GraphQLErrors   []GraphQLError      `json:"graphqlErrors,omitempty"` // errors of a GraphQL response or failed validation
+	GRPCStatus      *GRPCStatus         `json:"grpcStatus,omitempty"`    // status of a gRPC call
+	JSONRPC         []JSONRPCResponse   `json:"jsonrpc,omitempty"`       // answers to JSON-RPC calls, in call order
+	SOAPFault       *SOAPFault          `json:"soapFault,omitempty"`
+	Trailers        HeaderList          `json:"trailers,omitempty"` // trailing metadata of a gRPC call
+	Error           string              `json:"error,omitempty"`
 }
 
 // APIRequest represents the request parameters
 type APIRequest struct {
-	Method  string            `json:"method"`
-	URL     string            `json:"url"`
-	Headers map[string]string `json:"headers"`
-	Body    string            `json:"body"`
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	QueryParams []QueryParam      `json:"queryParams,omitempty"` // appended to URL when sent
+	Headers     map[string]string `json:"headers"`
+	RawHeaders  HeaderList        `json:"rawHeaders,omitempty"` // ordered, may repeat names
+	Body        string            `json:"body"`
+	BodyType    string            `json:"bodyType,omitempty"` // raw (default), form-data, urlencoded
+	Form        []FormField       `json:"form,omitempty"`     // fields for form-data and urlencoded bodies
+	GraphQL     *GraphQLRequest   `json:"graphql,omitempty"`  // builds the body from a GraphQL operation
+	GRPC        *GRPCRequest      `json:"grpc,omitempty"`     // makes a gRPC call instead of an HTTP request
+	JSONRPC     *JSONRPCRequest   `json:"jsonrpc,omitempty"`  // builds the body from JSON-RPC calls
+	SOAP        *SOAPRequest      `json:"soap,omitempty"`     // builds the body as a SOAP envelope
+	Auth        *RequestAuth      `json:"auth,omitempty"`     // applied when sent, nil sends no auth
+	Options     RequestOptions    `json:"options"`
 }
 
-// convertHeaders converts http.Header to map[string]string
+// HeaderField is a single header line
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HeaderList is an ordered list of header fields in which a name may appear
+// more than once. It marshals to a JSON array of {name, value} objects and
+// also accepts the older {"Name": "value"} and {"Name": ["v1", "v2"]} shapes.
+type HeaderList []HeaderField
+
+// HeaderFields returns every header to send: the ordered RawHeaders first,
+// followed by entries of the Headers map whose names are not already present.
+func (r APIRequest) HeaderFields() HeaderList {
+	fields := make(HeaderList, 0, len(r.RawHeaders)+len(r.Headers))
+	fields = append(fields, r.RawHeaders...)
+
+	keys := make([]string, 0, len(r.Headers))
+	for key := range r.Headers {
+		if !r.RawHeaders.Has(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fields = append(fields, HeaderField{Name: key, Value: r.Headers[key]})
+	}
+	return fields
+}
+
+// Has reports whether a header with the given name is present
+func (l HeaderList) Has(name string) bool {
+	for _, field := range l {
+		if strings.EqualFold(field.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the first value for name, or an empty string
+func (l HeaderList) Get(name string) string {
+	for _, field := range l {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Values returns all values for name in order
+func (l HeaderList) Values(name string) []string {
+	var values []string
+	for _, field := range l {
+		if strings.EqualFold(field.Name, name) {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
+
+// group returns the values of each canonical name and the names in the
+// order they first appear
+func (l HeaderList) group() (map[string][]string, []string) {
+	grouped := make(map[string][]string)
+	var order []string
+	for _, field := range l {
+		key := textproto.CanonicalMIMEHeaderKey(field.Name)
+		if _, exists := grouped[key]; !exists {
+			order = append(order, key)
+		}
+		grouped[key] = append(grouped[key], field.Value)
+	}
+	return grouped, order
+}
+
+// Map collapses the list into the single-value map shape, see joinHeaderValues
+func (l HeaderList) Map() map[string]string {
+	grouped, order := l.group()
+	result := make(map[string]string, len(order))
+	for _, key := range order {
+		result[key] = joinHeaderValues(key, grouped[key])
+	}
+	return result
+}
+
+// ObjectJSON encodes the list in the {"Name": "value"} shape history rows
+// have always been stored in, names in order of first appearance. A
+// repeated name gets an array of its values, which UnmarshalJSON reads back.
+func (l HeaderList) ObjectJSON() string {
+	grouped, order := l.group()
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, key := range order {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		var value []byte
+		if values := grouped[key]; len(values) == 1 {
+			value, _ = json.Marshal(values[0])
+		} else {
+			value, _ = json.Marshal(values)
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.String()
+}
+
+// UnmarshalJSON accepts either the list shape or the legacy object shape
+func (l *HeaderList) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		*l = nil
+		return nil
+	}
+
+	if data[0] == '[' {
+		var fields []HeaderField
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		*l = fields
+		return nil
+	}
+
+	// Walk the object token by token so the key order is kept
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	var fields HeaderList
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("invalid header name %v", token)
+		}
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fmt.Errorf("invalid value for header %q", name)
+			}
+			values = []string{value}
+		}
+
+		for _, value := range values {
+			fields = append(fields, HeaderField{Name: name, Value: value})
+		}
+	}
+
+	*l = fields
+	return nil
+}
+
+// ParseHeaderList decodes headers stored as a JSON string, in either shape
+func ParseHeaderList(data string) (HeaderList, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var headers HeaderList
+	if err := json.Unmarshal([]byte(data), &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// convertHeaders converts http.Header to map[string]string, joining repeated values
 func convertHeaders(headers http.Header) map[string]string {
 	result := make(map[string]string)
 	for key, values := range headers {
 		if len(values) > 0 {
-			result[key] = values[0] // Take the first value if multiple exist
+			result[key] = joinHeaderValues(key, values)
 		}
 	}
 	return result
-}
\ No newline at end of file
+}
+
+// convertHeaderList converts http.Header to a HeaderList, sorted by name with
+// the values of each name kept in the order they were received. Responses
+// sent by the engine keep the order of every field, see orderHeaders.
+func convertHeaderList(headers http.Header) HeaderList {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result HeaderList
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			result = append(result, HeaderField{Name: key, Value: value})
+		}
+	}
+	return result
+}
+
+// joinHeaderValues combines repeated header values into one string. Values are
+// comma separated as RFC 9110 allows, except Set-Cookie whose values may
+// themselves contain commas and are therefore separated by newlines.
+func joinHeaderValues(name string, values []string) string {
+	if strings.EqualFold(name, "Set-Cookie") {
+		return strings.Join(values, "\n")
+	}
+	return strings.Join(values, ", ")
+}
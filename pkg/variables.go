@@ -12,6 +12,7 @@ type VariableResolver struct {
 	environments map[string]*Environment
 	collections  map[string]*Collection
 	activeEnv    string
+	tokens       *OAuth2TokenCache
 }
 
 // NewVariableResolver creates a new variable resolver
@@ -19,14 +20,46 @@ func NewVariableResolver() *VariableResolver {
 	return &VariableResolver{
 		environments: make(map[string]*Environment),
 		collections:  make(map[string]*Collection),
+		tokens:       DefaultEngine().OAuth2Tokens(),
 	}
 }
 
+// UseOAuth2Tokens sets the cache whose access tokens are variables, the
+// default engine's by default
+func (vr *VariableResolver) UseOAuth2Tokens(tokens *OAuth2TokenCache) {
+	vr.tokens = tokens
+}
+
+// WithOAuth2Tokens returns a resolver that shares the environments and
+// collections of vr but takes OAuth2 token variables from tokens
+func (vr *VariableResolver) WithOAuth2Tokens(tokens *OAuth2TokenCache) *VariableResolver {
+	resolver := *vr
+	resolver.tokens = tokens
+	return &resolver
+}
+
+// tokenVariable returns an OAuth2 access token obtained in the active environment
+func (vr *VariableResolver) tokenVariable(varName string) (string, bool) {
+	if vr.tokens == nil {
+		return "", false
+	}
+	value, found := vr.tokens.Variables(vr.activeEnv)[varName]
+	return value, found
+}
+
 // SetActiveEnvironment sets the active environment
 func (vr *VariableResolver) SetActiveEnvironment(envID string) {
 	vr.activeEnv = envID
 }
 
+// ActiveEnvironment returns the active environment, or nil if none is set
+func (vr *VariableResolver) ActiveEnvironment() *Environment {
+	if vr.activeEnv == "" {
+		return nil
+	}
+	return vr.environments[vr.activeEnv]
+}
+
 // AddEnvironment adds an environment
 func (vr *VariableResolver) AddEnvironment(env *Environment) {
 	vr.environments[env.ID] = env
@@ -56,6 +89,11 @@ func (vr *VariableResolver) ResolveVariables(input string, collectionID string)
 			}
 		}
 		
+		// Then the OAuth2 tokens obtained in it
+		if value, found := vr.tokenVariable(varName); found {
+			return value
+		}
+		
 		// Look in collection variables
 		if collectionID != "" {
 			if collection, exists := vr.collections[collectionID]; exists {
@@ -75,6 +113,73 @@ func (vr *VariableResolver) ResolveVariables(input string, collectionID string)
 	})
 }
 
+// ResolveRequest resolves variables in every part of a request. Query params
+// are resolved before they are encoded, so their values are escaped properly.
+func (vr *VariableResolver) ResolveRequest(request APIRequest, collectionID string) APIRequest {
+	request.URL = vr.ResolveVariables(request.URL, collectionID)
+	request.Body = vr.ResolveVariables(request.Body, collectionID)
+
+	headers := make(map[string]string, len(request.Headers))
+	for key, value := range request.Headers {
+		headers[key] = vr.ResolveVariables(value, collectionID)
+	}
+	request.Headers = headers
+
+	rawHeaders := make(HeaderList, len(request.RawHeaders))
+	for i, field := range request.RawHeaders {
+		rawHeaders[i] = HeaderField{Name: field.Name, Value: vr.ResolveVariables(field.Value, collectionID)}
+	}
+	request.RawHeaders = rawHeaders
+
+	form := make([]FormField, len(request.Form))
+	for i, field := range request.Form {
+		field.Value = vr.ResolveVariables(field.Value, collectionID)
+		form[i] = field
+	}
+	request.Form = form
+
+	params := make([]QueryParam, len(request.QueryParams))
+	for i, param := range request.QueryParams {
+		param.Name = vr.ResolveVariables(param.Name, collectionID)
+		param.Value = vr.ResolveVariables(param.Value, collectionID)
+		params[i] = param
+	}
+	request.QueryParams = params
+
+	request.GraphQL = request.GraphQL.substitute(func(s string) string {
+		return vr.ResolveVariables(s, collectionID)
+	})
+	request.GRPC = request.GRPC.substitute(func(s string) string {
+		return vr.ResolveVariables(s, collectionID)
+	})
+	request.JSONRPC = request.JSONRPC.substitute(func(s string) string {
+		return vr.ResolveVariables(s, collectionID)
+	})
+	request.SOAP = request.SOAP.substitute(func(s string) string {
+		return vr.ResolveVariables(s, collectionID)
+	})
+	request.Auth = request.Auth.substitute(func(s string) string {
+		return vr.ResolveVariables(s, collectionID)
+	})
+	if request.Auth != nil && request.Auth.AWS != nil {
+		// AWS credentials left empty come from the variables of the same names
+		request.Auth.AWS.fill(func(name string) string {
+			return vr.variable(name, collectionID)
+		})
+	}
+
+	return request
+}
+
+// variable returns the value of a variable, or an empty string if it is not set
+func (vr *VariableResolver) variable(name, collectionID string) string {
+	placeholder := "{{" + name + "}}"
+	if value := vr.ResolveVariables(placeholder, collectionID); value != placeholder {
+		return value
+	}
+	return ""
+}
+
 // getBuiltInVariable returns built-in dynamic variables
 func (vr *VariableResolver) getBuiltInVariable(varName string) string {
 	now := time.Now()
@@ -135,6 +240,11 @@ func (vr *VariableResolver) ValidateVariables(input string, collectionID string)
 			}
 		}
 		
+		// Check OAuth2 tokens
+		if _, found = vr.tokenVariable(varName); found {
+			continue
+		}
+		
 		// Check collection variables
 		if collectionID != "" {
 			if collection, exists := vr.collections[collectionID]; exists {
@@ -0,0 +1,535 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket message types for WebSocketMessage and WebSocketLogEntry
+const (
+	WebSocketText   = "text"
+	WebSocketBinary = "binary" // Data holds the payload in base64
+	WebSocketJSON   = "json"   // Data must be valid JSON, sent as a text message
+	WebSocketClose  = "close"  // log only, Data holds the close code and reason
+)
+
+// DefaultWebSocketIdle is how long a scripted session waits for a message
+// before it is considered finished
+const DefaultWebSocketIdle = time.Second
+
+// WebSocketMessage is a message to send on a WebSocket
+type WebSocketMessage struct {
+	Type  string `json:"type,omitempty"` // text (default), binary or json
+	Data  string `json:"data"`
+	Await int    `json:"await,omitempty"` // messages to receive before sending the next one
+}
+
+// WebSocketLogEntry is a message sent or received during a session
+type WebSocketLogEntry struct {
+	Direction string    `json:"direction"` // sent or received
+	Type      string    `json:"type"`      // text, binary or close
+	Data      string    `json:"data"`
+	Time      time.Time `json:"time"`
+}
+
+// WebSocketOptions turns a request into a scripted WebSocket session: the
+// connection is opened with the request's URL and headers, Messages are sent
+// in order and the session closes once MaxMessages have been received or
+// nothing arrives for IdleTimeout. The log ends up in APIResponse.Messages.
+type WebSocketOptions struct {
+	Subprotocols []string           `json:"subprotocols,omitempty"`
+	Messages     []WebSocketMessage `json:"messages,omitempty"`
+	MaxMessages  int                `json:"maxMessages,omitempty"` // 0 waits for IdleTimeout
+	IdleTimeout  time.Duration      `json:"idleTimeout,omitempty"` // defaults to DefaultWebSocketIdle
+
+	OnMessage func(WebSocketLogEntry) `json:"-"` // called for each message sent or received
+}
+
+// WebSocketSession is an open WebSocket connection that keeps a log of
+// every message. Messages are read in the background until the connection
+// closes.
+type WebSocketSession struct {
+	conn      *websocket.Conn
+	onMessage func(WebSocketLogEntry)
+
+	mutex    sync.Mutex
+	writer   sync.Mutex
+	log      []WebSocketLogEntry
+	received int
+	arrived  chan struct{} // signalled when a message is received
+	done     chan struct{} // closed when the connection is gone
+	closing  bool
+	err      error
+}
+
+// isWebSocketURL reports whether a URL uses the ws or wss scheme
+func isWebSocketURL(rawURL string) bool {
+	lower := strings.ToLower(rawURL)
+	return strings.HasPrefix(lower, "ws://") || strings.HasPrefix(lower, "wss://")
+}
+
+// OpenWebSocket connects to the WebSocket at the request's URL, which may
+// use the ws, wss, http or https scheme. The response describes the
+// handshake; the session is nil when the handshake failed.
+func (e *RequestEngine) OpenWebSocket(ctx context.Context, request APIRequest) (*WebSocketSession, APIResponse) {
+	opts := request.Options
+	e.mutex.Lock()
+	if opts.Proxy == nil {
+		opts.Proxy = e.proxy
+	}
+	if opts.UnixSocket == "" {
+		opts.UnixSocket = e.unixSocket
+	}
+	opts.Resolve = mergeResolve(e.resolve, opts.Resolve)
+	e.mutex.Unlock()
+
+	return e.openWebSocket(ctx, request, opts)
+}
+
+func (e *RequestEngine) openWebSocket(ctx context.Context, request APIRequest, opts RequestOptions) (*WebSocketSession, APIResponse) {
+	start := time.Now()
+	failed := func(err error) (*WebSocketSession, APIResponse) {
+		return nil, APIResponse{Error: err.Error(), ResponseTime: time.Since(start)}
+	}
+
+	target := request.FullURL()
+	if socket, httpURL, ok := splitUnixURL(target); ok {
+		if !e.localAccess.Load() {
+			return failed(errUnixSocketDenied)
+		}
+		target, opts.UnixSocket = httpURL, socket
+	}
+	switch {
+	case strings.HasPrefix(strings.ToLower(target), "http://"):
+		target = "ws://" + target[len("http://"):]
+	case strings.HasPrefix(strings.ToLower(target), "https://"):
+		target = "wss://" + target[len("https://"):]
+	}
+
+	tlsConfig, err := buildTLSConfig(opts.TLS, e.localAccess.Load())
+	if err != nil {
+		return failed(err)
+	}
+	proxy, err := proxyFunc(opts.Proxy)
+	if err != nil {
+		return failed(err)
+	}
+	if opts.UnixSocket != "" {
+		proxy = nil
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	var subprotocols []string
+	if opts.WebSocket != nil {
+		subprotocols = opts.WebSocket.Subprotocols
+	}
+	dialer := &websocket.Dialer{
+		NetDialContext:   dialFunc(&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}, opts.UnixSocket, opts.Resolve),
+		Proxy:            proxy,
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: timeout,
+		Subprotocols:     subprotocols,
+	}
+	if opts.Cookies != nil && !opts.DisableCookies {
+		dialer.Jar = opts.Cookies
+	}
+
+	header := http.Header{}
+	for _, field := range request.HeaderFields() {
+		header.Add(field.Name, field.Value)
+	}
+
+	// The handshake counts against the rate limit, the open session does not
+	limitKey := ""
+	if u, err := url.Parse(target); err == nil {
+		limitKey = u.Host
+	}
+	if opts.UnixSocket != "" {
+		limitKey = unixURLPrefix + opts.UnixSocket
+	}
+	queued, release, err := e.limiter.acquire(ctx, opts.RateLimitScope, limitKey)
+	if err != nil {
+		return nil, APIResponse{
+			Error:        "Waiting for rate limit: " + err.Error(),
+			Timing:       &ResponseTiming{Queued: queued},
+			ResponseTime: time.Since(start),
+		}
+	}
+	start = time.Now()
+	conn, resp, err := dialer.DialContext(ctx, target, header)
+	release()
+
+	response := APIResponse{Timing: &ResponseTiming{Queued: queued}}
+	if resp != nil {
+		response.StatusCode = resp.StatusCode
+		response.Status = resp.Status
+		response.Protocol = protocolName(resp)
+		response.Headers = convertHeaders(resp.Header)
+		response.RawHeaders = convertHeaderList(resp.Header)
+		response.ContentType = resp.Header.Get("Content-Type")
+	}
+	if err != nil {
+		if resp != nil && resp.Body != nil {
+			// A refused handshake usually explains itself in the body
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+			response.Body = string(body)
+			response.BodySize = int64(len(body))
+		}
+		response.Error = "WebSocket handshake failed: " + err.Error()
+		response.ResponseTime = time.Since(start)
+		return nil, response
+	}
+
+	if tlsConn, ok := conn.UnderlyingConn().(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		response.TLS = newTLSInfo(&state)
+	}
+	response.ResponseTime = time.Since(start)
+
+	session := &WebSocketSession{
+		conn:    conn,
+		arrived: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if opts.WebSocket != nil {
+		session.onMessage = opts.WebSocket.OnMessage
+	}
+	conn.SetCloseHandler(session.closed)
+	go session.read()
+	return session, response
+}
+
+// read logs incoming messages until the connection closes
+func (s *WebSocketSession) read() {
+	defer close(s.done)
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			// A close frame was logged by closed
+			if _, ok := err.(*websocket.CloseError); !ok {
+				s.mutex.Lock()
+				if !s.closing {
+					s.err = err
+				}
+				s.mutex.Unlock()
+			}
+			return
+		}
+
+		entry := WebSocketLogEntry{Type: WebSocketText, Data: string(data)}
+		if messageType == websocket.BinaryMessage {
+			entry = WebSocketLogEntry{Type: WebSocketBinary, Data: base64.StdEncoding.EncodeToString(data)}
+		}
+		s.record("received", entry.Type, entry.Data)
+
+		select {
+		case s.arrived <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// closed logs a close frame from the server and answers it, unless the
+// session already sent its own
+func (s *WebSocketSession) closed(code int, text string) error {
+	s.record("received", WebSocketClose, closeText(code, text))
+
+	s.writer.Lock()
+	defer s.writer.Unlock()
+	err := s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+	if err != nil && err != websocket.ErrCloseSent {
+		return err
+	}
+	return nil
+}
+
+// record adds an entry to the log and reports it to the OnMessage callback
+func (s *WebSocketSession) record(direction, messageType, data string) {
+	entry := WebSocketLogEntry{Direction: direction, Type: messageType, Data: data, Time: time.Now()}
+	s.mutex.Lock()
+	s.log = append(s.log, entry)
+	if direction == "received" && messageType != WebSocketClose {
+		s.received++
+	}
+	s.mutex.Unlock()
+
+	if s.onMessage != nil {
+		s.onMessage(entry)
+	}
+}
+
+// Subprotocol returns the subprotocol the server selected
+func (s *WebSocketSession) Subprotocol() string {
+	return s.conn.Subprotocol()
+}
+
+// Send sends a message, see WebSocketMessage for the types
+func (s *WebSocketSession) Send(message WebSocketMessage) error {
+	messageType := websocket.TextMessage
+	data := []byte(message.Data)
+	logType, logData := WebSocketText, message.Data
+
+	switch message.Type {
+	case "", WebSocketText:
+	case WebSocketJSON:
+		if !json.Valid(data) {
+			return fmt.Errorf("message is not valid JSON")
+		}
+	case WebSocketBinary:
+		decoded, err := base64.StdEncoding.DecodeString(message.Data)
+		if err != nil {
+			return fmt.Errorf("binary message is not valid base64: %v", err)
+		}
+		messageType, data = websocket.BinaryMessage, decoded
+		logType = WebSocketBinary
+	default:
+		return fmt.Errorf("unknown message type %q, expected text, binary or json", message.Type)
+	}
+
+	s.writer.Lock()
+	defer s.writer.Unlock()
+	if err := s.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	s.record("sent", logType, logData)
+	return nil
+}
+
+// Log returns the messages sent and received so far
+func (s *WebSocketSession) Log() []WebSocketLogEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]WebSocketLogEntry(nil), s.log...)
+}
+
+// Received returns the number of messages received so far
+func (s *WebSocketSession) Received() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.received
+}
+
+// Done is closed when the connection has closed
+func (s *WebSocketSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that ended the connection, if it did not close cleanly
+func (s *WebSocketSession) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// WaitFor waits until count messages have been received in total. It
+// returns false when idle passes without a message, the connection closes
+// or ctx is cancelled first.
+func (s *WebSocketSession) WaitFor(ctx context.Context, count int, idle time.Duration) bool {
+	for {
+		if s.Received() >= count {
+			return true
+		}
+
+		timer := time.NewTimer(idle)
+		select {
+		case <-s.arrived:
+			timer.Stop()
+		case <-timer.C:
+			return false
+		case <-s.done:
+			timer.Stop()
+			return s.Received() >= count
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// Close sends a normal closure and waits briefly for the server to answer
+// it before dropping the connection
+func (s *WebSocketSession) Close() error {
+	s.mutex.Lock()
+	s.closing = true
+	s.mutex.Unlock()
+
+	// The writer lock keeps the reply from being logged before the close
+	s.writer.Lock()
+	err := s.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	if err == nil {
+		s.record("sent", WebSocketClose, closeText(websocket.CloseNormalClosure, ""))
+	}
+	s.writer.Unlock()
+	if err == nil {
+		select {
+		case <-s.done:
+		case <-time.After(time.Second):
+		}
+	}
+	closeErr := s.conn.Close()
+	<-s.done
+	return closeErr
+}
+
+// closeText formats a close frame for the log
+func closeText(code int, reason string) string {
+	if reason == "" {
+		return strconv.Itoa(code)
+	}
+	return strconv.Itoa(code) + " " + reason
+}
+
+// webSocket runs a scripted session for Execute
+func (e *RequestEngine) webSocket(ctx context.Context, request APIRequest, opts RequestOptions) APIResponse {
+	start := time.Now()
+	if opts.WebSocket == nil {
+		opts.WebSocket = &WebSocketOptions{}
+	}
+	script := opts.WebSocket
+	idle := script.IdleTimeout
+	if idle <= 0 {
+		idle = DefaultWebSocketIdle
+	}
+
+	// A request timeout bounds the whole session, not just the handshake
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	session, response := e.openWebSocket(ctx, request, opts)
+	if session == nil {
+		return response
+	}
+
+	for i, message := range script.Messages {
+		if err := session.Send(message); err != nil {
+			response.Error = fmt.Sprintf("Sending message %d: %v", i+1, err)
+			break
+		}
+		if message.Await > 0 && !session.WaitFor(ctx, session.Received()+message.Await, idle) {
+			break
+		}
+	}
+
+	if response.Error == "" {
+		if script.MaxMessages > 0 {
+			session.WaitFor(ctx, script.MaxMessages, idle)
+		} else {
+			// Wait until the server goes quiet
+			for session.WaitFor(ctx, session.Received()+1, idle) {
+			}
+		}
+	}
+
+	session.Close()
+	if err := session.Err(); err != nil && response.Error == "" && ctx.Err() == nil {
+		response.Error = "WebSocket connection failed: " + err.Error()
+	}
+
+	response.Messages = session.Log()
+	response.ResponseTime = time.Since(start)
+	return response
+}
+
+// messageProperty looks up a value of the received messages for an
+// assertion. Property is "count" or "<index>.<field>" with field one of
+// type, data or json.<path>, a dot separated path into a JSON message; a
+// negative index counts from the last message.
+func messageProperty(log []WebSocketLogEntry, property string) (interface{}, error) {
+	var received []WebSocketLogEntry
+	for _, entry := range log {
+		if entry.Direction == "received" && entry.Type != WebSocketClose {
+			received = append(received, entry)
+		}
+	}
+
+	if property == "count" {
+		return len(received), nil
+	}
+
+	indexText, field, found := strings.Cut(property, ".")
+	if !found {
+		return nil, fmt.Errorf("invalid message property %q", property)
+	}
+	index, err := strconv.Atoi(indexText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message index %q", indexText)
+	}
+	if index < 0 {
+		index += len(received)
+	}
+	if index < 0 || index >= len(received) {
+		return nil, fmt.Errorf("message %s not received, got %d messages", indexText, len(received))
+	}
+
+	message := received[index]
+	switch {
+	case field == "type":
+		return message.Type, nil
+	case field == "data":
+		return message.Data, nil
+	case field == "json" || strings.HasPrefix(field, "json."):
+		var value interface{}
+		if err := json.Unmarshal([]byte(message.Data), &value); err != nil {
+			return nil, fmt.Errorf("message %s is not JSON", indexText)
+		}
+		return jsonValue(value, strings.TrimPrefix(strings.TrimPrefix(field, "json"), "."))
+	default:
+		return nil, fmt.Errorf("unknown message field %q", field)
+	}
+}
+
+// jsonValue follows a dot separated path of object keys and array indexes
+func jsonValue(value interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return value, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, exists := node[key]
+			if !exists {
+				return nil, fmt.Errorf("%q not found", key)
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("index %q out of range", key)
+			}
+			value = node[i]
+		default:
+			return nil, fmt.Errorf("%q not found", key)
+		}
+	}
+	return value, nil
+}
+
+// printWebSocketEntry prints a log entry as it happens for the CLI
+func printWebSocketEntry(entry WebSocketLogEntry) {
+	arrow := "<<"
+	if entry.Direction == "sent" {
+		arrow = ">>"
+	}
+	fmt.Printf("[%s] %s %s: %s\n", entry.Time.Format("15:04:05.000"), arrow, entry.Type, entry.Data)
+}
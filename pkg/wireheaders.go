@@ -0,0 +1,232 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxHeadCapture bounds the bytes kept while looking for the end of a
+// response head, like the transport's own header limit
+const maxHeadCapture = 1 << 20
+
+// headCapture collects the bytes of one HTTP/1.x response head as the
+// transport reads them. Informational 1xx heads before it are skipped.
+type headCapture struct {
+	mutex  sync.Mutex
+	buffer []byte
+	head   []byte // final head without its terminating blank line, once read
+	done   bool
+}
+
+func (c *headCapture) write(data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.done {
+		return
+	}
+	c.buffer = append(c.buffer, data...)
+	for {
+		end := bytes.Index(c.buffer, []byte("\r\n\r\n"))
+		if end < 0 {
+			if len(c.buffer) > maxHeadCapture {
+				c.done = true
+			}
+			return
+		}
+		head := c.buffer[:end]
+		if isInformationalHead(head) {
+			c.buffer = c.buffer[end+4:]
+			continue
+		}
+		c.head, c.buffer, c.done = head, nil, true
+		return
+	}
+}
+
+// isInformationalHead reports a 1xx head other than 101 Switching Protocols,
+// which is followed by the final response
+func isInformationalHead(head []byte) bool {
+	line, _, _ := bytes.Cut(head, []byte("\r\n"))
+	_, status, _ := bytes.Cut(line, []byte(" "))
+	return len(status) >= 3 && status[0] == '1' && !bytes.HasPrefix(status, []byte("101"))
+}
+
+// fields returns the header fields of the captured head in the order they
+// were received, or nil when no complete head was captured
+func (c *headCapture) fields() []HeaderField {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.head == nil {
+		return nil
+	}
+
+	lines := strings.Split(string(c.head), "\r\n")
+	var fields []HeaderField
+	for _, line := range lines[1:] {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(fields) > 0 {
+			// obs-fold continues the previous field
+			fields[len(fields)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		fields = append(fields, HeaderField{
+			Name:  textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name)),
+			Value: strings.TrimSpace(value),
+		})
+	}
+	return fields
+}
+
+// recordingConn hands the bytes read from a connection to the capture of
+// the request being sent on it
+type recordingConn struct {
+	net.Conn
+	mutex   sync.Mutex
+	capture *headCapture
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mutex.Lock()
+		capture := c.capture
+		c.mutex.Unlock()
+		if capture != nil {
+			capture.write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// startCapture starts recording the head of the next response. HTTP/1.x
+// sends one request at a time on a connection, so the next response read
+// belongs to the request that just got it.
+func (c *recordingConn) startCapture() *headCapture {
+	capture := &headCapture{}
+	c.mutex.Lock()
+	c.capture = capture
+	c.mutex.Unlock()
+	return capture
+}
+
+// recordingTLSConn is a TLS connection that records response heads, used
+// when HTTP/1.1 was negotiated. The transport still sees its TLS state.
+type recordingTLSConn struct {
+	recordingConn
+	tls *tls.Conn
+}
+
+func (c *recordingTLSConn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
+
+func (c *recordingTLSConn) HandshakeContext(ctx context.Context) error {
+	return c.tls.HandshakeContext(ctx)
+}
+
+// headerRecorder is a connection whose response heads can be captured
+type headerRecorder interface {
+	startCapture() *headCapture
+}
+
+// recordingDial wraps the connections of dial so their response heads can
+// be captured
+func recordingDial(dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &recordingConn{Conn: conn}, nil
+	}
+}
+
+// recordingDialTLS makes the TLS connections of a transport itself, so that
+// the heads of HTTP/1.1 responses can be read above TLS. Connections that
+// negotiate HTTP/2 are returned as they are, HPACK leaves nothing to record.
+func recordingDialTLS(transport *http.Transport, dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		raw, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		config := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			config.ServerName = host
+		}
+		conn := tls.Client(raw, config)
+
+		handshakeCtx := ctx
+		if transport.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			handshakeCtx, cancel = context.WithTimeout(ctx, transport.TLSHandshakeTimeout)
+			defer cancel()
+		}
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err = conn.HandshakeContext(handshakeCtx)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(conn.ConnectionState(), err)
+		}
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+
+		if conn.ConnectionState().NegotiatedProtocol == "h2" {
+			return conn, nil
+		}
+		return &recordingTLSConn{recordingConn: recordingConn{Conn: conn}, tls: conn}, nil
+	}
+}
+
+// orderHeaders lists the headers of a response in the order they were
+// received. Values come from header, which the transport has cleaned up;
+// fields it added or that were not captured, such as every header of an
+// HTTP/2 response, follow sorted by name.
+func orderHeaders(header http.Header, received []HeaderField) HeaderList {
+	used := make(map[string]int, len(header))
+	var result HeaderList
+	for _, field := range received {
+		values := header[field.Name]
+		if i := used[field.Name]; i < len(values) {
+			result = append(result, HeaderField{Name: field.Name, Value: values[i]})
+			used[field.Name] = i + 1
+		}
+	}
+
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		if used[key] < len(header[key]) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key][used[key]:] {
+			result = append(result, HeaderField{Name: key, Value: value})
+		}
+	}
+	return result
+}
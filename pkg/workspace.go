@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 )
@@ -285,4 +286,75 @@ func (ws *WorkspaceService) UpdateWorkspace(workspaceID uint, userID uint, updat
 	}
 
 	return DB.Model(&Workspace{}).Where("id = ?", workspaceID).Updates(updates).Error
-}
\ No newline at end of file
+}
+
+// GetRateLimit returns the rate limit of a workspace, nil when it uses the global limit
+func (ws *WorkspaceService) GetRateLimit(workspaceID uint, userID uint) (*RateLimit, error) {
+	if !ws.HasWorkspaceAccess(userID, workspaceID) {
+		return nil, errors.New("access denied")
+	}
+
+	var workspace WorkspaceDB
+	if err := DB.First(&workspace, workspaceID).Error; err != nil {
+		return nil, err
+	}
+	if workspace.RateLimit == "" {
+		return nil, nil
+	}
+
+	var limit RateLimit
+	if err := json.Unmarshal([]byte(workspace.RateLimit), &limit); err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// SetRateLimit sets the per-host rate limit of a workspace (admin only).
+// A nil limit makes the workspace use the global limit again.
+func (ws *WorkspaceService) SetRateLimit(workspaceID uint, userID uint, limit *RateLimit) error {
+	var userWorkspace UserWorkspace
+	if err := DB.Where("user_id = ? AND workspace_id = ?", userID, workspaceID).First(&userWorkspace).Error; err != nil {
+		return errors.New("access denied")
+	}
+
+	if userWorkspace.Role != "admin" {
+		return errors.New("only admins can update the rate limit")
+	}
+
+	if limit != nil && (limit.RequestsPerSecond < 0 || limit.Burst < 0 || limit.MaxInFlight < 0) {
+		return errors.New("rate limit values cannot be negative")
+	}
+
+	data := ""
+	if limit != nil {
+		encoded, err := json.Marshal(limit)
+		if err != nil {
+			return err
+		}
+		data = string(encoded)
+	}
+
+	if err := DB.Model(&WorkspaceDB{}).Where("id = ?", workspaceID).Update("rate_limit", data).Error; err != nil {
+		return err
+	}
+
+	DefaultEngine().SetRateLimit(WorkspaceRateLimitScope(workspaceID), limit)
+	return nil
+}
+
+// LoadRateLimits applies the saved workspace rate limits to the default engine
+func (ws *WorkspaceService) LoadRateLimits() error {
+	var workspaces []WorkspaceDB
+	if err := DB.Where("rate_limit <> ?", "").Find(&workspaces).Error; err != nil {
+		return err
+	}
+
+	for _, workspace := range workspaces {
+		var limit RateLimit
+		if err := json.Unmarshal([]byte(workspace.RateLimit), &limit); err != nil {
+			continue
+		}
+		DefaultEngine().SetRateLimit(WorkspaceRateLimitScope(workspace.ID), &limit)
+	}
+	return nil
+}
@@ -1,11 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"RestCLI/pkg"
 	
 	"github.com/gorilla/mux"
@@ -22,6 +24,9 @@ var (
 	workspaceService  = pkg.NewWorkspaceService()
 	testRunner        = pkg.NewTestRunner()
 	monitorService    = pkg.NewMonitorService()
+	cookieStore       = pkg.NewCookieStore()
+	cacheStore        = pkg.NewCacheStore()
+	oauth2Store       = pkg.NewOAuth2TokenStore()
 	
 	upgrader = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
@@ -40,6 +45,12 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" && websocket.IsWebSocketUpgrade(r) {
+			// Browsers cannot set headers on a WebSocket, the token comes in the URL
+			if token := r.URL.Query().Get("access_token"); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
 		if authHeader == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
 			return
@@ -160,59 +171,141 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	workspaceID := getWorkspaceID(r)
 
 	var request pkg.APIRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+	if savedID := r.URL.Query().Get("savedRequestId"); savedID != "" {
+		// A request saved in the database is sent as saved, with the auth of
+		// its folders and collection
+		id, err := strconv.ParseUint(savedID, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid saved request ID", http.StatusBadRequest)
+			return
+		}
+		if request, err = pkg.LoadSavedRequest(uint(id), workspaceID, userID); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
 		return
 	}
 
-	// Initialize headers if nil
-	if request.Headers == nil {
-		request.Headers = make(map[string]string)
+	switch {
+	case request.GRPC != nil:
+		// gRPC calls are kept in history under their own method
+		request.Method = "GRPC"
+	case request.JSONRPC != nil || request.SOAP != nil:
+		request.Method = "POST"
+		if request.SOAP != nil && request.SOAP.WSDL != "" && !isWebURL(request.SOAP.WSDL) {
+			http.Error(w, "WSDL URL must use http or https", http.StatusBadRequest)
+			return
+		}
+	default:
+		switch strings.ToUpper(request.Method) {
+		case "GET", "POST", "PUT", "PATCH", "DELETE", "HEAD":
+		default:
+			http.Error(w, "Unsupported HTTP method", http.StatusBadRequest)
+			return
+		}
 	}
 
-	var response pkg.APIResponse
+	// A request sent from a collection inherits the auth of its folder and collection
+	if query := r.URL.Query(); query.Get("collectionId") != "" {
+		collectionWorkspace, ok := callerCollectionWorkspace(w, r, query.Get("workspaceId"))
+		if !ok {
+			return
+		}
+		auth, err := collectionManager.RequestAuth(collectionWorkspace, query.Get("collectionId"), query.Get("folderId"), request.Auth)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		request.Auth = auth
+	}
 
-	// Resolve variables in URL and body
-	request.URL = variableResolver.ResolveVariables(request.URL, "")
-	request.Body = variableResolver.ResolveVariables(request.Body, "")
+	request = prepareRequest(request, userID, workspaceID)
 
-	// Execute request based on method
-	switch strings.ToUpper(request.Method) {
-	case "GET":
-		response = pkg.HandleGetRequestAdvanced(request.URL, request.Headers)
-	case "POST":
-		response = pkg.HandlePostRequestAdvanced(request.URL, request.Headers, request.Body)
-	case "PUT":
-		response = pkg.HandlePutRequestAdvanced(request.URL, request.Headers, request.Body)
-	case "PATCH":
-		response = pkg.HandlePatchRequestAdvanced(request.URL, request.Headers, request.Body)
-	case "DELETE":
-		response = pkg.HandleDeleteRequestAdvanced(request.URL, request.Headers)
-	case "HEAD":
-		response = pkg.HandleHeadRequestAdvanced(request.URL, request.Headers)
-	default:
-		http.Error(w, "Unsupported HTTP method", http.StatusBadRequest)
-		return
-	}
+	// The request is cancelled if the browser goes away before it completes
+	response := pkg.DefaultEngine().Execute(r.Context(), request)
 
-	// Save to request history
+	// Save to request history, without the secrets of its auth
+	sent := pkg.MaskSecrets(request)
 	history := pkg.RequestHistory{
 		UserID:       userID,
 		WorkspaceID:  workspaceID,
 		Method:       request.Method,
-		URL:          request.URL,
-		Headers:      marshalToJSON(request.Headers),
-		Body:         request.Body,
+		URL:          historyURL(sent),
+		Headers:      sent.HeaderFields().ObjectJSON(),
+		Body:         historyBody(request),
 		StatusCode:   response.StatusCode,
+		Protocol:     response.Protocol,
+		RespHeaders:  response.RawHeaders.ObjectJSON(),
 		ResponseTime: response.ResponseTime.Milliseconds(),
+		ResponseSize: response.BodySize,
+		WireSize:     response.WireSize,
+		Timing:       marshalToJSON(response.Timing),
 		Success:      response.StatusCode >= 200 && response.StatusCode < 400,
 	}
+	if response.GRPCStatus != nil {
+		history.GRPCStatus = response.GRPCStatus.Name
+		history.Trailers = response.Trailers.ObjectJSON()
+	}
 	pkg.DB.Create(&history)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// SavedRequestsHandler saves a request, such as a WebSocket session with its
+// subprotocols and messages, into a collection of the caller's workspace.
+// RequestHandler sends it by its ID.
+func SavedRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		CollectionID uint           `json:"collectionId"`
+		FolderID     *uint          `json:"folderId"` // the collection root when null
+		Name         string         `json:"name"`
+		Request      pkg.APIRequest `json:"request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := pkg.SaveRequest(req.Request, req.Name, req.CollectionID, req.FolderID, getWorkspaceID(r), getUserID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": saved.ID, "name": saved.Name})
+}
+
+// prepareRequest resolves the variables of a request from the browser and
+// applies the active environment, the workspace cookies and rate limit and
+// the user's cache
+func prepareRequest(request pkg.APIRequest, userID, workspaceID uint) pkg.APIRequest {
+	// Resolve variables in URL, query params, headers and body, with the
+	// OAuth2 tokens of the user
+	tokens := oauth2Store.Tokens(userID, workspaceID)
+	request = variableResolver.WithOAuth2Tokens(tokens).ResolveRequest(request, "")
+
+	request.Options = request.Options.WithEnvironment(variableResolver.ActiveEnvironment())
+	request.Options.Cookies = cookieStore.Jar(workspaceID, activeEnvironmentID())
+	request.Options.RateLimitScope = pkg.WorkspaceRateLimitScope(workspaceID)
+	request.Options.Cache = cacheStore.Cache(userID, workspaceID)
+	request.Options.OAuth2Tokens = tokens
+	return request
+}
+
 // Workspace handlers
 func WorkspacesHandler(w http.ResponseWriter, r *http.Request) {
 	setCORSHeaders(w)
@@ -308,6 +401,64 @@ func WorkspaceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// WorkspaceRateLimitHandler reads and sets the per-host rate limit of a workspace
+func WorkspaceRateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	vars := mux.Vars(r)
+	workspaceID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := getUserID(r)
+
+	switch r.Method {
+	case "GET":
+		limit, err := workspaceService.GetRateLimit(uint(workspaceID), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		// Report the limit in effect, inherited from the global one when unset
+		effective := pkg.DefaultEngine().RateLimit(pkg.WorkspaceRateLimitScope(uint(workspaceID)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rateLimit": limit,
+			"effective": effective,
+		})
+
+	case "PUT":
+		var limit pkg.RateLimit
+		if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := workspaceService.SetRateLimit(uint(workspaceID), userID, &limit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Rate limit updated successfully"})
+
+	case "DELETE":
+		if err := workspaceService.SetRateLimit(uint(workspaceID), userID, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Rate limit removed successfully"})
+	}
+}
+
 // Testing handlers
 func TestSuitesHandler(w http.ResponseWriter, r *http.Request) {
 	setCORSHeaders(w)
@@ -351,8 +502,14 @@ func RunTestSuiteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Run test suite
-	result := testRunner.RunTestSuite(suite)
+	// Run test suite with the cookies of its environment and the workspace rate limit
+	workspaceID := getWorkspaceID(r)
+	result := testRunner.RunTestSuiteWithOptions(suite, pkg.SuiteRunOptions{
+		Cookies:        cookieStore.Jar(workspaceID, suite.Environment),
+		Cache:          pkg.NewResponseCache(),
+		RateLimitScope: pkg.WorkspaceRateLimitScope(workspaceID),
+		OAuth2Tokens:   oauth2Store.Tokens(getUserID(r), workspaceID),
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
@@ -375,7 +532,9 @@ func LoadTestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Run load test
+	// Run load test, throttled by the workspace rate limit
+	config.TestCase.Request.Options.RateLimitScope = pkg.WorkspaceRateLimitScope(getWorkspaceID(r))
+	config.TestCase.Request.Options.OAuth2Tokens = oauth2Store.Tokens(getUserID(r), getWorkspaceID(r))
 	result := testRunner.RunLoadTest(config)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -446,6 +605,32 @@ func MonitorStatsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// wsMessage is a JSON message on the /api/ws socket. The browser starts an
+// event stream with "sse.start" and a request and ends it with "sse.stop";
+// the server sends "sse.event" for every event and "sse.end" with the final
+// response. WebSocket sessions work the same way: "ws.connect" opens one and
+// is answered with "ws.open", "ws.send" sends a message and "ws.close"
+// closes it; the server sends "ws.message" for every message sent or
+// received, "ws.error" when a message cannot be sent and "ws.closed" with
+// the session log. ID is chosen by the browser
+// to tell its streams and sessions apart.
+type wsMessage struct {
+	Type     string                 `json:"type"`
+	ID       string                 `json:"id,omitempty"`
+	Request  *pkg.APIRequest        `json:"request,omitempty"`
+	Event    *pkg.SSEEvent          `json:"event,omitempty"`
+	Message  *pkg.WebSocketMessage  `json:"message,omitempty"`
+	Entry    *pkg.WebSocketLogEntry `json:"entry,omitempty"`
+	Response *pkg.APIResponse       `json:"response,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// activeStream is an event stream opened over the WebSocket, removed when
+// it ends unless a newer stream has taken its ID
+type activeStream struct {
+	stop context.CancelFunc
+}
+
 // WebSocket handler for real-time features
 func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -454,16 +639,161 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	// Handle WebSocket connections for real-time monitoring, collaboration, etc.
+	userID := getUserID(r)
+	workspaceID := getWorkspaceID(r)
+
+	// Streams write from their own goroutines
+	var writeMutex sync.Mutex
+	write := func(messageType int, data []byte) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return conn.WriteMessage(messageType, data)
+	}
+	writeJSON := func(message wsMessage) {
+		data, _ := json.Marshal(message)
+		write(websocket.TextMessage, data)
+	}
+
+	// Every stream and session stops when the socket closes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var streamsMutex sync.Mutex
+	streams := make(map[string]*activeStream)
+	sessions := make(map[string]*pkg.WebSocketSession)
+	defer func() {
+		streamsMutex.Lock()
+		defer streamsMutex.Unlock()
+		for _, session := range sessions {
+			session.Close()
+		}
+	}()
+
 	for {
-		messageType, message, err := conn.ReadMessage()
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
 
-		// Echo message back (placeholder for real-time features)
-		if err := conn.WriteMessage(messageType, message); err != nil {
-			break
+		var message wsMessage
+		if messageType != websocket.TextMessage || json.Unmarshal(data, &message) != nil ||
+			!(strings.HasPrefix(message.Type, "sse.") || strings.HasPrefix(message.Type, "ws.")) {
+			// Echo anything else back (placeholder for other real-time features)
+			if err := write(messageType, data); err != nil {
+				break
+			}
+			continue
+		}
+
+		switch message.Type {
+		case "sse.start":
+			if message.Request == nil {
+				writeJSON(wsMessage{Type: "sse.end", ID: message.ID, Error: "request is required"})
+				continue
+			}
+
+			request := prepareRequest(*message.Request, userID, workspaceID)
+			stream := pkg.SSEOptions{}
+			if request.Options.EventStream != nil {
+				stream = *request.Options.EventStream
+			}
+			id := message.ID
+			stream.OnEvent = func(event pkg.SSEEvent) {
+				writeJSON(wsMessage{Type: "sse.event", ID: id, Event: &event})
+			}
+			request.Options.EventStream = &stream
+
+			streamCtx, stop := context.WithCancel(ctx)
+			active := &activeStream{stop: stop}
+			streamsMutex.Lock()
+			if previous, exists := streams[id]; exists {
+				previous.stop()
+			}
+			streams[id] = active
+			streamsMutex.Unlock()
+
+			go func() {
+				defer stop()
+				response := pkg.DefaultEngine().Execute(streamCtx, request)
+				streamsMutex.Lock()
+				if streams[id] == active {
+					delete(streams, id)
+				}
+				streamsMutex.Unlock()
+				writeJSON(wsMessage{Type: "sse.end", ID: id, Response: &response})
+			}()
+
+		case "sse.stop":
+			streamsMutex.Lock()
+			if active, exists := streams[message.ID]; exists {
+				active.stop()
+				delete(streams, message.ID)
+			}
+			streamsMutex.Unlock()
+
+		case "ws.connect":
+			if message.Request == nil {
+				writeJSON(wsMessage{Type: "ws.closed", ID: message.ID, Error: "request is required"})
+				continue
+			}
+
+			request := prepareRequest(*message.Request, userID, workspaceID)
+			options := pkg.WebSocketOptions{}
+			if request.Options.WebSocket != nil {
+				options = *request.Options.WebSocket
+			}
+			id := message.ID
+			options.OnMessage = func(entry pkg.WebSocketLogEntry) {
+				writeJSON(wsMessage{Type: "ws.message", ID: id, Entry: &entry})
+			}
+			request.Options.WebSocket = &options
+
+			session, response := pkg.DefaultEngine().OpenWebSocket(ctx, request)
+			if session == nil {
+				writeJSON(wsMessage{Type: "ws.closed", ID: id, Response: &response, Error: response.Error})
+				continue
+			}
+			streamsMutex.Lock()
+			if previous, exists := sessions[id]; exists {
+				go previous.Close()
+			}
+			sessions[id] = session
+			streamsMutex.Unlock()
+			writeJSON(wsMessage{Type: "ws.open", ID: id, Response: &response})
+
+			go func() {
+				<-session.Done()
+				streamsMutex.Lock()
+				if sessions[id] == session {
+					delete(sessions, id)
+				}
+				streamsMutex.Unlock()
+
+				response.Messages = session.Log()
+				if err := session.Err(); err != nil {
+					response.Error = err.Error()
+				}
+				writeJSON(wsMessage{Type: "ws.closed", ID: id, Response: &response, Error: response.Error})
+			}()
+
+		case "ws.send":
+			streamsMutex.Lock()
+			session := sessions[message.ID]
+			streamsMutex.Unlock()
+			if session == nil || message.Message == nil {
+				writeJSON(wsMessage{Type: "ws.error", ID: message.ID, Error: "no open session or message"})
+				continue
+			}
+			if err := session.Send(*message.Message); err != nil {
+				writeJSON(wsMessage{Type: "ws.error", ID: message.ID, Error: err.Error()})
+			}
+
+		case "ws.close":
+			streamsMutex.Lock()
+			session := sessions[message.ID]
+			streamsMutex.Unlock()
+			if session != nil {
+				go session.Close()
+			}
 		}
 	}
 }
@@ -482,8 +812,15 @@ func CollectionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		// Get all workspaces and collections
-		workspaces := collectionManager.GetWorkspaces()
+		// Get the collections of the caller's workspace, without the secrets of their auth
+		collectionWorkspace, ok := callerCollectionWorkspace(w, r, "")
+		if !ok {
+			return
+		}
+		workspaces := make(map[string]*pkg.Workspace)
+		if workspace := collectionManager.MaskedWorkspace(collectionWorkspace); workspace != nil {
+			workspaces[collectionWorkspace] = workspace
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(workspaces)
 	case "POST":
@@ -498,7 +835,11 @@ func CollectionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		collection, err := collectionManager.CreateCollection(req.WorkspaceID, req.Name, req.Description)
+		collectionWorkspace, ok := callerCollectionWorkspace(w, r, req.WorkspaceID)
+		if !ok {
+			return
+		}
+		collection, err := collectionManager.CreateCollection(collectionWorkspace, req.Name, req.Description)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -506,11 +847,107 @@ func CollectionsHandler(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(collection)
+	case "PUT":
+		// Save a request, such as a WebSocket session, into a collection
+		var req struct {
+			WorkspaceID  string           `json:"workspaceId"`
+			CollectionID string           `json:"collectionId"`
+			Request      pkg.SavedRequest `json:"request"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		collectionWorkspace, ok := callerCollectionWorkspace(w, r, req.WorkspaceID)
+		if !ok {
+			return
+		}
+		if err := collectionManager.AddRequestToCollection(collectionWorkspace, req.CollectionID, req.Request); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// CollectionFoldersHandler creates folders in a collection
+func CollectionFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		WorkspaceID  string           `json:"workspaceId"`
+		CollectionID string           `json:"collectionId"`
+		ParentID     string           `json:"parentId"`
+		Name         string           `json:"name"`
+		Auth         *pkg.RequestAuth `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	collectionWorkspace, ok := callerCollectionWorkspace(w, r, req.WorkspaceID)
+	if !ok {
+		return
+	}
+	folder, err := collectionManager.CreateFolder(collectionWorkspace, req.CollectionID, req.ParentID, req.Name, req.Auth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	masked := *folder
+	masked.Auth = pkg.MaskAuth(folder.Auth)
+	json.NewEncoder(w).Encode(masked)
+}
+
+// CollectionAuthHandler sets the auth of a collection, or of one of its
+// folders, that the requests inside inherit
+func CollectionAuthHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "PUT" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		WorkspaceID  string           `json:"workspaceId"`
+		CollectionID string           `json:"collectionId"`
+		FolderID     string           `json:"folderId"` // the collection itself when empty
+		Auth         *pkg.RequestAuth `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	collectionWorkspace, ok := callerCollectionWorkspace(w, r, req.WorkspaceID)
+	if !ok {
+		return
+	}
+	if err := collectionManager.SetAuth(collectionWorkspace, req.CollectionID, req.FolderID, req.Auth); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // EnvironmentsHandler handles environment operations
 func EnvironmentsHandler(w http.ResponseWriter, r *http.Request) {
 	// Enable CORS
@@ -531,6 +968,9 @@ func EnvironmentsHandler(w http.ResponseWriter, r *http.Request) {
 			EnvironmentID string          `json:"environmentId"`
 			Name        string            `json:"name"`
 			Variables   map[string]string `json:"variables"`
+			TLS         *pkg.TLSOptions   `json:"tls"`
+			Proxy       *pkg.ProxyOptions `json:"proxy"`
+			Resolve     map[string]string `json:"resolve"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid JSON request", http.StatusBadRequest)
@@ -546,6 +986,9 @@ func EnvironmentsHandler(w http.ResponseWriter, r *http.Request) {
 				Name:      req.Name,
 				Variables: req.Variables,
 				Active:    false,
+				TLS:       req.TLS,
+				Proxy:     req.Proxy,
+				Resolve:   req.Resolve,
 			}
 			variableResolver.AddEnvironment(env)
 			w.Header().Set("Content-Type", "application/json")
@@ -556,6 +999,258 @@ func EnvironmentsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CookiesHandler lists, sets and deletes the cookies of the workspace jar for
+// an environment. The environment query parameter defaults to the active one.
+func CookiesHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	environment := r.URL.Query().Get("environment")
+	if environment == "" {
+		environment = activeEnvironmentID()
+	}
+	jar := cookieStore.Jar(getWorkspaceID(r), environment)
+
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jar.All())
+
+	case "POST", "PUT":
+		var cookie pkg.Cookie
+		if err := json.NewDecoder(r.Body).Decode(&cookie); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := jar.Set(cookie); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jar.All())
+
+	case "DELETE":
+		// Without a name the whole jar is cleared
+		query := r.URL.Query()
+		if name := query.Get("name"); name != "" {
+			jar.Delete(name, query.Get("domain"), query.Get("path"))
+		} else {
+			jar.Clear()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Cookies deleted successfully"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CacheHandler clears the response cache of the workspace
+func CacheHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cacheStore.Cache(getUserID(r), getWorkspaceID(r)).Clear()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Cache cleared successfully"})
+}
+
+// GraphQLSchemaHandler fetches, returns and forgets introspected GraphQL schemas
+func GraphQLSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	schemas := pkg.DefaultEngine().GraphQLSchemas()
+	switch r.Method {
+	case "GET":
+		schema := schemas.Get(r.URL.Query().Get("url"))
+		if schema == nil {
+			http.Error(w, "Schema not fetched", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schema)
+
+	case "POST":
+		var req struct {
+			Request pkg.APIRequest `json:"request"`
+			Refresh bool           `json:"refresh"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		request := prepareRequest(req.Request, getUserID(r), getWorkspaceID(r))
+		schema, err := pkg.DefaultEngine().IntrospectGraphQL(r.Context(), request, req.Refresh)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schema)
+
+	case "DELETE":
+		schemas.Remove(r.URL.Query().Get("url"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Schema removed successfully"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// OAuth2TokenHandler obtains the OAuth2 token of a request's auth, or clears
+// the user's tokens of the active environment
+func OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		var req struct {
+			Request pkg.APIRequest `json:"request"`
+			Refresh bool           `json:"refresh"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		request := prepareRequest(req.Request, getUserID(r), getWorkspaceID(r))
+		token, err := pkg.DefaultEngine().OAuth2Token(r.Context(), request, req.Refresh)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(token)
+
+	case "DELETE":
+		oauth2Store.Tokens(getUserID(r), getWorkspaceID(r)).Clear(activeEnvironmentID())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Tokens cleared successfully"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GRPCServicesHandler lists the services of a gRPC server, found by server
+// reflection or in the request's .proto files
+func GRPCServicesHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Request pkg.APIRequest `json:"request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	request := prepareRequest(req.Request, getUserID(r), getWorkspaceID(r))
+	services, err := pkg.DefaultEngine().GRPCServices(r.Context(), request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services)
+}
+
+// WSDLHandler lists the operations of the SOAP services a WSDL describes
+func WSDLHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Request pkg.APIRequest `json:"request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Only WSDLs on the web are imported, not files on the server
+	if !isWebURL(req.Request.URL) {
+		http.Error(w, "WSDL URL must use http or https", http.StatusBadRequest)
+		return
+	}
+
+	request := prepareRequest(req.Request, getUserID(r), getWorkspaceID(r))
+	services, err := pkg.DefaultEngine().ImportWSDL(r.Context(), request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services)
+}
+
+// isWebURL reports whether a URL uses http or https
+func isWebURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// callerCollectionWorkspace returns the ID under which the collections of the
+// caller's workspace are kept, the workspace of their token. A workspace
+// named by the request must be that one; otherwise an error is written and
+// ok is false.
+func callerCollectionWorkspace(w http.ResponseWriter, r *http.Request, requested string) (string, bool) {
+	workspaceID := getWorkspaceID(r)
+	if !workspaceService.HasWorkspaceAccess(getUserID(r), workspaceID) {
+		http.Error(w, "Access denied to workspace", http.StatusForbidden)
+		return "", false
+	}
+	id := strconv.FormatUint(uint64(workspaceID), 10)
+	if requested != "" && requested != id {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return "", false
+	}
+	return id, true
+}
+
+// activeEnvironmentID returns the ID of the active environment, or an empty string
+func activeEnvironmentID() string {
+	if env := variableResolver.ActiveEnvironment(); env != nil {
+		return env.ID
+	}
+	return ""
+}
+
 // generateID generates a simple ID
 func generateID() string {
 	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(pkg.NewVariableResolver().ResolveVariables("{{timestamp}}", ""), ":", ""), "-", ""), " ", "")
@@ -587,6 +1282,8 @@ func CodeGenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Include the host overrides of the active environment
+	req.Request.Options = req.Request.Options.WithEnvironment(variableResolver.ActiveEnvironment())
 	code := codeGenerator.GenerateCode(req.Request, req.Language)
 	
 	response := map[string]string{
@@ -598,6 +1295,38 @@ func CodeGenHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// ParseQueryHandler splits a pasted URL into its base URL and query params
+func ParseQueryHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	baseURL, params := pkg.ParseQueryParams(req.URL)
+	if params == nil {
+		params = []pkg.QueryParam{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":         baseURL,
+		"queryParams": params,
+	})
+}
+
 // MockServerHandler handles mock server operations
 func MockServerHandler(w http.ResponseWriter, r *http.Request) {
 	// Enable CORS
@@ -696,6 +1425,26 @@ func getWorkspaceID(r *http.Request) uint {
 	return uint(workspaceID)
 }
 
+// historyURL returns the URL to store in history; gRPC calls add the method path
+func historyURL(request pkg.APIRequest) string {
+	if request.GRPC != nil {
+		return strings.TrimSuffix(request.URL, "/") + "/" + strings.TrimPrefix(request.GRPC.Method, "/")
+	}
+	return request.FullURL()
+}
+
+// historyBody returns the body to store in history; form bodies are stored as
+// their field list and gRPC calls as their messages
+func historyBody(request pkg.APIRequest) string {
+	if request.GRPC != nil && len(request.GRPC.Messages) > 0 {
+		return marshalToJSON(request.GRPC.Messages)
+	}
+	if len(request.Form) > 0 && (request.BodyType == pkg.BodyTypeFormData || request.BodyType == pkg.BodyTypeURLEncoded) {
+		return marshalToJSON(request.Form)
+	}
+	return request.Body
+}
+
 func marshalToJSON(data interface{}) string {
 	bytes, _ := json.Marshal(data)
 	return string(bytes)
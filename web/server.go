@@ -17,6 +17,9 @@ func StartWebServer(port string) {
 	if err := pkg.InitDatabase(dbPath); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
+	if err := pkg.NewWorkspaceService().LoadRateLimits(); err != nil {
+		log.Printf("Failed to load workspace rate limits: %v", err)
+	}
 
 	// Create router with enhanced API endpoints
 	r := mux.NewRouter()
@@ -51,10 +54,20 @@ func StartWebServer(port string) {
 	
 	// Enhanced API endpoints
 	protected.HandleFunc("/request", api.RequestHandler).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/requests/saved", api.SavedRequestsHandler).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/collections", api.CollectionsHandler).Methods("GET", "POST", "PUT", "DELETE", "OPTIONS")
+	protected.HandleFunc("/collections/folders", api.CollectionFoldersHandler).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/collections/auth", api.CollectionAuthHandler).Methods("PUT", "OPTIONS")
 	protected.HandleFunc("/collections/{id}", api.CollectionHandler).Methods("GET", "PUT", "DELETE", "OPTIONS")
 	protected.HandleFunc("/environments", api.EnvironmentsHandler).Methods("GET", "POST", "PUT", "DELETE", "OPTIONS")
+	protected.HandleFunc("/cookies", api.CookiesHandler).Methods("GET", "POST", "PUT", "DELETE", "OPTIONS")
+	protected.HandleFunc("/cache", api.CacheHandler).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/graphql/schema", api.GraphQLSchemaHandler).Methods("GET", "POST", "DELETE", "OPTIONS")
+	protected.HandleFunc("/oauth2/token", api.OAuth2TokenHandler).Methods("POST", "DELETE", "OPTIONS")
+	protected.HandleFunc("/grpc/services", api.GRPCServicesHandler).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/soap/wsdl", api.WSDLHandler).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/codegen", api.CodeGenHandler).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/query/parse", api.ParseQueryHandler).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/mock", api.MockServerHandler).Methods("GET", "POST", "PUT", "DELETE", "OPTIONS")
 	protected.HandleFunc("/docs", api.DocumentationHandler).Methods("GET", "POST", "OPTIONS")
 	
@@ -64,6 +77,7 @@ func StartWebServer(port string) {
 	protected.HandleFunc("/workspaces/{id}/members", api.WorkspaceMembersHandler).Methods("GET", "POST", "DELETE", "OPTIONS")
 	protected.HandleFunc("/workspaces/{id}/invite", api.InviteUserHandler).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/workspaces/{id}/stats", api.WorkspaceStatsHandler).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/workspaces/{id}/ratelimit", api.WorkspaceRateLimitHandler).Methods("GET", "PUT", "DELETE", "OPTIONS")
 	
 	// User management
 	protected.HandleFunc("/users/profile", api.UserProfileHandler).Methods("GET", "PUT", "OPTIONS")
@@ -783,6 +783,12 @@ class RESTerX {
             return;
         }
 
+        // WebSocket URLs open a session, later sends go to the open session
+        if (url.startsWith('ws://') || url.startsWith('wss://')) {
+            this.sendWebSocket(this.resolveVariables(url), this.collectHeaders(), this.resolveVariables(this.collectRequestBody()));
+            return;
+        }
+
         // Add protocol if missing
         if (!url.startsWith('http://') && !url.startsWith('https://')) {
             url = 'https://' + url;
@@ -841,6 +847,9 @@ class RESTerX {
             // In static mode, make direct HTTP requests instead of using backend
             if (this.isStaticMode) {
                 result = await this.makeDirectHttpRequest(request);
+            } else if (this.isEventStreamRequest(headers)) {
+                // Event streams arrive over the WebSocket as the server receives them
+                result = await this.streamEvents(request);
             } else {
                 // Use backend API
                 const requestHeaders = { 'Content-Type': 'application/json' };
@@ -875,6 +884,183 @@ class RESTerX {
         }
     }
 
+    // A request asking for text/event-stream is run as a Server-Sent Events subscription
+    isEventStreamRequest(headers) {
+        return Object.entries(headers).some(([key, value]) =>
+            key.toLowerCase() === 'accept' && value.toLowerCase().includes('text/event-stream'));
+    }
+
+    // Run an event stream through /api/ws, showing events live until the
+    // stream ends or stopEventStream is called; resolves with the final response
+    streamEvents(request) {
+        this.stopEventStream();
+
+        return new Promise((resolve, reject) => {
+            const scheme = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+            const socket = new WebSocket(`${scheme}//${window.location.host}/api/ws?access_token=${encodeURIComponent(this.authToken || '')}`);
+            const id = 'sse-' + Date.now();
+            const responseBody = document.getElementById('responseBody');
+            let count = 0;
+            this.eventStream = { socket, id };
+
+            responseBody.textContent = '';
+            this.showLoading(false);
+
+            socket.onopen = () => {
+                socket.send(JSON.stringify({ type: 'sse.start', id, request }));
+            };
+            socket.onmessage = (message) => {
+                const data = JSON.parse(message.data);
+                if (data.id !== id) {
+                    return;
+                }
+                if (data.type === 'sse.event') {
+                    const event = data.event;
+                    const time = new Date(event.receivedAt).toLocaleTimeString();
+                    responseBody.textContent += `[${time}] event: ${event.event}${event.id ? '  id: ' + event.id : ''}\n${event.data}\n\n`;
+                    document.getElementById('responseSize').textContent = `${++count} events`;
+                } else if (data.type === 'sse.end') {
+                    socket.close();
+                    this.eventStream = null;
+                    if (data.error) {
+                        reject(new Error(data.error));
+                    } else {
+                        resolve(data.response);
+                    }
+                }
+            };
+            socket.onerror = () => {
+                this.eventStream = null;
+                reject(new Error('Event stream connection failed'));
+            };
+        });
+    }
+
+    // Stop the running event stream, its final response is still shown
+    stopEventStream() {
+        if (this.eventStream && this.eventStream.socket.readyState === WebSocket.OPEN) {
+            this.eventStream.socket.send(JSON.stringify({ type: 'sse.stop', id: this.eventStream.id }));
+        }
+    }
+
+    // Send the request body on the WebSocket session for url, connecting
+    // first when no session to url is open. Bodies that parse as JSON are
+    // sent as JSON messages.
+    sendWebSocket(url, headers, body) {
+        if (this.isStaticMode) {
+            this.showNotification('WebSocket sessions need the RESTerX server', 'error');
+            return;
+        }
+
+        const message = body ? { type: this.isJson(body) ? 'json' : 'text', data: body } : null;
+        if (this.webSocketSession && this.webSocketSession.url === url) {
+            if (message) {
+                this.webSocketSession.socket.send(JSON.stringify({ type: 'ws.send', id: this.webSocketSession.id, message }));
+            }
+            return;
+        }
+        this.closeWebSocket();
+
+        const scheme = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const socket = new WebSocket(`${scheme}//${window.location.host}/api/ws?access_token=${encodeURIComponent(this.authToken || '')}`);
+        const id = 'ws-' + Date.now();
+        const session = { socket, id, url, headers, log: [] };
+        const responseBody = document.getElementById('responseBody');
+        this.webSocketSession = session;
+        responseBody.textContent = '';
+
+        socket.onopen = () => {
+            socket.send(JSON.stringify({ type: 'ws.connect', id, request: { method: 'GET', url, headers } }));
+        };
+        socket.onmessage = (event) => {
+            const data = JSON.parse(event.data);
+            if (data.id !== id) {
+                return;
+            }
+            switch (data.type) {
+                case 'ws.open':
+                    this.displayResponse(data.response);
+                    responseBody.textContent = '';
+                    this.showNotification('WebSocket connected, Send sends the body as a message', 'success');
+                    if (message) {
+                        socket.send(JSON.stringify({ type: 'ws.send', id, message }));
+                    }
+                    break;
+                case 'ws.message': {
+                    const entry = data.entry;
+                    const time = new Date(entry.time).toLocaleTimeString();
+                    session.log.push(entry);
+                    responseBody.textContent += `[${time}] ${entry.direction === 'sent' ? '>>' : '<<'} ${entry.type}: ${entry.data}\n`;
+                    document.getElementById('responseSize').textContent = `${session.log.length} messages`;
+                    break;
+                }
+                case 'ws.error':
+                    this.showNotification(data.error, 'error');
+                    break;
+                case 'ws.closed':
+                    if (this.webSocketSession === session) {
+                        this.webSocketSession = null;
+                    }
+                    this.lastWebSocketSession = session;
+                    socket.close();
+                    if (data.error && !data.response?.messages) {
+                        this.displayResponse(data.response || { error: data.error });
+                    } else {
+                        this.showNotification('WebSocket closed', 'info');
+                    }
+                    break;
+            }
+        };
+        socket.onerror = () => {
+            this.displayError('WebSocket connection failed');
+            this.webSocketSession = null;
+        };
+    }
+
+    isJson(text) {
+        try {
+            JSON.parse(text);
+            return true;
+        } catch (e) {
+            return false;
+        }
+    }
+
+    // Close the open WebSocket session, if any
+    closeWebSocket() {
+        const session = this.webSocketSession;
+        if (session && session.socket.readyState === WebSocket.OPEN) {
+            session.socket.send(JSON.stringify({ type: 'ws.close', id: session.id }));
+        }
+    }
+
+    // Save the messages sent in the current or last WebSocket session as a
+    // request of a collection, so the sequence can be replayed
+    saveWebSocketSession(collectionId, name) {
+        const session = this.webSocketSession || this.lastWebSocketSession;
+        const collection = this.collections.find(c => c.id === collectionId);
+        if (!session || !collection) {
+            this.showNotification('No WebSocket session or collection to save to', 'error');
+            return;
+        }
+
+        const messages = session.log
+            .filter(entry => entry.direction === 'sent' && entry.type !== 'close')
+            .map(entry => ({ type: entry.type, data: entry.data }));
+        collection.requests.push({
+            id: 'req_' + Date.now(),
+            name: name || session.url,
+            method: 'GET',
+            url: session.url,
+            headers: session.headers,
+            body: '',
+            webSocket: { messages },
+            createdAt: new Date().toISOString()
+        });
+        localStorage.setItem('resterx-collections', JSON.stringify(this.collections));
+        this.loadCollections();
+    }
+
     // Make direct HTTP request in static mode (no backend proxy)
     async makeDirectHttpRequest(request) {
         const startTime = Date.now();
@@ -1020,6 +1206,8 @@ class RESTerX {
         const responseBody = document.getElementById('responseBody');
         if (response.error) {
             responseBody.textContent = response.error;
+        } else if (response.isBinary) {
+            responseBody.textContent = `Binary content (${response.contentType || 'unknown type'}, ${response.bodySize} bytes)`;
         } else {
             responseBody.textContent = response.body || 'No content';
         }
@@ -1653,6 +1841,14 @@ class RESTerX {
             return;
         }
 
+        // Escape: Stop a running event stream or WebSocket session
+        if (e.key === 'Escape' && (this.eventStream || this.webSocketSession)) {
+            e.preventDefault();
+            this.stopEventStream();
+            this.closeWebSocket();
+            return;
+        }
+
         // Ctrl+K: Focus URL input (like Postman)
         if (e.ctrlKey && e.key === 'k') {
             e.preventDefault();